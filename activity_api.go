@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// activityTypePattern allows lower-case activity names such as "login" or "page_view"
+var activityTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// maxActivitiesPerRequest bounds the size of one ingestion batch
+const maxActivitiesPerRequest = 500
+
+// RecordActivitiesHandler ingests user activities pushed by the CRM or data pipeline.
+// The batch is validated up front and written in one transaction, so either every
+// activity is recorded or none.
+func RecordActivitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RecordActivitiesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Activities) == 0 || len(req.Activities) > maxActivitiesPerRequest {
+		http.Error(w, fmt.Sprintf("activities must contain 1 to %d items", maxActivitiesPerRequest), http.StatusBadRequest)
+		return
+	}
+
+	knownUsers := make(map[int]bool)
+	for i, a := range req.Activities {
+		if !activityTypePattern.MatchString(a.ActivityType) {
+			http.Error(w, fmt.Sprintf("activities[%d]: invalid activity_type %q", i, a.ActivityType), http.StatusBadRequest)
+			return
+		}
+		if knownUsers[a.UserID] {
+			continue
+		}
+		user, err := store.GetUserByID(a.UserID)
+		if err != nil {
+			log.Printf("Error retrieving user %d: %v", a.UserID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, fmt.Sprintf("activities[%d]: user %d not found", i, a.UserID), http.StatusUnprocessableEntity)
+			return
+		}
+		knownUsers[a.UserID] = true
+	}
+
+	if err := store.RecordUserActivities(req.Activities); err != nil {
+		log.Printf("Error recording activities: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	caller, _ := AuthUserFromContext(r.Context())
+	log.Printf("Recorded %d activities (API key %d, user %d)", len(req.Activities), caller.APIKeyID, caller.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"recorded": len(req.Activities),
+	})
+}
+
+// UserPredictionsHandler returns the most recent streak predictions for a user (?limit=, default 10)
+func UserPredictionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := userFromPath(w, r)
+	if !ok {
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	predictions, err := store.GetStreakPredictions(user.UserID, limit)
+	if err != nil {
+		log.Printf("Error getting streak predictions for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if predictions == nil {
+		predictions = []StreakPrediction{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(predictions)
+}
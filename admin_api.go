@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// UnlockUserHandler clears the failed login counter and lockout of an account
+func UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := userFromPath(w, r)
+	if !ok {
+		return
+	}
+	userID := user.UserID
+
+	if err := loginLimiter.ResetAccount(userID); err != nil {
+		log.Printf("Error unlocking user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	log.Printf("Admin %d unlocked user %d", admin.UserID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Account unlocked",
+		"user_id": userID,
+	})
+}
+
+// UserRolesHandler shows (GET) or replaces (PUT) the roles of a user.
+// New roles show up in the user's tokens at the next login or token refresh.
+func UserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req UpdateRolesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		roles, err := normalizeRoles(req.Roles)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		admin, _ := AuthUserFromContext(r.Context())
+		if admin.UserID == user.UserID && !rolesGrant(roles, PermUsersManage) {
+			http.Error(w, "You can't remove your own admin role", http.StatusBadRequest)
+			return
+		}
+
+		if err := store.SetUserRoles(user.UserID, roles); err != nil {
+			log.Printf("Error setting roles for user %d: %v", user.UserID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Admin %d set roles of user %d to %v", admin.UserID, user.UserID, roles)
+		user.Roles = roles
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": user.UserID,
+		"roles":   user.Roles,
+	})
+}
+
+// userFromPath loads the user for the {id} path value, writing 400/404 on failure
+func userFromPath(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error retrieving user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// setRoles sends roles for user to UserRolesHandler as admin and returns the response
+func setRoles(t *testing.T, admin *User, userID int, roles ...string) (int, []string) {
+	t.Helper()
+	rec := serveWithID(t, UserRolesHandler, http.MethodPut, userID, UpdateRolesRequest{Roles: roles}, callerFor(admin))
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+	var resp struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding roles: %v", err)
+	}
+	return rec.Code, resp.Roles
+}
+
+func TestUserRolesHandler(t *testing.T) {
+	useMemoryStore(t)
+	admin := createTestUser(t, "admin", "unused")
+	if err := store.SetUserRoles(admin.UserID, []string{RoleCustomer, RoleAdmin}); err != nil {
+		t.Fatalf("SetUserRoles: %v", err)
+	}
+	admin, _ = store.GetUserByID(admin.UserID)
+	alice := createTestUser(t, "alice", "unused")
+	session, err := issueSession(alice, "")
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+
+	if code, _ := setRoles(t, admin, alice.UserID, "owner"); code != http.StatusBadRequest {
+		t.Errorf("unknown role: status %d, want 400", code)
+	}
+	if code, _ := setRoles(t, admin, 9999, RoleAnalyst); code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want 404", code)
+	}
+
+	// The customer role is always kept
+	code, roles := setRoles(t, admin, alice.UserID, RoleAnalyst, RoleAnalyst)
+	if code != http.StatusOK || !slices.Equal(roles, []string{RoleAnalyst, RoleCustomer}) {
+		t.Fatalf("setting analyst: status %d, roles %v; want 200 [analyst customer]", code, roles)
+	}
+	rec := serveWithID(t, UserRolesHandler, http.MethodGet, alice.UserID, nil, callerFor(admin))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET roles: status %d, want 200", rec.Code)
+	}
+
+	// The new role shows up in the token pair issued at the next refresh
+	refreshRec := postJSON(t, RefreshTokenHandler, "/api/token/refresh", RefreshTokenRequest{RefreshToken: session.RefreshToken})
+	var refreshed TokenResponse
+	if refreshRec.Code != http.StatusOK || json.NewDecoder(refreshRec.Body).Decode(&refreshed) != nil {
+		t.Fatalf("refresh: status %d, body %q", refreshRec.Code, refreshRec.Body.String())
+	}
+	claims, err := tokenIssuer.ParseToken(refreshed.Token, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if !slices.Contains(claims.Roles, RoleAnalyst) || !slices.Contains(refreshed.Roles, RoleAnalyst) {
+		t.Errorf("refreshed token roles %v, response roles %v; want analyst", claims.Roles, refreshed.Roles)
+	}
+
+	// Admins can't demote themselves, so there is always someone left to manage roles
+	if code, _ := setRoles(t, admin, admin.UserID, RoleAnalyst); code != http.StatusBadRequest {
+		t.Errorf("self-demotion: status %d, want 400", code)
+	}
+	if after, _ := store.GetUserByID(admin.UserID); !slices.Contains(after.Roles, RoleAdmin) {
+		t.Errorf("admin roles after a rejected self-demotion: %v", after.Roles)
+	}
+	if code, _ := setRoles(t, admin, admin.UserID, RoleAdmin, RoleMarketer); code != http.StatusOK {
+		t.Errorf("admin adding a role to themselves: status %d, want 200", code)
+	}
+}
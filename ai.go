@@ -8,30 +8,48 @@ import (
 	"os"
 )
 
-// AssessUserForOffer simulates an AI model's assessment for generating an offer
-func AssessUserForOffer(userData *UserData) (bool, string) {
+// AssessUserForOffer simulates an AI model's assessment for generating an offer.
+// It returns whether to send an offer and the ID of the category to target, skipping
+// preferred categories that aren't in stockedCategoryIDs: a discount on products the
+// user can't buy would only frustrate them. Serial returners get no offer, since a
+// discount would only reward ordering and sending back.
+func AssessUserForOffer(userData *UserData, stockedCategoryIDs map[int]bool) (bool, int) {
 	// --- THIS SECTION SIMULATES THE RESULT FROM A REAL AI MODEL ---
 	// In a real scenario, ML/AI models would run here to provide predictions.
-	// The churn_risk and preferred_categories in userData are assumed to be
-	// already present from AI's output and stored in the user_preferences table.
+	// The churn_risk and preferred categories in userData are assumed to be
+	// already present from AI's output and stored in the user_preferences and
+	// user_preferred_categories tables.
+
+	if userData.SerialReturner {
+		fmt.Printf("User %s (ID: %d) refunds an abnormal share of their orders; no discount offer.\n",
+			userData.Username, userData.UserID)
+		return false, 0
+	}
 
 	// Assume high churn risk threshold > 0.7
 	isHighChurnRisk := userData.ChurnRisk > 0.7
 
-	preferredCategory := ""
-	if len(userData.PreferredCategories) > 0 {
-		// Pick the most common or most recent category from AI-calculated preferences
-		preferredCategory = userData.PreferredCategories[0]
+	preferredCategoryID := 0
+	for _, categoryID := range userData.PreferredCategoryIDs {
+		// Pick the most preferred category from AI-calculated preferences that has stock
+		if stockedCategoryIDs[categoryID] {
+			preferredCategoryID = categoryID
+			break
+		}
 	}
 
-	if isHighChurnRisk && preferredCategory != "" {
-		fmt.Printf("User %s (ID: %d) has high churn risk (%.2f) and preferred category %s.\n",
-			userData.Username, userData.UserID, userData.ChurnRisk, preferredCategory)
-		return true, preferredCategory
+	if isHighChurnRisk && preferredCategoryID != 0 {
+		fmt.Printf("User %s (ID: %d) has high churn risk (%.2f) and preferred category %d.\n",
+			userData.Username, userData.UserID, userData.ChurnRisk, preferredCategoryID)
+		return true, preferredCategoryID
+	} else if isHighChurnRisk && len(userData.PreferredCategoryIDs) > 0 {
+		fmt.Printf("User %s (ID: %d) has high churn risk (%.2f) but their preferred categories %v are out of stock.\n",
+			userData.Username, userData.UserID, userData.ChurnRisk, userData.PreferredCategoryIDs)
+		return false, 0
 	} else {
 		fmt.Printf("User %s (ID: %d) does not meet criteria for a re-engagement offer (Churn Risk: %.2f).\n",
 			userData.Username, userData.UserID, userData.ChurnRisk)
-		return false, ""
+		return false, 0
 	}
 }
 
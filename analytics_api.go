@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// UserAnalyticsHandler returns a user's profile data, streak and recent streak predictions
+func UserAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData, ok := userDataFromPath(w, r)
+	if !ok {
+		return
+	}
+	streak, err := store.GetUserStreak(userData.UserID)
+	if err != nil {
+		log.Printf("Error getting streak for user %d: %v", userData.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	predictions, err := store.GetStreakPredictions(userData.UserID, 10)
+	if err != nil {
+		log.Printf("Error getting streak predictions for user %d: %v", userData.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":        userData,
+		"streak":      streak,
+		"predictions": predictions,
+	})
+}
+
+// PredictStreakHandler runs the active streak model for a user and stores the prediction
+func PredictStreakHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	model := currentStreakModel()
+	if model == nil {
+		http.Error(w, "No model has been trained yet, call /api/models/train first", http.StatusConflict)
+		return
+	}
+	userData, ok := userDataFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	prediction, err := model.PredictStreakDrop(userData.UserID, userData)
+	if err != nil {
+		log.Printf("Error predicting streak drop for user %d: %v", userData.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prediction)
+}
+
+// userDataFromPath loads the UserData for the {id} path value, writing 400/404 on failure
+func userDataFromPath(w http.ResponseWriter, r *http.Request) (*UserData, bool) {
+	user, ok := userFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+	userData, err := store.GetUserData(user.UserID)
+	if err != nil {
+		log.Printf("Error getting user data for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return userData, true
+}
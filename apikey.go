@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix marks API keys so the auth middleware can tell them apart from JWTs
+// (which always start with "eyJ") and secret scanners can recognise leaked keys
+const apiKeyPrefix = "tic_"
+
+// apiKeyTouchInterval limits how often last_used_at is written for a busy key
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyScopes are the permissions an API key may be granted. Account and key
+// management stay with logged-in admins.
+var apiKeyScopes = []string{
+	PermActivitiesWrite,
+	PermPredictionsRead,
+	PermAnalyticsRead,
+	PermOffersRead,
+	PermOffersWrite,
+	PermModelsRead,
+	PermOrdersWrite,
+}
+
+// newAPIKey returns a new random API key and the prefix shown in key listings
+func newAPIKey() (key, prefix string, err error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + token
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
+
+// normalizeScopes validates a scope list and removes duplicates
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		valid := false
+		for _, s := range apiKeyScopes {
+			if s == scope {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown scope %q (allowed: %s)", scope, strings.Join(apiKeyScopes, ", "))
+		}
+		seen[scope] = true
+	}
+	normalized := make([]string, 0, len(seen))
+	for scope := range seen {
+		normalized = append(normalized, scope)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// authenticateAPIKey resolves an API key to the AuthUser it acts as
+func authenticateAPIKey(key string) (*AuthUser, error) {
+	apiKey, err := store.GetAPIKeyByHash(hashOpaqueToken(key))
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || apiKey.RevokedAt != nil {
+		return nil, fmt.Errorf("unknown or revoked API key")
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := store.TouchAPIKey(apiKey.KeyID, now); err != nil {
+			log.Printf("Error recording use of API key %d: %v", apiKey.KeyID, err)
+		}
+	}
+	return &AuthUser{APIKeyID: apiKey.KeyID, Scopes: apiKey.Scopes}, nil
+}
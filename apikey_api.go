@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListAPIKeysHandler lists all API keys (without their secret values)
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	keys, err := store.ListAPIKeys()
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []APIKey{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKeyHandler creates a scoped API key. The key itself is only returned in
+// this response; afterwards only its hash is stored.
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		http.Error(w, "name is required (max 100 characters)", http.StatusBadRequest)
+		return
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value, prefix, err := newAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	key := APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hashOpaqueToken(value),
+		Scopes:    scopes,
+		CreatedBy: admin.UserID,
+		CreatedAt: time.Now(),
+	}
+	key.KeyID, err = store.CreateAPIKey(key)
+	if err != nil {
+		log.Printf("Error saving API key: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Admin %d created API key %d (%s) with scopes %v", admin.UserID, key.KeyID, key.Name, key.Scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_key": value,
+		"key":     key,
+		"message": "Store this key now, it won't be shown again",
+	})
+}
+
+// RevokeAPIKeyHandler revokes an API key; requests using it are rejected immediately
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	keyID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || keyID <= 0 {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := store.RevokeAPIKey(keyID, time.Now())
+	if err != nil {
+		log.Printf("Error revoking API key %d: %v", keyID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "API key not found or already revoked", http.StatusNotFound)
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	log.Printf("Admin %d revoked API key %d", admin.UserID, keyID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "API key revoked",
+		"key_id":  keyID,
+	})
+}
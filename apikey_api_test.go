@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// createTestAPIKey creates a key through CreateAPIKeyHandler and returns its value and ID
+func createTestAPIKey(t *testing.T, admin *User, scopes ...string) (string, int) {
+	t.Helper()
+	rec := serveAs(CreateAPIKeyHandler, newJSONRequest(t, http.MethodPost, "/api/admin/api-keys",
+		CreateAPIKeyRequest{Name: "crm", Scopes: scopes}), callerFor(admin))
+	var resp struct {
+		APIKey string `json:"api_key"`
+		Key    APIKey `json:"key"`
+	}
+	if rec.Code != http.StatusCreated || json.NewDecoder(rec.Body).Decode(&resp) != nil {
+		t.Fatalf("creating API key: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	return resp.APIKey, resp.Key.KeyID
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    []string
+		wantErr bool
+	}{
+		{"sorted without duplicates", []string{PermPredictionsRead, PermActivitiesWrite, PermPredictionsRead},
+			[]string{PermActivitiesWrite, PermPredictionsRead}, false},
+		{"empty", nil, nil, true},
+		{"unknown scope", []string{"offers:delete"}, nil, true},
+		{"admin-only permission", []string{PermUsersManage}, nil, true},
+		{"key management", []string{PermAPIKeysManage}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeScopes(tt.scopes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeScopes(%v) error %v, want error %t", tt.scopes, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("normalizeScopes(%v) = %v, want %v", tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	useMemoryStore(t)
+	admin := createTestUser(t, "admin", "unused")
+	key, keyID := createTestAPIKey(t, admin, PermPredictionsRead)
+
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	serve := func(handler http.Handler, header, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		header  string
+		value   string
+		want    int
+	}{
+		{"bearer", RequirePermission(PermPredictionsRead, ok), "Authorization", "Bearer " + key, http.StatusOK},
+		{"X-API-Key", RequirePermission(PermPredictionsRead, ok), "X-API-Key", key, http.StatusOK},
+		{"missing scope", RequirePermission(PermOffersWrite, ok), "X-API-Key", key, http.StatusForbidden},
+		{"user-only route", RequireUser(ok), "Authorization", "Bearer " + key, http.StatusForbidden},
+		{"unknown key", RequirePermission(PermPredictionsRead, ok), "X-API-Key", key + "x", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := serve(tt.handler, tt.header, tt.value); code != tt.want {
+				t.Errorf("status %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	// A revoked key is rejected on the very next request
+	rec := serveWithID(t, RevokeAPIKeyHandler, http.MethodDelete, keyID, nil, callerFor(admin))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoking: status %d, want 200", rec.Code)
+	}
+	if code := serve(RequirePermission(PermPredictionsRead, ok), "X-API-Key", key); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", code)
+	}
+	rec = serveWithID(t, RevokeAPIKeyHandler, http.MethodDelete, keyID, nil, callerFor(admin))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("revoking twice: status %d, want 404", rec.Code)
+	}
+}
+
+func TestAuthenticateAPIKeyTouchesLastUsed(t *testing.T) {
+	memory := useMemoryStore(t)
+	admin := createTestUser(t, "admin", "unused")
+	key, _ := createTestAPIKey(t, admin, PermActivitiesWrite)
+
+	lastUsed := func() *time.Time {
+		t.Helper()
+		apiKey, err := store.GetAPIKeyByHash(hashOpaqueToken(key))
+		if err != nil || apiKey == nil {
+			t.Fatalf("GetAPIKeyByHash: %v", err)
+		}
+		return apiKey.LastUsedAt
+	}
+	authenticate := func() {
+		t.Helper()
+		caller, err := authenticateAPIKey(key)
+		if err != nil || !caller.IsAPIKey() || !slices.Equal(caller.Scopes, []string{PermActivitiesWrite}) {
+			t.Fatalf("authenticateAPIKey: %+v, %v", caller, err)
+		}
+	}
+
+	if lastUsed() != nil {
+		t.Fatal("a new key has last_used_at set")
+	}
+	authenticate()
+	first := lastUsed()
+	if first == nil {
+		t.Fatal("the first use didn't set last_used_at")
+	}
+	authenticate()
+	if second := lastUsed(); !second.Equal(*first) {
+		t.Errorf("last_used_at rewritten %s after the first use", second.Sub(*first))
+	}
+
+	// Once the interval has passed the next use is recorded again
+	memory.mu.Lock()
+	backdated := first.Add(-apiKeyTouchInterval)
+	memory.apiKeys[0].LastUsedAt = &backdated
+	memory.mu.Unlock()
+	authenticate()
+	if third := lastUsed(); !third.After(backdated) {
+		t.Errorf("last_used_at %s not updated after the interval", third)
+	}
+}
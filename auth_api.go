@@ -5,6 +5,7 @@ import (
 
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -22,30 +23,135 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := GetUserByEmail(req.Email)
+	if req.Password == "" || (req.Email == "" && req.Username == "") {
+		http.Error(w, "Email or username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	// --- Brute-force protection: per-IP throttling ---
+	ip := clientIP(r)
+	if retryAfter, err := loginLimiter.CheckIP(ip); err != nil {
+		log.Printf("Error checking login throttle for IP %s: %v", ip, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if retryAfter > 0 {
+		tooManyRequests(w, retryAfter)
+		return
+	}
+
+	user, err := findUserForLogin(req)
 	if err != nil {
-		log.Printf("Error retrieving user by email: %v", err)
+		log.Printf("Error retrieving user for login: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	if user == nil {
+		VerifyDummyPassword(req.Password)
+		recordLoginFailure(ip, 0)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// --- Password Verification (In real app, use bcrypt.CompareHashAndPassword) ---
-	if user.PasswordHash != req.Password { // Simple comparison for demonstration
+	// --- Brute-force protection: per-account lockout ---
+	if retryAfter, err := loginLimiter.CheckAccount(user.UserID); err != nil {
+		log.Printf("Error checking login lockout for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if retryAfter > 0 {
+		tooManyRequests(w, retryAfter)
+		return
+	}
+
+	// --- Password Verification ---
+	ok, needsRehash, err := VerifyPassword(user.PasswordHash, req.Password)
+	if err != nil {
+		log.Printf("Error verifying password for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordLoginFailure(ip, user.UserID)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
+	// Upgrade legacy plain-text or weak hashes now that we know the password
+	if needsRehash {
+		newHash, err := HashPassword(req.Password)
+		if err == nil {
+			err = store.UpdateUserPasswordHash(user.UserID, newHash)
+		}
+		if err != nil {
+			log.Printf("Error upgrading password hash for user %d: %v", user.UserID, err)
+			// Not critical, the old hash still works until the next login
+		}
+	}
+
+	// --- Two-Factor Authentication ---
+	if startMFAChallenge(w, user) {
+		return
+	}
+
+	completeLogin(w, user)
+}
+
+// startMFAChallenge answers with a short-lived challenge token instead of a session when
+// the account has TOTP enabled; the session is issued by MFALoginHandler once the code is
+// verified. It returns true when it has written the response.
+func startMFAChallenge(w http.ResponseWriter, user *User) bool {
+	mfa, err := store.GetUserMFA(user.UserID)
+	if err != nil {
+		log.Printf("Error retrieving MFA settings for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	if mfa == nil || mfa.EnabledAt == nil {
+		return false
+	}
+
+	challenge, _, err := tokenIssuer.IssueMFAChallenge(user.UserID)
+	if err != nil {
+		log.Printf("Error issuing MFA challenge for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{
+		UserID:      user.UserID,
+		Username:    user.Username,
+		MFARequired: true,
+		MFAToken:    challenge,
+		Message:     "Two-factor authentication code required",
+		Success:     true,
+	})
+	return true
+}
+
+// completeLogin issues a session for a fully authenticated user and writes the login response
+func completeLogin(w http.ResponseWriter, user *User) {
+	if err := loginLimiter.ResetAccount(user.UserID); err != nil {
+		log.Printf("Error resetting login attempts for user %d: %v", user.UserID, err)
+	}
+
 	// --- Login Successful ---
+	session, err := issueSession(user, "")
+	if err != nil {
+		log.Printf("Error issuing session for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	response := LoginResponse{
-		UserID:   user.UserID,
-		Username: user.Username,
-		Token:    "dummy_jwt_token", // In a real app, generate a JWT
-		Message:  "Login successful",
+		UserID:       user.UserID,
+		Username:     user.Username,
+		Token:        session.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    session.ExpiresIn,
+		RefreshToken: session.RefreshToken,
+		Roles:        session.Roles,
+		Message:      "Login successful",
+		Success:      true,
 	}
 
 	// --- Streak Check & Offer Notification Logic ---
@@ -57,14 +163,25 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		// are marked as high churn risk in user_preferences.
 
 		// Let's use the churn risk logic directly here for user_b
-		userData, err := GetUserData(user.UserID)
+		userData, err := store.GetUserData(user.UserID)
+		stocked, stockErr := stockedCategories()
 		if err != nil {
 			log.Printf("Error getting user data for streak check: %v", err)
 			// Proceed without offer if data retrieval fails
+		} else if stockErr != nil {
+			log.Printf("Error getting stocked categories for streak check: %v", stockErr)
+		} else if userData.SerialReturner, err = serialReturner(user.UserID); err != nil {
+			log.Printf("Error getting refund rate for streak check: %v", err)
 		} else {
-			shouldOffer, targetCategory := AssessUserForOffer(userData) // Reuse the AI assessment logic
+			shouldOffer, targetCategoryID := AssessUserForOffer(userData, stocked) // Reuse the AI assessment logic
 			if shouldOffer {
 				offerValue := "25% giảm giá"
+				targetCategory := ""
+				if category, err := store.GetCategoryByID(targetCategoryID); err != nil {
+					log.Printf("Error getting category %d for offer: %v", targetCategoryID, err)
+				} else if category != nil {
+					targetCategory = category.LocalizedName(defaultLocale)
+				}
 				// Generate personalized message for the offer
 				personalizedMessage, err := GeneratePersonalizedMessageWithLLM(
 					user.Username,
@@ -81,21 +198,22 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 					UserID:           user.UserID,
 					OfferType:        "Discount",
 					OfferValue:       offerValue,
-					TargetCategory:   targetCategory,
+					TargetCategoryID: targetCategoryID,
 					GeneratedMessage: personalizedMessage,
 					SentDate:         time.Now(),
 					IsUsed:           false,
 				}
-				saveErr := SaveOffer(offerToSave)
+				savedOffer, saveErr := issueOffer(offerToSave)
 				if saveErr != nil {
 					log.Printf("Error saving offer for user %s: %v", user.Email, saveErr)
 				} else {
 					// Prepare push notification for frontend
 					// In a real system, this would trigger an actual push notification service (e.g., Firebase Cloud Messaging)
 					response.OfferNotification = &OfferNotification{
-						Title:   "Ưu đãi đặc biệt dành cho bạn! 🎉",
-						Message: personalizedMessage,
-						OfferID: 0, // In real app, get actual offer ID after saving
+						Title:      "Ưu đãi đặc biệt dành cho bạn! 🎉",
+						Message:    personalizedMessage,
+						OfferID:    savedOffer.OfferID,
+						CouponCode: savedOffer.CouponCode,
 					}
 					log.Printf("Push notification prepared for %s: %s", user.Email, personalizedMessage)
 				}
@@ -104,7 +222,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update last login time
-	err = UpdateUserLastLogin(user.UserID, time.Now())
+	err = store.UpdateUserLastLogin(user.UserID, time.Now())
 	if err != nil {
 		log.Printf("Error updating last login for user %d: %v", user.UserID, err)
 		// This is not a critical error, so we proceed with login response
@@ -113,3 +231,49 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// recordLoginFailure counts a failed login against the client IP and, when the
+// account exists (userID > 0), against the account
+func recordLoginFailure(ip string, userID int) {
+	if err := loginLimiter.FailIP(ip); err != nil {
+		log.Printf("Error recording failed login for IP %s: %v", ip, err)
+	}
+	if userID > 0 {
+		if err := loginLimiter.FailAccount(userID); err != nil {
+			log.Printf("Error recording failed login for user %d: %v", userID, err)
+		}
+	}
+	log.Printf("Failed login attempt from %s (user ID: %d)", ip, userID)
+}
+
+// findUserForLogin looks up the account by email, or by username when no email is given.
+// A username containing "@" is treated as an email so either identifier can go in one login field.
+func findUserForLogin(req LoginRequest) (*User, error) {
+	identifier := strings.TrimSpace(req.Email)
+	if identifier == "" {
+		identifier = strings.TrimSpace(req.Username)
+	}
+	if strings.Contains(identifier, "@") {
+		return store.GetUserByEmail(identifier)
+	}
+	return store.GetUserByUsername(identifier)
+}
+
+// MeHandler returns the profile of the authenticated user
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authUser, _ := AuthUserFromContext(r.Context())
+	userData, err := store.GetUserData(authUser.UserID)
+	if err != nil {
+		log.Printf("Error getting user data for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userData)
+}
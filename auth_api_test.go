@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoginHandlerRehashesLegacyPasswords(t *testing.T) {
+	useMemoryStore(t)
+	weak, err := PasswordPolicy{Algorithm: PasswordAlgorithmBcrypt, BcryptCost: 4}.Hash("bcrypt pass")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	t.Setenv("BCRYPT_COST", "5")
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+	}{
+		{"plain text", "legacy pass", "legacy pass"},
+		{"bcrypt below the current cost", weak, "bcrypt pass"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, "legacy"+string(rune('a'+i)), tt.stored)
+
+			rec := postJSON(t, LoginHandler, "/api/login", LoginRequest{Username: user.Username, Password: tt.password})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+			}
+
+			updated, _ := store.GetUserByID(user.UserID)
+			if updated.PasswordHash == tt.stored || !strings.HasPrefix(updated.PasswordHash, "$2a$05$") {
+				t.Fatalf("password hash was not upgraded: %q", updated.PasswordHash)
+			}
+			ok, needsRehash, err := VerifyPassword(updated.PasswordHash, tt.password)
+			if err != nil || !ok || needsRehash {
+				t.Errorf("VerifyPassword(upgraded) = %t, %t, %v; want true, false, nil", ok, needsRehash, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// contextKey is the type for values this package stores in request contexts
+type contextKey string
+
+const authUserContextKey contextKey = "auth_user"
+
+// AuthUser is the authenticated caller injected into the request context by RequireAuth.
+// For a service calling with an API key, UserID is 0 and APIKeyID and Scopes are set.
+type AuthUser struct {
+	UserID   int
+	Roles    []string
+	APIKeyID int
+	Scopes   []string
+}
+
+// IsAPIKey reports whether the caller authenticated with an API key rather than a user token
+func (u *AuthUser) IsAPIKey() bool {
+	return u.APIKeyID != 0
+}
+
+// HasRole reports whether the caller has the given role
+func (u *AuthUser) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether any of the caller's roles, or the API key's scopes,
+// grants the permission
+func (u *AuthUser) HasPermission(permission string) bool {
+	if u.IsAPIKey() {
+		for _, scope := range u.Scopes {
+			if scope == permission {
+				return true
+			}
+		}
+		return false
+	}
+	return rolesGrant(u.Roles, permission)
+}
+
+// AuthUserFromContext returns the authenticated caller, if any
+func AuthUserFromContext(ctx context.Context) (*AuthUser, bool) {
+	user, ok := ctx.Value(authUserContextKey).(*AuthUser)
+	return user, ok
+}
+
+// RequireAuth validates the "Authorization: Bearer <token>" header and injects
+// the AuthUser into the request context. The bearer value may be a user access token
+// or a service API key (also accepted in the X-API-Key header). Requests without valid
+// credentials get 401.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := bearerToken(r)
+		if !ok {
+			tokenString = strings.TrimSpace(r.Header.Get("X-API-Key"))
+			if tokenString == "" {
+				unauthorized(w, "Missing bearer token")
+				return
+			}
+		}
+
+		var user *AuthUser
+		if strings.HasPrefix(tokenString, apiKeyPrefix) {
+			var err error
+			user, err = authenticateAPIKey(tokenString)
+			if err != nil {
+				log.Printf("Rejected API key: %v", err)
+				unauthorized(w, "Invalid or revoked API key")
+				return
+			}
+		} else {
+			claims, err := tokenIssuer.ParseToken(tokenString, TokenTypeAccess)
+			if err != nil {
+				log.Printf("Rejected access token: %v", err)
+				unauthorized(w, "Invalid or expired token")
+				return
+			}
+			user = &AuthUser{UserID: claims.UserID, Roles: claims.Roles}
+		}
+
+		ctx := context.WithValue(r.Context(), authUserContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireUser wraps RequireAuth and rejects API keys with 403, for endpoints that act
+// on the logged-in user's own account
+func RequireUser(next http.Handler) http.Handler {
+	return RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := AuthUserFromContext(r.Context())
+		if user.IsAPIKey() {
+			http.Error(w, "This endpoint requires a user login", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireRole wraps RequireAuth and additionally rejects callers without the role with 403
+func RequireRole(role string, next http.Handler) http.Handler {
+	return RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := AuthUserFromContext(r.Context())
+		if !user.HasRole(role) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequirePermission wraps RequireAuth and additionally rejects callers whose roles
+// don't grant the permission with 403
+func RequirePermission(permission string, next http.Handler) http.Handler {
+	return RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := AuthUserFromContext(r.Context())
+		if !user.HasPermission(permission) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// bearerToken extracts the token from the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// unauthorized writes a 401 with the WWW-Authenticate challenge required by RFC 6750
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAuth(t *testing.T) {
+	useMemoryStore(t)
+	access, _, err := tokenIssuer.IssueAccessToken(7, []string{RoleCustomer})
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	challenge, _, err := tokenIssuer.IssueMFAChallenge(7)
+	if err != nil {
+		t.Fatalf("IssueMFAChallenge: %v", err)
+	}
+
+	var caller *AuthUser
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, _ = AuthUserFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"valid token", "Bearer " + access, http.StatusOK},
+		{"lowercase scheme", "bearer " + access, http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"other scheme", "Basic " + access, http.StatusUnauthorized},
+		{"tampered token", "Bearer " + access + "x", http.StatusUnauthorized},
+		{"MFA challenge token", "Bearer " + challenge, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller = nil
+			req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && (caller == nil || caller.UserID != 7 || !caller.HasRole(RoleCustomer)) {
+				t.Errorf("caller %+v, want user 7 with the customer role", caller)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	useMemoryStore(t)
+	oldModel := streakModel
+	t.Cleanup(func() { streakModel = oldModel })
+
+	train := RequirePermission(PermModelsTrain, http.HandlerFunc(TrainModelHandler))
+	onlyAdmins := RequireRole(RoleAdmin, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	tests := []struct {
+		name      string
+		roles     []string
+		wantTrain int
+		wantAdmin int
+	}{
+		{"customer", []string{RoleCustomer}, http.StatusForbidden, http.StatusForbidden},
+		{"marketer", []string{RoleCustomer, RoleMarketer}, http.StatusForbidden, http.StatusForbidden},
+		{"analyst", []string{RoleCustomer, RoleAnalyst}, http.StatusOK, http.StatusForbidden},
+		{"admin", []string{RoleCustomer, RoleAdmin}, http.StatusOK, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, _, err := tokenIssuer.IssueAccessToken(7, tt.roles)
+			if err != nil {
+				t.Fatalf("IssueAccessToken: %v", err)
+			}
+			serve := func(handler http.Handler, method, path string) int {
+				req := httptest.NewRequest(method, path, nil)
+				req.Header.Set("Authorization", "Bearer "+access)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec.Code
+			}
+
+			if code := serve(train, http.MethodPost, "/api/models/train?samples=50"); code != tt.wantTrain {
+				t.Errorf("POST /api/models/train: status %d, want %d", code, tt.wantTrain)
+			}
+			if code := serve(onlyAdmins, http.MethodGet, "/api/mfa/totp"); code != tt.wantAdmin {
+				t.Errorf("admin-only route: status %d, want %d", code, tt.wantAdmin)
+			}
+		})
+	}
+}
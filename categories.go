@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLocale is the locale category names fall back to; every category has a name in it
+const defaultLocale = "vi"
+
+// supportedLocales are the locales category names are kept in
+var supportedLocales = []string{"vi", "en"}
+
+// defaultCategories returns the built-in taxonomy seeded by migration 14 and the memory store
+func defaultCategories() []Category {
+	fashion, footwear := 1, 4
+	return []Category{
+		{CategoryID: 1, Slug: "thoi-trang", Names: map[string]string{"vi": "Thời trang", "en": "Fashion"}},
+		{CategoryID: 2, Slug: "thoi-trang-nu", ParentID: &fashion, Names: map[string]string{"vi": "Thời trang nữ", "en": "Women's fashion"}},
+		{CategoryID: 3, Slug: "thoi-trang-nam", ParentID: &fashion, Names: map[string]string{"vi": "Thời trang nam", "en": "Men's fashion"}},
+		{CategoryID: 4, Slug: "giay-dep", Names: map[string]string{"vi": "Giày dép", "en": "Footwear"}},
+		{CategoryID: 5, Slug: "giay-dep-nu", ParentID: &footwear, Names: map[string]string{"vi": "Giày dép nữ", "en": "Women's footwear"}},
+		{CategoryID: 6, Slug: "dien-tu", Names: map[string]string{"vi": "Điện tử", "en": "Electronics"}},
+	}
+}
+
+// LocalizedName returns the category name in locale, falling back to defaultLocale
+func (c Category) LocalizedName(locale string) string {
+	if name, ok := c.Names[locale]; ok && name != "" {
+		return name
+	}
+	return c.Names[defaultLocale]
+}
+
+// categorySlug derives a URL-safe slug from a category name ("Điện tử" -> "dien-tu")
+func categorySlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range foldVietnamese(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// buildCategoryTree nests a flat category list under its parents, ordered by ID,
+// with Name set for locale
+func buildCategoryTree(categories []Category, locale string) []*Category {
+	nodes := make(map[int]*Category, len(categories))
+	for _, c := range categories {
+		c := c
+		c.Name = c.LocalizedName(locale)
+		c.Children = nil
+		nodes[c.CategoryID] = &c
+	}
+
+	ids := make([]int, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var roots []*Category
+	for _, id := range ids {
+		node := nodes[id]
+		if node.ParentID != nil {
+			if parent, ok := nodes[*node.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// categoryWithDescendants returns rootID and the IDs of every category below it
+func categoryWithDescendants(categories []Category, rootID int) []int {
+	children := make(map[int][]int)
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.CategoryID)
+		}
+	}
+
+	ids := []int{rootID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// findCategory looks a category up by ID or slug in a category list
+func findCategory(categories []Category, value string) *Category {
+	id, err := strconv.Atoi(value)
+	for i, c := range categories {
+		if (err == nil && c.CategoryID == id) || (err != nil && c.Slug == value) {
+			return &categories[i]
+		}
+	}
+	return nil
+}
+
+// categoryPath returns the breadcrumb from the top-level category down to categoryID,
+// named in locale
+func categoryPath(categories []Category, categoryID int, locale string) []CategoryRef {
+	byID := make(map[int]Category, len(categories))
+	for _, c := range categories {
+		byID[c.CategoryID] = c
+	}
+
+	var path []CategoryRef
+	for id := categoryID; len(path) <= len(categories); { // the length check stops a parent cycle
+		c, ok := byID[id]
+		if !ok {
+			break
+		}
+		path = append([]CategoryRef{{CategoryID: c.CategoryID, Slug: c.Slug, Name: c.LocalizedName(locale)}}, path...)
+		if c.ParentID == nil {
+			break
+		}
+		id = *c.ParentID
+	}
+	return path
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildCategoryTree(t *testing.T) {
+	categories := defaultCategories()
+	// A subcategory without an English name, listed before its parent
+	fashion := 1
+	categories = append([]Category{{CategoryID: 7, Slug: "phu-kien", ParentID: &fashion,
+		Names: map[string]string{"vi": "Phụ kiện"}}}, categories...)
+
+	tree := buildCategoryTree(categories, "en")
+	type node struct {
+		ID       int
+		Name     string
+		Children []node
+	}
+	var shape func([]*Category) []node
+	shape = func(categories []*Category) []node {
+		var nodes []node
+		for _, c := range categories {
+			nodes = append(nodes, node{c.CategoryID, c.Name, shape(c.Children)})
+		}
+		return nodes
+	}
+	want := []node{
+		{1, "Fashion", []node{{2, "Women's fashion", nil}, {3, "Men's fashion", nil}, {7, "Phụ kiện", nil}}},
+		{4, "Footwear", []node{{5, "Women's footwear", nil}}},
+		{6, "Electronics", nil},
+	}
+	if got := shape(tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree %+v, want %+v", got, want)
+	}
+}
+
+func TestCategoryWithDescendants(t *testing.T) {
+	categories := defaultCategories()
+	men := 3
+	categories = append(categories, Category{CategoryID: 7, Slug: "ao-nam", ParentID: &men})
+
+	tests := []struct {
+		rootID int
+		want   []int
+	}{
+		{1, []int{1, 2, 3, 7}}, // grandchildren are included
+		{3, []int{3, 7}},
+		{6, []int{6}},
+	}
+	for _, tt := range tests {
+		if got := categoryWithDescendants(categories, tt.rootID); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("categoryWithDescendants(%d) = %v, want %v", tt.rootID, got, tt.want)
+		}
+	}
+}
+
+func TestCategoryPath(t *testing.T) {
+	categories := defaultCategories()
+	want := []CategoryRef{
+		{CategoryID: 4, Slug: "giay-dep", Name: "Footwear"},
+		{CategoryID: 5, Slug: "giay-dep-nu", Name: "Women's footwear"},
+	}
+	if got := categoryPath(categories, 5, "en"); !reflect.DeepEqual(got, want) {
+		t.Errorf("categoryPath(5) = %+v, want %+v", got, want)
+	}
+	if got := categoryPath(categories, 99, "en"); got != nil {
+		t.Errorf("categoryPath(unknown) = %+v, want nil", got)
+	}
+
+	// A parent cycle ends instead of looping forever
+	a, b := 8, 9
+	cycle := []Category{{CategoryID: a, ParentID: &b}, {CategoryID: b, ParentID: &a}}
+	if got := categoryPath(cycle, a, "vi"); len(got) > len(cycle)+1 {
+		t.Errorf("categoryPath over a cycle returned %d entries", len(got))
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// GetCategoriesHandler returns the category tree (GET /api/categories). Names are
+// given in the locale from the lang query parameter or the Accept-Language header,
+// falling back to Vietnamese.
+func GetCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	locale, err := requestLocale(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	categories, err := store.GetCategories()
+	if err != nil {
+		log.Printf("Error getting categories: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	tree := buildCategoryTree(categories, locale)
+	if tree == nil {
+		tree = []*Category{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"locale":     locale,
+		"categories": tree,
+	})
+}
+
+// requestLocale picks the response locale: an explicit ?lang= must be supported,
+// while Accept-Language falls back to defaultLocale when nothing matches
+func requestLocale(r *http.Request) (string, error) {
+	if lang := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("lang"))); lang != "" {
+		for _, locale := range supportedLocales {
+			if lang == locale {
+				return locale, nil
+			}
+		}
+		return "", fmt.Errorf("lang must be one of %s", strings.Join(supportedLocales, ", "))
+	}
+
+	// Accept-Language is usually already ordered by preference ("en-US,en;q=0.9,vi;q=0.8")
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		tag = strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		for _, locale := range supportedLocales {
+			if tag == locale {
+				return locale, nil
+			}
+		}
+	}
+	return defaultLocale, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		name           string
+		lang           string
+		acceptLanguage string
+		want           string
+		wantErr        bool
+	}{
+		{"default", "", "", "vi", false},
+		{"lang", "en", "vi", "en", false},
+		{"lang in upper case", " EN ", "", "en", false},
+		{"unsupported lang", "fr", "en", "", true},
+		{"Accept-Language with a region", "", "en-US,en;q=0.9", "en", false},
+		{"first supported Accept-Language", "", "fr-FR, de;q=0.9, vi;q=0.8, en;q=0.7", "vi", false},
+		{"unsupported Accept-Language", "", "fr-FR, de", "vi", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/categories", nil)
+			if tt.lang != "" {
+				q := r.URL.Query()
+				q.Set("lang", tt.lang)
+				r.URL.RawQuery = q.Encode()
+			}
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+
+			got, err := requestLocale(r)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("requestLocale = %q, %v; want %q, error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetCategoriesHandler(t *testing.T) {
+	useMemoryStore(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptLanguage string
+		wantLocale     string
+		wantFirst      string
+	}{
+		{"default", "/api/categories", "", "vi", "Thời trang"},
+		{"Accept-Language", "/api/categories", "en-GB,en;q=0.8", "en", "Fashion"},
+		{"unsupported Accept-Language", "/api/categories", "ja", "vi", "Thời trang"},
+		{"lang over Accept-Language", "/api/categories?lang=vi", "en", "vi", "Thời trang"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			rec := httptest.NewRecorder()
+			GetCategoriesHandler(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200", rec.Code)
+			}
+			var resp struct {
+				Locale     string      `json:"locale"`
+				Categories []*Category `json:"categories"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding categories: %v", err)
+			}
+			if resp.Locale != tt.wantLocale || len(resp.Categories) != 3 || resp.Categories[0].Name != tt.wantFirst {
+				t.Fatalf("locale %q with %d top-level categories, want %q with 3 starting at %q", resp.Locale, len(resp.Categories), tt.wantLocale, tt.wantFirst)
+			}
+			if children := resp.Categories[0].Children; len(children) != 2 || children[0].CategoryID != 2 || children[1].CategoryID != 3 {
+				t.Errorf("children of %q: %+v, want categories 2 and 3", resp.Categories[0].Name, children)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	GetCategoriesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/categories?lang=fr", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unsupported lang: status %d, want 400", rec.Code)
+	}
+}
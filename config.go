@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// envDuration returns the duration in the environment variable name, or def if it is
+// unset. Anything but a positive Go duration ("90m", "336h") is an error, so a typo
+// stops the server at startup instead of quietly running with the default.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: want a positive duration such as 90m or 336h", name, v)
+	}
+	return d, nil
+}
+
+// loadDurations reads PASSWORD_RESET_TTL, OFFER_TTL and STOCK_RESERVATION_TTL
+func loadDurations() error {
+	var err error
+	if passwordResetTTL, err = envDuration("PASSWORD_RESET_TTL", defaultPasswordResetTTL); err != nil {
+		return err
+	}
+	if offerTTL, err = envDuration("OFFER_TTL", defaultOfferTTL); err != nil {
+		return err
+	}
+	if stockReservationTTL, err = envDuration("STOCK_RESERVATION_TTL", defaultStockReservationTTL); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"336h", 14 * 24 * time.Hour, false},
+		{"30d", 0, true},
+		{"15", 0, true},
+		{"0s", 0, true},
+		{"-1h", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TEST_TTL", tt.value)
+			got, err := envDuration("TEST_TTL", time.Hour)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("envDuration(%q) = %s, %v; want %s, error %t", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDurations(t *testing.T) {
+	t.Cleanup(func() {
+		passwordResetTTL, offerTTL, stockReservationTTL = defaultPasswordResetTTL, defaultOfferTTL, defaultStockReservationTTL
+	})
+
+	t.Setenv("OFFER_TTL", "72h")
+	if err := loadDurations(); err != nil || offerTTL != 72*time.Hour || passwordResetTTL != defaultPasswordResetTTL {
+		t.Fatalf("loadDurations = %v with OFFER_TTL %s, PASSWORD_RESET_TTL %s; want 72h and the default", err, offerTTL, passwordResetTTL)
+	}
+	t.Setenv("STOCK_RESERVATION_TTL", "30d")
+	if err := loadDurations(); err == nil {
+		t.Error("loadDurations accepted STOCK_RESERVATION_TTL=30d")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// couponCodePrefix starts every coupon code, so support staff recognise one
+	couponCodePrefix = "TIC"
+	// defaultOfferTTL is how long an offer can be redeemed after it is sent
+	defaultOfferTTL = 14 * 24 * time.Hour
+)
+
+// couponEncoding is unpadded base32, whose alphabet (A-Z, 2-7) has no 0 or 1 to mistake
+// for O or I when a code is read out or typed
+var couponEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// offerTTL is OFFER_TTL, read at startup by loadDurations
+var offerTTL = defaultOfferTTL
+
+// newCouponCode returns a random coupon code like TIC-7KQM-3XWA-PL5D-J2RT, carrying 80
+// random bits so codes can't be guessed
+func newCouponCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating coupon code: %w", err)
+	}
+	c := couponEncoding.EncodeToString(b)
+	return couponCodePrefix + "-" + c[0:4] + "-" + c[4:8] + "-" + c[8:12] + "-" + c[12:16], nil
+}
+
+// normalizeCouponCode turns a coupon code as typed by the user (any case, with or
+// without dashes and spaces) into its stored form, or "" if it can't be one
+func normalizeCouponCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != len(couponCodePrefix)+16 || !strings.HasPrefix(code, couponCodePrefix) {
+		return ""
+	}
+	c := code[len(couponCodePrefix):]
+	return couponCodePrefix + "-" + c[0:4] + "-" + c[4:8] + "-" + c[8:12] + "-" + c[12:16]
+}
+
+// issueOffer gives an offer its coupon code and expiry and saves it
+func issueOffer(offer Offer) (*Offer, error) {
+	code, err := newCouponCode()
+	if err != nil {
+		return nil, err
+	}
+	offer.CouponCode = code
+	offer.ExpiresAt = offer.SentDate.Add(offerTTL)
+	offer.OfferID, err = store.SaveOffer(offer)
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
@@ -3,13 +3,16 @@ package main
 import (
 	"database/sql"
 	"encoding/json" // Added for JSON handling
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	//"math/rand" // Added for random activity generation
+	"sort"
 	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql" // MySQL driver
+	"github.com/go-sql-driver/mysql" // MySQL driver
 )
 
 // InitDB initializes the MySQL database connection and creates tables if they don't exist
@@ -118,12 +121,21 @@ import (
 //	fmt.Println("Database tables checked/created successfully.")
 //}
 
-// CloseDB closes the database connection
-func CloseDB() {
-	if db != nil {
-		db.Close()
+// MySQLStore is the Store implementation backed by a MySQL database
+type MySQLStore struct {
+	db *sql.DB
+}
+
+// Close closes the database connection
+func (s *MySQLStore) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	if err == nil {
 		fmt.Println("Database connection closed.")
 	}
+	return err
 }
 
 //// InsertSampleData inserts sample data into the database
@@ -240,15 +252,16 @@ func CloseDB() {
 //}
 
 // GetUserData fetches all relevant data for a given user
-func GetUserData(userID int) (*UserData, error) {
+func (s *MySQLStore) GetUserData(userID int) (*UserData, error) {
 	userData := &UserData{
 		User: User{UserID: userID},
 	}
 
 	// Get basic user info
 	var lastLogin sql.NullTime // Use sql.NullTime for nullable DATETIME fields
-	err := db.QueryRow("SELECT username, email, last_login FROM users WHERE user_id = ?", userID).Scan(
-		&userData.Username, &userData.Email, &lastLogin,
+	var roles sql.NullString
+	err := s.db.QueryRow("SELECT username, email, last_login, registered_date, "+userRolesColumn+" FROM users WHERE user_id = ?", userID).Scan(
+		&userData.Username, &userData.Email, &lastLogin, &userData.RegisteredDate, &roles,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("user with ID %d not found", userID)
@@ -258,48 +271,35 @@ func GetUserData(userID int) (*UserData, error) {
 	if lastLogin.Valid {
 		userData.LastLogin = &lastLogin.Time
 	}
+	userData.Roles = splitRoles(roles)
 
-	// Get recent orders
-	rows, err := db.Query(`
-        SELECT o.order_date, p.category, p.product_name
-        FROM orders o
-        JOIN products p ON o.product_id = p.product_id
-        WHERE o.user_id = ?
-        ORDER BY o.order_date DESC
-        LIMIT 5
-    `, userID)
+	// Get recent orders with their items
+	userData.RecentOrders, err = s.queryOrders("SELECT "+orderSelectColumns+" FROM orders WHERE user_id = ? ORDER BY order_date DESC, order_id DESC LIMIT 5", userID)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching recent orders: %w", err)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var orderDate time.Time
-		var category, productName string
-		if err := rows.Scan(&orderDate, &category, &productName); err != nil {
-			log.Printf("Error scanning recent order: %v", err)
-			continue
-		}
-		userData.RecentOrders = append(userData.RecentOrders, struct {
-			OrderDate   time.Time
-			Category    string
-			ProductName string
-		}{OrderDate: orderDate, Category: category, ProductName: productName})
-	}
 
 	// Get user preferences (churn risk and preferred categories from AI)
-	var preferredCategoriesStr sql.NullString
 	var churnRisk sql.NullFloat64
-	err = db.QueryRow("SELECT preferred_categories, churn_risk FROM user_preferences WHERE user_id = ?", userID).Scan(
-		&preferredCategoriesStr, &churnRisk,
-	)
+	err = s.db.QueryRow("SELECT churn_risk FROM user_preferences WHERE user_id = ?", userID).Scan(&churnRisk)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("error fetching user preferences: %w", err)
 	}
 
-	if preferredCategoriesStr.Valid {
-		userData.PreferredCategories = strings.Split(preferredCategoriesStr.String, ",")
+	categoryRows, err := s.db.Query("SELECT category_id FROM user_preferred_categories WHERE user_id = ? ORDER BY position", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching preferred categories: %w", err)
+	}
+	defer categoryRows.Close()
+	for categoryRows.Next() {
+		var categoryID int
+		if err := categoryRows.Scan(&categoryID); err != nil {
+			log.Printf("Error scanning preferred category: %v", err)
+			continue
+		}
+		userData.PreferredCategoryIDs = append(userData.PreferredCategoryIDs, categoryID)
 	}
+
 	if churnRisk.Valid {
 		userData.ChurnRisk = churnRisk.Float64
 	}
@@ -308,21 +308,51 @@ func GetUserData(userID int) (*UserData, error) {
 }
 
 // SaveOffer saves the generated offer to the database
-func SaveOffer(offer Offer) error {
-	_, err := db.Exec(
-		"INSERT INTO offers (user_id, offer_type, offer_value, target_category, generated_message, sent_date, is_used) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		offer.UserID, offer.OfferType, offer.OfferValue, offer.TargetCategory, offer.GeneratedMessage, offer.SentDate, offer.IsUsed,
+func (s *MySQLStore) SaveOffer(offer Offer) (int, error) {
+	result, err := s.db.Exec(
+		"INSERT INTO offers (user_id, coupon_code, offer_type, offer_value, target_category_id, generated_message, sent_date, expires_at, is_used) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		offer.UserID, offer.CouponCode, offer.OfferType, offer.OfferValue, nullableCategoryID(offer.TargetCategoryID), offer.GeneratedMessage, offer.SentDate, offer.ExpiresAt, offer.IsUsed,
 	)
 	if err != nil {
-		return fmt.Errorf("error saving offer: %w", err)
+		return 0, fmt.Errorf("error saving offer: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading new offer id: %w", err)
 	}
 	fmt.Printf("Offer saved for User ID: %d\n", offer.UserID)
-	return nil
+	return int(id), nil
+}
+
+// offerSelectColumns is the column list scanned by scanOffer
+const offerSelectColumns = "offer_id, user_id, coupon_code, offer_type, offer_value, target_category_id, generated_message, sent_date, expires_at, is_used, used_at, order_id"
+
+// scanOffer scans a row selected with offerSelectColumns
+func scanOffer(row rowScanner) (*Offer, error) {
+	var offer Offer
+	var targetCategoryID, orderID sql.NullInt64
+	var usedAt sql.NullTime
+	err := row.Scan(
+		&offer.OfferID, &offer.UserID, &offer.CouponCode, &offer.OfferType, &offer.OfferValue,
+		&targetCategoryID, &offer.GeneratedMessage, &offer.SentDate, &offer.ExpiresAt, &offer.IsUsed, &usedAt, &orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	offer.TargetCategoryID = int(targetCategoryID.Int64)
+	if usedAt.Valid {
+		offer.UsedAt = &usedAt.Time
+	}
+	if orderID.Valid {
+		id := int(orderID.Int64)
+		offer.OrderID = &id
+	}
+	return &offer, nil
 }
 
 // GetSavedOffers retrieves offers saved for a specific user (for verification)
-func GetSavedOffers(userID int) ([]Offer, error) {
-	rows, err := db.Query("SELECT offer_id, user_id, offer_type, offer_value, target_category, generated_message, sent_date, is_used FROM offers WHERE user_id = ?", userID)
+func (s *MySQLStore) GetSavedOffers(userID int) ([]Offer, error) {
+	rows, err := s.db.Query("SELECT "+offerSelectColumns+" FROM offers WHERE user_id = ?", userID)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching saved offers: %w", err)
 	}
@@ -330,24 +360,86 @@ func GetSavedOffers(userID int) ([]Offer, error) {
 
 	var offers []Offer
 	for rows.Next() {
-		var offer Offer
-		if err := rows.Scan(
-			&offer.OfferID, &offer.UserID, &offer.OfferType, &offer.OfferValue,
-			&offer.TargetCategory, &offer.GeneratedMessage, &offer.SentDate, &offer.IsUsed,
-		); err != nil {
+		offer, err := scanOffer(rows)
+		if err != nil {
 			log.Printf("Error scanning saved offer: %v", err)
 			continue
 		}
-		offers = append(offers, offer)
+		offers = append(offers, *offer)
 	}
 	return offers, nil
 }
 
+// GetOfferByID retrieves an offer
+func (s *MySQLStore) GetOfferByID(offerID int) (*Offer, error) {
+	offer, err := scanOffer(s.db.QueryRow("SELECT "+offerSelectColumns+" FROM offers WHERE offer_id = ?", offerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching offer: %w", err)
+	}
+	return offer, nil
+}
+
+// GetOfferByCouponCode retrieves the offer with a coupon code
+func (s *MySQLStore) GetOfferByCouponCode(code string) (*Offer, error) {
+	offer, err := scanOffer(s.db.QueryRow("SELECT "+offerSelectColumns+" FROM offers WHERE coupon_code = ?", code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching offer: %w", err)
+	}
+	return offer, nil
+}
+
+// RedeemOffer marks an offer used with a conditional UPDATE, so it can only be redeemed
+// once; the unique index on offers.order_id keeps an order to one offer
+func (s *MySQLStore) RedeemOffer(offerID, orderID int, usedAt time.Time) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	// Lock the order so a concurrent UpdateOrderStatus waits until the offer is recorded
+	// on it, and then releases it again if it cancels the order
+	var status string
+	err = tx.QueryRow("SELECT status FROM orders WHERE order_id = ? FOR UPDATE", orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return false, ErrOrderClosed
+	} else if err != nil {
+		return false, fmt.Errorf("error locking order: %w", err)
+	}
+	if status != OrderPending && status != OrderPaid {
+		return false, ErrOrderClosed
+	}
+
+	result, err := tx.Exec("UPDATE offers SET is_used = TRUE, used_at = ?, order_id = ? WHERE offer_id = ? AND is_used = FALSE AND expires_at > ?",
+		usedAt, orderID, offerID, usedAt)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 { // ER_DUP_ENTRY on uq_offers_order
+		return false, ErrOrderHasOffer
+	} else if err != nil {
+		return false, fmt.Errorf("error redeeming offer: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error reading redeemed offer count: %w", err)
+	}
+	if rows == 0 {
+		return false, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return true, nil
+}
+
 // ... (các hàm InitDB, CloseDB, InsertSampleData như cũ) ...
 
 // GetProducts fetches all products from the database
-func GetProducts() ([]Product, error) {
-	rows, err := db.Query("SELECT product_id, product_name, category, price FROM products")
+func (s *MySQLStore) GetProducts() ([]Product, error) {
+	rows, err := s.db.Query("SELECT "+productSelectColumns+" FROM products WHERE deleted_at IS NULL", time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("error querying products: %w", err)
 	}
@@ -355,344 +447,1983 @@ func GetProducts() ([]Product, error) {
 
 	var products []Product
 	for rows.Next() {
-		var p Product
-		if err := rows.Scan(&p.ProductID, &p.ProductName, &p.Category, &p.Price); err != nil {
+		p, err := scanProduct(rows)
+		if err != nil {
 			log.Printf("Error scanning product row: %v", err)
 			continue
 		}
-		products = append(products, p)
+		products = append(products, *p)
 	}
 	return products, nil
 }
 
-// GetUserStreak retrieves streak information for a user
-func GetUserStreak(userID int) (*UserStreak, error) {
-	streak := &UserStreak{UserID: userID}
-
-	err := db.QueryRow(`
-		SELECT current_streak, longest_streak, last_activity_date, streak_type, is_active
-		FROM user_streaks WHERE user_id = ?
-	`, userID).Scan(&streak.CurrentStreak, &streak.LongestStreak, &streak.LastActivityDate, &streak.StreakType, &streak.IsActive)
+// productReservedColumn sums a product's active, unexpired reservations, for queries FROM
+// products; its placeholder takes the current time
+const productReservedColumn = "(SELECT COALESCE(SUM(r.quantity), 0) FROM stock_reservations r WHERE r.product_id = products.product_id AND r.status = 'active' AND r.expires_at > ?)"
 
-	if err == sql.ErrNoRows {
-		return nil, nil // User has no streak data yet
-	} else if err != nil {
-		return nil, fmt.Errorf("error fetching user streak: %w", err)
-	}
+// productSelectColumns is the column list scanned by scanProduct
+const productSelectColumns = "product_id, product_name, category_id, price, updated_at, deleted_at, stock_quantity, low_stock_threshold, " +
+	productReservedColumn + " AS reserved_quantity"
 
-	return streak, nil
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-// UpdateUserStreak updates or creates streak data for a user
-func UpdateUserStreak(userID int, currentStreak int, lastActivityDate time.Time) error {
-	_, err := db.Exec(`
-		INSERT INTO user_streaks (user_id, current_streak, longest_streak, last_activity_date, streak_type, is_active)
-		VALUES (?, ?, ?, ?, 'engagement', TRUE)
-		ON DUPLICATE KEY UPDATE
-		current_streak = VALUES(current_streak),
-		longest_streak = GREATEST(longest_streak, VALUES(current_streak)),
-		last_activity_date = VALUES(last_activity_date),
-		is_active = TRUE
-	`, userID, currentStreak, currentStreak, lastActivityDate)
-
-	return err
+// scanProduct scans a row selected with productSelectColumns
+func scanProduct(row rowScanner) (*Product, error) {
+	var p Product
+	var deletedAt sql.NullTime
+	err := row.Scan(&p.ProductID, &p.ProductName, &p.CategoryID, &p.Price, &p.UpdatedAt, &deletedAt,
+		&p.StockQuantity, &p.LowStockThreshold, &p.ReservedQuantity)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		p.DeletedAt = &deletedAt.Time
+	}
+	return &p, nil
 }
 
-// RecordUserActivity records a new user activity
-func RecordUserActivity(userID int, activityType string, activityValue float64) error {
-	_, err := db.Exec(`
-		INSERT INTO user_activities (user_id, activity_type, activity_date, activity_value)
-		VALUES (?, ?, NOW(), ?)
-	`, userID, activityType, activityValue)
-
-	return err
+// productSortColumns maps ProductQuery.SortBy to the column it orders by
+var productSortColumns = map[string]string{
+	ProductSortID:    "product_id",
+	ProductSortName:  "product_name",
+	ProductSortPrice: "price",
 }
 
-// GetUserActivities retrieves recent activities for a user
-func GetUserActivities(userID int, limit int) ([]struct {
-	ActivityType  string
-	ActivityDate  time.Time
-	ActivityValue float64
-}, error) {
-	rows, err := db.Query(`
-		SELECT activity_type, activity_date, activity_value
-		FROM user_activities
-		WHERE user_id = ?
-		ORDER BY activity_date DESC
-		LIMIT ?
-	`, userID, limit)
-	if err != nil {
-		return nil, err
+// ListProducts fetches one page of products using keyset pagination on (sort column, product_id)
+func (s *MySQLStore) ListProducts(query ProductQuery) ([]Product, int, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	if len(query.CategoryIDs) > 0 {
+		conditions = append(conditions, "category_id IN (?"+strings.Repeat(", ?", len(query.CategoryIDs)-1)+")")
+		for _, id := range query.CategoryIDs {
+			args = append(args, id)
+		}
 	}
-	defer rows.Close()
+	if query.MinPrice != nil {
+		conditions = append(conditions, "price >= ?")
+		args = append(args, *query.MinPrice)
+	}
+	if query.MaxPrice != nil {
+		conditions = append(conditions, "price <= ?")
+		args = append(args, *query.MaxPrice)
+	}
+	for _, term := range query.SearchTerms {
+		conditions = append(conditions, "search_name LIKE ?")
+		args = append(args, "%"+escapeLike(term)+"%")
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
 
-	var activities []struct {
-		ActivityType  string
-		ActivityDate  time.Time
-		ActivityValue float64
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM products"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting products: %w", err)
 	}
 
-	for rows.Next() {
-		var activity struct {
-			ActivityType  string
-			ActivityDate  time.Time
-			ActivityValue float64
+	column, ok := productSortColumns[query.SortBy]
+	if !ok {
+		column = "product_id"
+	}
+	direction, cmp := "ASC", ">"
+	if query.Desc {
+		direction, cmp = "DESC", "<"
+	}
+	if after := query.After; after != nil {
+		var value interface{}
+		switch query.SortBy {
+		case ProductSortName:
+			value = after.Name
+		case ProductSortPrice:
+			value = after.Price
 		}
-		err := rows.Scan(&activity.ActivityType, &activity.ActivityDate, &activity.ActivityValue)
-		if err != nil {
-			return nil, err
+		if value == nil {
+			conditions = append(conditions, "product_id "+cmp+" ?")
+			args = append(args, after.ProductID)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND product_id %[2]s ?))", column, cmp))
+			args = append(args, value, value, after.ProductID)
 		}
-		activities = append(activities, activity)
+		where = " WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	return activities, nil
-}
-
-// SaveStreakPrediction saves a prediction to the database
-func SaveStreakPrediction(prediction StreakPrediction) error {
-	_, err := db.Exec(`
-		INSERT INTO streak_predictions 
-		(user_id, prediction_date, probability_of_streak_drop, predicted_days_to_streak_drop, risk_level, confidence)
-		VALUES (?, NOW(), ?, ?, ?, ?)
-	`, prediction.UserID, prediction.ProbabilityOfStreakDrop, prediction.PredictedDaysToStreakDrop,
-		prediction.RiskLevel, prediction.Confidence)
-
-	return err
-}
-
-// GetStreakPredictions retrieves predictions for a user
-func GetStreakPredictions(userID int, limit int) ([]StreakPrediction, error) {
-	rows, err := db.Query(`
-		SELECT user_id, probability_of_streak_drop, predicted_days_to_streak_drop, 
-		       risk_level, confidence, actual_streak_dropped
-		FROM streak_predictions
-		WHERE user_id = ?
-		ORDER BY prediction_date DESC
-		LIMIT ?
-	`, userID, limit)
+	sqlQuery := fmt.Sprintf("SELECT %s FROM products%s ORDER BY %s %s, product_id %s LIMIT ?",
+		productSelectColumns, where, column, direction, direction)
+	args = append([]interface{}{time.Now()}, args...) // productReservedColumn comes before the WHERE
+	rows, err := s.db.Query(sqlQuery, append(args, query.Limit)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, fmt.Errorf("error querying products: %w", err)
 	}
 	defer rows.Close()
 
-	var predictions []StreakPrediction
+	var products []Product
 	for rows.Next() {
-		var pred StreakPrediction
-		var actualDropped sql.NullBool
-		err := rows.Scan(&pred.UserID, &pred.ProbabilityOfStreakDrop, &pred.PredictedDaysToStreakDrop,
-			&pred.RiskLevel, &pred.Confidence, &actualDropped)
+		p, err := scanProduct(rows)
 		if err != nil {
-			return nil, err
+			log.Printf("Error scanning product row: %v", err)
+			continue
 		}
-		predictions = append(predictions, pred)
+		products = append(products, *p)
 	}
+	return products, total, nil
+}
 
-	return predictions, nil
+// GetProductByID retrieves a product, including soft-deleted ones
+func (s *MySQLStore) GetProductByID(productID int) (*Product, error) {
+	p, err := scanProduct(s.db.QueryRow("SELECT "+productSelectColumns+" FROM products WHERE product_id = ?", time.Now(), productID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching product: %w", err)
+	}
+	return p, nil
 }
 
-// SaveStreakModel saves a trained model to the database
-func SaveStreakModel(model StreakModel) error {
-	paramsJSON, err := json.Marshal(model.Parameters)
-	if err != nil {
-		return err
+// nullableUserID stores 0 (no user, e.g. a CLI import) as NULL
+func nullableUserID(userID int) interface{} {
+	if userID <= 0 {
+		return nil
 	}
+	return userID
+}
 
-	featuresJSON, err := json.Marshal(model.FeatureNames)
+// CreateProduct inserts a product and its initial price in one transaction
+func (s *MySQLStore) CreateProduct(product Product, changedBy int) (int, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("error starting transaction: %w", err)
 	}
+	defer tx.Rollback() // Rollback on error
 
-	_, err = db.Exec(`
-		INSERT INTO streak_models (model_type, version, training_date, accuracy, parameters, feature_names, is_active)
-		VALUES (?, ?, ?, ?, ?, ?, TRUE)
-	`, model.ModelType, model.Version, model.TrainingDate, model.Accuracy, paramsJSON, featuresJSON)
+	id, err := createProductTx(tx, product, changedBy)
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return id, nil
 }
 
-// GetActiveStreakModel retrieves the currently active model
-func GetActiveStreakModel() (*StreakModel, error) {
-	var model StreakModel
-	var paramsJSON, featuresJSON []byte
+// UpdateProduct replaces a product's fields, auditing a price change in the same transaction
+func (s *MySQLStore) UpdateProduct(product Product, changedBy int) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
 
-	err := db.QueryRow(`
-		SELECT model_type, version, training_date, accuracy, parameters, feature_names
-		FROM streak_models
-		WHERE is_active = TRUE
-		ORDER BY training_date DESC
-		LIMIT 1
-	`).Scan(&model.ModelType, &model.Version, &model.TrainingDate, &model.Accuracy, &paramsJSON, &featuresJSON)
+	updated, err := updateProductTx(tx, product, changedBy)
+	if err != nil || !updated {
+		return false, err
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
 	}
+	return true, nil
+}
 
-	// Parse JSON fields
-	if err := json.Unmarshal(paramsJSON, &model.Parameters); err != nil {
-		return nil, err
+// UpsertProducts updates or creates every product in one transaction
+func (s *MySQLStore) UpsertProducts(products []ProductUpsert, changedBy int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
 	}
-	if err := json.Unmarshal(featuresJSON, &model.FeatureNames); err != nil {
-		return nil, err
+	defer tx.Rollback() // Rollback on error
+
+	for _, upsert := range products {
+		product := upsert.Product
+		updated := false
+		if product.ProductID > 0 {
+			if updated, err = updateProductTx(tx, product, changedBy); err != nil {
+				return err
+			}
+		}
+		if updated && upsert.Stock != nil {
+			if _, err := updateProductStockTx(tx, product.ProductID, *upsert.Stock); err != nil {
+				return fmt.Errorf("product %d: %w", product.ProductID, err)
+			}
+		}
+		if !updated {
+			if _, err := createProductTx(tx, product, changedBy); err != nil {
+				return fmt.Errorf("product %d: %w", product.ProductID, err)
+			}
+		}
 	}
 
-	return &model, nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
 }
 
-var db *sql.DB
-
-// ... (các hàm InitDB, CloseDB như cũ) ...
-
-// InitDB initializes the MySQL database connection and creates tables if they don't exist
-func InitDB(dataSourceName string) {
-	var err error
-	db, err = sql.Open("mysql", dataSourceName)
+// createProductTx inserts a product and records its initial price
+func createProductTx(tx *sql.Tx, product Product, changedBy int) (int, error) {
+	var productID interface{}
+	if product.ProductID > 0 {
+		productID = product.ProductID
+	}
+	result, err := tx.Exec("INSERT INTO products (product_id, product_name, search_name, category_id, price, updated_at, stock_quantity, low_stock_threshold) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		productID, product.ProductName, foldVietnamese(product.ProductName), product.CategoryID, product.Price, product.UpdatedAt,
+		product.StockQuantity, product.LowStockThreshold)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 { // ER_DUP_ENTRY
+			return 0, ErrProductExists
+		}
+		return 0, fmt.Errorf("error inserting product: %w", err)
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
-		log.Fatalf("Error opening database connection: %v", err)
+		return 0, fmt.Errorf("error reading new product id: %w", err)
 	}
 
-	err = db.Ping()
+	_, err = tx.Exec("INSERT INTO product_price_changes (product_id, old_price, new_price, changed_by, changed_at) VALUES (?, NULL, ?, ?, ?)",
+		id, product.Price, nullableUserID(changedBy), product.UpdatedAt)
 	if err != nil {
-		log.Fatalf("Error connecting to the database: %v", err)
+		return 0, fmt.Errorf("error recording product price: %w", err)
+	}
+	return int(id), nil
+}
+
+// updateProductTx updates a non-deleted product and audits a price change; it returns
+// false when there is no such product
+func updateProductTx(tx *sql.Tx, product Product, changedBy int) (bool, error) {
+	// Lock the row so concurrent updates audit the price they actually replaced
+	var oldPrice float64
+	err := tx.QueryRow("SELECT price FROM products WHERE product_id = ? AND deleted_at IS NULL FOR UPDATE", product.ProductID).Scan(&oldPrice)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error fetching product: %w", err)
 	}
-	fmt.Println("Successfully connected to MySQL database!")
 
-	// Create tables (Updated users table)
-	createTableSQL := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-            user_id INT PRIMARY KEY,
-            username VARCHAR(255) NOT NULL,
-            email VARCHAR(255) UNIQUE NOT NULL,
-            password_hash VARCHAR(255) NOT NULL,
-            last_login DATETIME,
-            registered_date DATETIME
-        );`,
-		// ... (các lệnh CREATE TABLE cho products, orders, user_preferences, offers như cũ) ...
-		`CREATE TABLE IF NOT EXISTS products (
-            product_id INT PRIMARY KEY,
-            product_name VARCHAR(255) NOT NULL,
-            category VARCHAR(255) NOT NULL,
-            price DECIMAL(10, 2)
-        );`,
-		`CREATE TABLE IF NOT EXISTS orders (
-            order_id INT PRIMARY KEY AUTO_INCREMENT,
-            user_id INT,
-            product_id INT,
-            order_date DATETIME,
-            quantity INT,
-            total_price DECIMAL(10, 2),
-            FOREIGN KEY (user_id) REFERENCES users(user_id),
-            FOREIGN KEY (product_id) REFERENCES products(product_id)
-        );`,
-		`CREATE TABLE IF NOT EXISTS user_preferences (
-            user_id INT PRIMARY KEY,
-            preferred_categories TEXT,
-            churn_risk DECIMAL(3, 2),
-            FOREIGN KEY (user_id) REFERENCES users(user_id)
-        );`,
-		`CREATE TABLE IF NOT EXISTS offers (
-            offer_id INT PRIMARY KEY AUTO_INCREMENT,
-            user_id INT,
-            offer_type VARCHAR(50),
-            offer_value VARCHAR(100),
-            target_category VARCHAR(255),
-            generated_message TEXT,
-            sent_date DATETIME,
-            is_used BOOLEAN DEFAULT FALSE,
-            FOREIGN KEY (user_id) REFERENCES users(user_id)
-        );`,
-	}
-
-	for _, sqlStmt := range createTableSQL {
-		_, err := db.Exec(sqlStmt)
+	_, err = tx.Exec("UPDATE products SET product_name = ?, search_name = ?, category_id = ?, price = ?, updated_at = ? WHERE product_id = ?",
+		product.ProductName, foldVietnamese(product.ProductName), product.CategoryID, product.Price, product.UpdatedAt, product.ProductID)
+	if err != nil {
+		return false, fmt.Errorf("error updating product: %w", err)
+	}
+	if oldPrice != product.Price {
+		_, err = tx.Exec("INSERT INTO product_price_changes (product_id, old_price, new_price, changed_by, changed_at) VALUES (?, ?, ?, ?, ?)",
+			product.ProductID, oldPrice, product.Price, nullableUserID(changedBy), product.UpdatedAt)
 		if err != nil {
-			log.Fatalf("Error creating table: %v\nSQL: %s", err, sqlStmt)
+			return false, fmt.Errorf("error recording product price change: %w", err)
 		}
 	}
-	fmt.Println("Database tables checked/created successfully.")
+	return true, nil
 }
 
-// InsertSampleData inserts sample data into the database
-func InsertSampleData() {
-	tx, err := db.Begin()
+// DeleteProduct soft-deletes a product so orders referencing it still join
+func (s *MySQLStore) DeleteProduct(productID int, deletedAt time.Time) (bool, error) {
+	result, err := s.db.Exec("UPDATE products SET deleted_at = ?, updated_at = ? WHERE product_id = ? AND deleted_at IS NULL", deletedAt, deletedAt, productID)
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		return
+		return false, fmt.Errorf("error deleting product: %w", err)
 	}
-	defer tx.Rollback() // Rollback on error
-
-	// Insert user B with a password hash (for simplicity, using plain text as "hash" here)
-	// In production, use bcrypt or similar for secure hashing
-	passwordHashB := "password123" // In real app: HashPassword("password123")
-	_, err = tx.Exec("INSERT IGNORE INTO users (user_id, username, email, password_hash, last_login, registered_date) VALUES (?, ?, ?, ?, ?, ?)",
-		101, "userB", "user_b@example.com", passwordHashB, time.Now().Add(-100*24*time.Hour), time.Now().Add(-365*24*time.Hour))
+	affected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error inserting user B: %v", err)
-		return
+		return false, fmt.Errorf("error deleting product: %w", err)
 	}
+	return affected == 1, nil
+}
 
-	// Insert another user for testing
-	passwordHashA := "securepass" // In real app: HashPassword("securepass")
-	_, err = tx.Exec("INSERT IGNORE INTO users (user_id, username, email, password_hash, last_login, registered_date) VALUES (?, ?, ?, ?, ?, ?)",
-		102, "userA", "user_a@example.com", passwordHashA, time.Now(), time.Now().Add(-50*24*time.Hour))
+// GetProductPriceChanges retrieves a product's price history, oldest first
+func (s *MySQLStore) GetProductPriceChanges(productID int) ([]ProductPriceChange, error) {
+	rows, err := s.db.Query(`
+		SELECT change_id, product_id, old_price, new_price, changed_by, changed_at
+		FROM product_price_changes WHERE product_id = ? ORDER BY changed_at, change_id
+	`, productID)
 	if err != nil {
-		log.Printf("Error inserting user A: %v", err)
-		return
+		return nil, fmt.Errorf("error fetching product price changes: %w", err)
 	}
+	defer rows.Close()
 
-	// ... (phần chèn products, orders và user_preferences như cũ) ...
+	var changes []ProductPriceChange
+	for rows.Next() {
+		var c ProductPriceChange
+		var oldPrice sql.NullFloat64
+		var changedBy sql.NullInt64
+		if err := rows.Scan(&c.ChangeID, &c.ProductID, &oldPrice, &c.NewPrice, &changedBy, &c.ChangedAt); err != nil {
+			log.Printf("Error scanning product price change: %v", err)
+			continue
+		}
+		if oldPrice.Valid {
+			c.OldPrice = &oldPrice.Float64
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			c.ChangedBy = &id
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
 
-	// Insert user preferences for user B (simulated AI output)
-	_, err = tx.Exec("INSERT IGNORE INTO user_preferences (user_id, preferred_categories, churn_risk) VALUES (?, ?, ?)",
-		101, "Thời trang nữ", 0.85)
+// UpdateProductStock applies a stock count or adjustment while holding the product row,
+// so it can't undercut reservations and orders made at the same time
+func (s *MySQLStore) UpdateProductStock(productID int, change StockChange) (*Product, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Printf("Error inserting user preferences for user B: %v", err)
-		return
+		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
+	defer tx.Rollback() // Rollback on error
 
-	// Insert user preferences for user A (low churn risk)
-	_, err = tx.Exec("INSERT IGNORE INTO user_preferences (user_id, preferred_categories, churn_risk) VALUES (?, ?, ?)",
-		102, "Điện tử", 0.15)
-	if err != nil {
-		log.Printf("Error inserting user preferences for user A: %v", err)
-		return
+	found, err := updateProductStockTx(tx, productID, change)
+	if err != nil || !found {
+		return nil, err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		return
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
 	}
-	fmt.Println("Sample data inserted successfully.")
+	return s.GetProductByID(productID)
 }
 
-// GetUserByEmail retrieves a user by their email
-func GetUserByEmail(email string) (*User, error) {
-	var user User
-	var lastLogin sql.NullTime
-
-	err := db.QueryRow("SELECT * FROM users WHERE email = ?", email).Scan(
-		&user.UserID, &user.Username, &user.Email, &user.PasswordHash, &lastLogin, &user.RegisteredDate,
-	)
+// updateProductStockTx applies a stock change to a non-deleted product; it returns false
+// when there is no such product
+func updateProductStockTx(tx *sql.Tx, productID int, change StockChange) (bool, error) {
+	var stock, threshold int
+	err := tx.QueryRow("SELECT stock_quantity, low_stock_threshold FROM products WHERE product_id = ? AND deleted_at IS NULL FOR UPDATE", productID).Scan(&stock, &threshold)
 	if err == sql.ErrNoRows {
-		return nil, nil // User not found
+		return false, nil
 	} else if err != nil {
-		return nil, fmt.Errorf("error fetching user by email: %w", err)
+		return false, fmt.Errorf("error fetching product stock: %w", err)
+	}
+	reserved, err := reservedQuantityTx(tx, productID, change.ChangedAt)
+	if err != nil {
+		return false, err
 	}
 
-	if lastLogin.Valid {
-		user.LastLogin = &lastLogin.Time
+	stock += change.Adjustment
+	if change.Quantity != nil {
+		stock = *change.Quantity
+	}
+	if stock < 0 || stock < reserved {
+		return false, ErrInsufficientStock
+	}
+	if change.LowStockThreshold != nil {
+		threshold = *change.LowStockThreshold
 	}
 
-	return &user, nil
+	_, err = tx.Exec("UPDATE products SET stock_quantity = ?, low_stock_threshold = ?, updated_at = ? WHERE product_id = ?",
+		stock, threshold, change.ChangedAt, productID)
+	if err != nil {
+		return false, fmt.Errorf("error updating product stock: %w", err)
+	}
+	return true, nil
 }
 
-// UpdateUserLastLogin updates the last_login timestamp for a user
-func UpdateUserLastLogin(userID int, loginTime time.Time) error {
-	_, err := db.Exec("UPDATE users SET last_login = ? WHERE user_id = ?", loginTime, userID)
+// reservedQuantityTx sums a product's active reservations that haven't expired at now
+func reservedQuantityTx(tx *sql.Tx, productID int, now time.Time) (int, error) {
+	var reserved int
+	err := tx.QueryRow("SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations WHERE product_id = ? AND status = 'active' AND expires_at > ?",
+		productID, now).Scan(&reserved)
 	if err != nil {
-		return fmt.Errorf("error updating last login: %w", err)
+		return 0, fmt.Errorf("error fetching reserved stock: %w", err)
+	}
+	return reserved, nil
+}
+
+// ListLowStockProducts fetches the products at or below their low-stock threshold
+func (s *MySQLStore) ListLowStockProducts() ([]Product, error) {
+	rows, err := s.db.Query(`
+		SELECT * FROM (SELECT `+productSelectColumns+` FROM products WHERE deleted_at IS NULL) p
+		WHERE stock_quantity - reserved_quantity <= low_stock_threshold
+		ORDER BY stock_quantity - reserved_quantity, product_id
+	`, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error querying low-stock products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			log.Printf("Error scanning product row: %v", err)
+			continue
+		}
+		products = append(products, *p)
+	}
+	return products, nil
+}
+
+// GetAvailableStockByCategory sums the available units of non-deleted products per category
+func (s *MySQLStore) GetAvailableStockByCategory() (map[int]int, error) {
+	rows, err := s.db.Query(`
+		SELECT category_id, SUM(GREATEST(stock_quantity - reserved_quantity, 0))
+		FROM (SELECT category_id, stock_quantity, `+productReservedColumn+` AS reserved_quantity FROM products WHERE deleted_at IS NULL) p
+		GROUP BY category_id
+	`, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error querying stock by category: %w", err)
+	}
+	defer rows.Close()
+
+	available := make(map[int]int)
+	for rows.Next() {
+		var categoryID, units int
+		if err := rows.Scan(&categoryID, &units); err != nil {
+			return nil, fmt.Errorf("error scanning stock by category: %w", err)
+		}
+		available[categoryID] = units
+	}
+	return available, rows.Err()
+}
+
+// ReserveStock holds units of a product for a user while holding the product row
+func (s *MySQLStore) ReserveStock(reservation StockReservation) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	var stock int
+	err = tx.QueryRow("SELECT stock_quantity FROM products WHERE product_id = ? AND deleted_at IS NULL FOR UPDATE", reservation.ProductID).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return 0, ErrInsufficientStock
+	} else if err != nil {
+		return 0, fmt.Errorf("error fetching product stock: %w", err)
+	}
+	reserved, err := reservedQuantityTx(tx, reservation.ProductID, reservation.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	if stock-reserved < reservation.Quantity {
+		return 0, ErrInsufficientStock
+	}
+
+	// Locking the user row serialises the user's reservations across products
+	var lockedUserID int
+	if err := tx.QueryRow("SELECT user_id FROM users WHERE user_id = ? FOR UPDATE", reservation.UserID).Scan(&lockedUserID); err != nil {
+		return 0, fmt.Errorf("error locking user: %w", err)
+	}
+	var active, units int
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN product_id = ? THEN quantity ELSE 0 END), 0)
+		FROM stock_reservations WHERE user_id = ? AND status = 'active' AND expires_at > ?
+	`, reservation.ProductID, reservation.UserID, reservation.CreatedAt).Scan(&active, &units)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching the user's reservations: %w", err)
+	}
+	if active >= maxActiveReservationsPerUser || units+reservation.Quantity > maxReservationQuantity {
+		return 0, ErrReservationLimit
+	}
+
+	result, err := tx.Exec("INSERT INTO stock_reservations (product_id, user_id, quantity, status, created_at, expires_at) VALUES (?, ?, ?, 'active', ?, ?)",
+		reservation.ProductID, reservation.UserID, reservation.Quantity, reservation.CreatedAt, reservation.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting stock reservation: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading new reservation id: %w", err)
+	}
+	// The available quantity changed, which GET /api/products/{id} reports
+	if _, err := tx.Exec("UPDATE products SET updated_at = ? WHERE product_id = ?", reservation.CreatedAt, reservation.ProductID); err != nil {
+		return 0, fmt.Errorf("error updating product: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetStockReservation retrieves a reservation, reporting a lapsed active one as expired
+func (s *MySQLStore) GetStockReservation(reservationID int) (*StockReservation, error) {
+	var r StockReservation
+	var releasedAt sql.NullTime
+	var orderID sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT reservation_id, product_id, user_id, quantity, status, created_at, expires_at, released_at, order_id
+		FROM stock_reservations WHERE reservation_id = ?
+	`, reservationID).Scan(&r.ReservationID, &r.ProductID, &r.UserID, &r.Quantity, &r.Status, &r.CreatedAt, &r.ExpiresAt, &releasedAt, &orderID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching stock reservation: %w", err)
+	}
+	if releasedAt.Valid {
+		r.ReleasedAt = &releasedAt.Time
+	}
+	if orderID.Valid {
+		id := int(orderID.Int64)
+		r.OrderID = &id
+	}
+	if r.Status == ReservationActive && !r.ExpiresAt.After(time.Now()) {
+		r.Status = ReservationExpired
+	}
+	return &r, nil
+}
+
+// ReleaseStockReservation marks an active reservation released, giving its units back
+func (s *MySQLStore) ReleaseStockReservation(reservationID int, releasedAt time.Time) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	// Lock the product before the reservation, in the same order as ReserveStock and PlaceOrder
+	var productID int
+	err = tx.QueryRow("SELECT product_id FROM stock_reservations WHERE reservation_id = ?", reservationID).Scan(&productID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error fetching stock reservation: %w", err)
+	}
+	if err := tx.QueryRow("SELECT product_id FROM products WHERE product_id = ? FOR UPDATE", productID).Scan(&productID); err != nil {
+		return false, fmt.Errorf("error locking product: %w", err)
+	}
+
+	result, err := tx.Exec("UPDATE stock_reservations SET status = 'released', released_at = ? WHERE reservation_id = ? AND status = 'active' AND expires_at > ?",
+		releasedAt, reservationID, releasedAt)
+	if err != nil {
+		return false, fmt.Errorf("error releasing stock reservation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error releasing stock reservation: %w", err)
+	}
+	if affected != 1 {
+		return false, nil
+	}
+	if _, err := tx.Exec("UPDATE products SET updated_at = ? WHERE product_id = ?", releasedAt, productID); err != nil {
+		return false, fmt.Errorf("error updating product: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return true, nil
+}
+
+// PlaceOrder decrements the stock and inserts the order and its items in one
+// transaction, holding the product rows so concurrent orders can't sell the same units
+// twice. Products are locked in ID order so two baskets can't deadlock each other.
+func (s *MySQLStore) PlaceOrder(order Order) (*Order, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	lockOrder := make([]int, len(order.Items))
+	for i := range lockOrder {
+		lockOrder[i] = i
+	}
+	sort.SliceStable(lockOrder, func(a, b int) bool {
+		return order.Items[lockOrder[a]].ProductID < order.Items[lockOrder[b]].ProductID
+	})
+
+	order.TotalPrice = 0
+	for _, i := range lockOrder {
+		item := &order.Items[i]
+		var stock int
+		var categoryID sql.NullInt64
+		err = tx.QueryRow("SELECT stock_quantity, product_name, category_id, price FROM products WHERE product_id = ? AND deleted_at IS NULL FOR UPDATE", item.ProductID).Scan(
+			&stock, &item.ProductName, &categoryID, &item.UnitPrice,
+		)
+		if err == sql.ErrNoRows {
+			return nil, &OrderItemError{ProductID: item.ProductID, Err: ErrInsufficientStock}
+		} else if err != nil {
+			return nil, fmt.Errorf("error fetching product stock: %w", err)
+		}
+		item.CategoryID = int(categoryID.Int64)
+		reserved, err := reservedQuantityTx(tx, item.ProductID, order.OrderDate)
+		if err != nil {
+			return nil, err
+		}
+		if item.ReservationID > 0 {
+			var held int
+			err = tx.QueryRow(`
+				SELECT quantity FROM stock_reservations
+				WHERE reservation_id = ? AND user_id = ? AND product_id = ? AND status = 'active' AND expires_at > ? FOR UPDATE
+			`, item.ReservationID, order.UserID, item.ProductID, order.OrderDate).Scan(&held)
+			if err == sql.ErrNoRows || (err == nil && held < item.Quantity) {
+				return nil, &OrderItemError{ProductID: item.ProductID, Err: ErrReservationNotActive}
+			} else if err != nil {
+				return nil, fmt.Errorf("error fetching stock reservation: %w", err)
+			}
+			reserved -= held // the units held for this order are the ones being sold
+			// Consume the reservation now, so another item can't count the same units
+			if _, err := tx.Exec("UPDATE stock_reservations SET status = 'ordered', released_at = ? WHERE reservation_id = ?",
+				order.OrderDate, item.ReservationID); err != nil {
+				return nil, fmt.Errorf("error updating stock reservation: %w", err)
+			}
+		}
+		if stock-reserved < item.Quantity {
+			return nil, &OrderItemError{ProductID: item.ProductID, Err: ErrInsufficientStock}
+		}
+
+		if _, err := tx.Exec("UPDATE products SET stock_quantity = stock_quantity - ?, updated_at = ? WHERE product_id = ?",
+			item.Quantity, order.OrderDate, item.ProductID); err != nil {
+			return nil, fmt.Errorf("error updating product stock: %w", err)
+		}
+		item.LineTotal = orderTotal(item.UnitPrice, item.Quantity)
+		order.TotalPrice += item.LineTotal
+	}
+	order.TotalPrice = math.Round(order.TotalPrice*100) / 100
+
+	order.Status, order.UpdatedAt = OrderPending, order.OrderDate
+	result, err := tx.Exec("INSERT INTO orders (user_id, order_date, status, updated_at, total_price) VALUES (?, ?, ?, ?, ?)",
+		order.UserID, order.OrderDate, order.Status, order.UpdatedAt, order.TotalPrice)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting order: %w", err)
+	}
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error reading new order id: %w", err)
+	}
+	order.OrderID = int(orderID)
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		result, err := tx.Exec("INSERT INTO order_items (order_id, product_id, product_name, category_id, unit_price, quantity, line_total) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			order.OrderID, item.ProductID, item.ProductName, nullableCategoryID(item.CategoryID), item.UnitPrice, item.Quantity, item.LineTotal)
+		if err != nil {
+			return nil, fmt.Errorf("error inserting order item: %w", err)
+		}
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("error reading new order item id: %w", err)
+		}
+		item.OrderItemID = int(itemID)
+		if item.ReservationID > 0 {
+			if _, err := tx.Exec("UPDATE stock_reservations SET order_id = ? WHERE reservation_id = ?", order.OrderID, item.ReservationID); err != nil {
+				return nil, fmt.Errorf("error updating stock reservation: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return &order, nil
+}
+
+// orderSelectColumns is the column list scanned by scanOrder
+const orderSelectColumns = "order_id, user_id, order_date, status, updated_at, total_price"
+
+// scanOrder scans a row selected with orderSelectColumns; the items are loaded separately
+// by loadOrderItems
+func scanOrder(row rowScanner) (*Order, error) {
+	var o Order
+	var updatedAt sql.NullTime
+	var totalPrice sql.NullFloat64
+	err := row.Scan(&o.OrderID, &o.UserID, &o.OrderDate, &o.Status, &updatedAt, &totalPrice)
+	if err != nil {
+		return nil, err
+	}
+	o.UpdatedAt = o.OrderDate
+	if updatedAt.Valid {
+		o.UpdatedAt = updatedAt.Time
+	}
+	o.TotalPrice = totalPrice.Float64
+	o.Items = []OrderItem{}
+	return &o, nil
+}
+
+// queryOrders runs an orderSelectColumns query and loads the items of the orders found
+func (s *MySQLStore) queryOrders(query string, args ...interface{}) ([]Order, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			log.Printf("Error scanning order row: %v", err)
+			continue
+		}
+		orders = append(orders, *o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading orders: %w", err)
+	}
+	if err := s.loadOrderItems(orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// loadOrderItems fills in the items of the given orders with one query
+func (s *MySQLStore) loadOrderItems(orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	positions := make(map[int]int, len(orders))
+	placeholders := make([]string, len(orders))
+	args := make([]interface{}, len(orders))
+	for i, o := range orders {
+		positions[o.OrderID] = i
+		placeholders[i] = "?"
+		args[i] = o.OrderID
+	}
+
+	rows, err := s.db.Query(`
+		SELECT order_item_id, order_id, product_id, product_name, category_id, unit_price, quantity, line_total
+		FROM order_items WHERE order_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY order_item_id
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("error querying order items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItem
+		var orderID int
+		var categoryID sql.NullInt64
+		if err := rows.Scan(&item.OrderItemID, &orderID, &item.ProductID, &item.ProductName, &categoryID, &item.UnitPrice, &item.Quantity, &item.LineTotal); err != nil {
+			log.Printf("Error scanning order item row: %v", err)
+			continue
+		}
+		item.CategoryID = int(categoryID.Int64)
+		i := positions[orderID]
+		orders[i].Items = append(orders[i].Items, item)
+	}
+	return rows.Err()
+}
+
+// ListOrders fetches one page of a user's orders, newest first, using keyset
+// pagination on (order_date, order_id)
+func (s *MySQLStore) ListOrders(query OrderQuery) ([]Order, int, error) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{query.UserID}
+	if query.From != nil {
+		conditions = append(conditions, "order_date >= ?")
+		args = append(args, *query.From)
+	}
+	if query.Before != nil {
+		conditions = append(conditions, "order_date < ?")
+		args = append(args, *query.Before)
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM orders"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting orders: %w", err)
+	}
+
+	if after := query.After; after != nil {
+		conditions = append(conditions, "(order_date < ? OR (order_date = ? AND order_id < ?))")
+		args = append(args, after.OrderDate, after.OrderDate, after.OrderID)
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	orders, err := s.queryOrders("SELECT "+orderSelectColumns+" FROM orders"+where+" ORDER BY order_date DESC, order_id DESC LIMIT ?",
+		append(args, query.Limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return orders, total, nil
+}
+
+// GetOrderByID retrieves an order with its items
+func (s *MySQLStore) GetOrderByID(orderID int) (*Order, error) {
+	orders, err := s.queryOrders("SELECT "+orderSelectColumns+" FROM orders WHERE order_id = ?", orderID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching order: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	return &orders[0], nil
+}
+
+// GetOrderStats aggregates a user's order history in SQL, so it covers every order
+// rather than the recent ones GetUserData loads
+func (s *MySQLStore) GetOrderStats(userID int, trendStart, trendSplit time.Time) (*OrderStats, error) {
+	var stats OrderStats
+	var firstOrder, lastOrder sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(total_price), 0), MIN(order_date), MAX(order_date),
+		       COALESCE(SUM(CASE WHEN order_date >= ? THEN total_price END), 0),
+		       COALESCE(SUM(CASE WHEN order_date >= ? AND order_date < ? THEN total_price END), 0),
+		       (SELECT COUNT(*) FROM orders WHERE user_id = ? AND status = 'refunded')
+		FROM orders WHERE user_id = ? AND status NOT IN ('cancelled', 'refunded')
+	`, trendSplit, trendStart, trendSplit, userID, userID).Scan(
+		&stats.TotalOrders, &stats.TotalSpent, &firstOrder, &lastOrder, &stats.RecentSpent, &stats.PreviousSpent, &stats.RefundedOrders,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating orders: %w", err)
+	}
+	if firstOrder.Valid {
+		stats.FirstOrderDate = &firstOrder.Time
+	}
+	if lastOrder.Valid {
+		stats.LastOrderDate = &lastOrder.Time
+	}
+
+	err = s.db.QueryRow(`
+		SELECT COALESCE(SUM(i.quantity), 0)
+		FROM order_items i JOIN orders o ON o.order_id = i.order_id
+		WHERE o.user_id = ? AND o.status NOT IN ('cancelled', 'refunded')
+	`, userID).Scan(&stats.TotalUnits)
+	if err != nil {
+		return nil, fmt.Errorf("error counting ordered units: %w", err)
+	}
+	return &stats, nil
+}
+
+// UpdateOrderStatus changes an order's status, restocks its items if asked and records
+// the event in one transaction. The conditional UPDATE makes two concurrent changes of
+// the same order fail rather than both apply.
+func (s *MySQLStore) UpdateOrderStatus(event OrderEvent, changedBy int) (*OrderEvent, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	result, err := tx.Exec("UPDATE orders SET status = ?, updated_at = ? WHERE order_id = ? AND status = ?",
+		event.ToStatus, event.CreatedAt, event.OrderID, event.FromStatus)
+	if err != nil {
+		return nil, fmt.Errorf("error updating order status: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("error reading updated order count: %w", err)
+	} else if rows == 0 {
+		return nil, nil
+	}
+
+	if event.Restocked {
+		// Products are updated in ID order, like PlaceOrder locks them
+		rows, err := tx.Query("SELECT product_id, SUM(quantity) FROM order_items WHERE order_id = ? GROUP BY product_id ORDER BY product_id", event.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("error querying order items: %w", err)
+		}
+		returned := make(map[int]int)
+		var productIDs []int
+		for rows.Next() {
+			var productID, quantity int
+			if err := rows.Scan(&productID, &quantity); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning order item: %w", err)
+			}
+			returned[productID] = quantity
+			productIDs = append(productIDs, productID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error reading order items: %w", err)
+		}
+		for _, productID := range productIDs {
+			if _, err := tx.Exec("UPDATE products SET stock_quantity = stock_quantity + ?, updated_at = ? WHERE product_id = ?",
+				returned[productID], event.CreatedAt, productID); err != nil {
+				return nil, fmt.Errorf("error restocking product %d: %w", productID, err)
+			}
+		}
+	}
+
+	if event.ToStatus == OrderCancelled {
+		_, err := tx.Exec("UPDATE offers SET is_used = FALSE, used_at = NULL, order_id = NULL WHERE order_id = ? AND expires_at > ?",
+			event.OrderID, event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error releasing offer of order %d: %w", event.OrderID, err)
+		}
+	}
+
+	result, err = tx.Exec("INSERT INTO order_events (order_id, from_status, to_status, amount, restocked, reason, changed_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		event.OrderID, event.FromStatus, event.ToStatus, event.Amount, event.Restocked, event.Reason, nullableUserID(changedBy), event.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting order event: %w", err)
+	}
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error reading new order event id: %w", err)
+	}
+	event.EventID = int(eventID)
+	if changedBy > 0 {
+		event.ChangedBy = &changedBy
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return &event, nil
+}
+
+// ListOrderEvents fetches an order's status changes, oldest first
+func (s *MySQLStore) ListOrderEvents(orderID int) ([]OrderEvent, error) {
+	rows, err := s.db.Query(`
+		SELECT event_id, order_id, from_status, to_status, amount, restocked, reason, changed_by, created_at
+		FROM order_events WHERE order_id = ? ORDER BY created_at, event_id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying order events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []OrderEvent
+	for rows.Next() {
+		var e OrderEvent
+		var changedBy sql.NullInt64
+		if err := rows.Scan(&e.EventID, &e.OrderID, &e.FromStatus, &e.ToStatus, &e.Amount, &e.Restocked, &e.Reason, &changedBy, &e.CreatedAt); err != nil {
+			log.Printf("Error scanning order event row: %v", err)
+			continue
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			e.ChangedBy = &id
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// nullableCategoryID stores 0 (no category) as NULL
+func nullableCategoryID(categoryID int) interface{} {
+	if categoryID <= 0 {
+		return nil
+	}
+	return categoryID
+}
+
+// GetCategories fetches every category with its localized names, ordered by ID
+func (s *MySQLStore) GetCategories() ([]Category, error) {
+	rows, err := s.db.Query(`
+		SELECT c.category_id, c.slug, c.parent_id, n.locale, n.name
+		FROM categories c
+		LEFT JOIN category_names n ON n.category_id = c.category_id
+		ORDER BY c.category_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching categories: %w", err)
+	}
+	defer rows.Close()
+	return scanCategories(rows)
+}
+
+// GetCategoryByID fetches a category with its localized names
+func (s *MySQLStore) GetCategoryByID(categoryID int) (*Category, error) {
+	rows, err := s.db.Query(`
+		SELECT c.category_id, c.slug, c.parent_id, n.locale, n.name
+		FROM categories c
+		LEFT JOIN category_names n ON n.category_id = c.category_id
+		WHERE c.category_id = ?
+	`, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching category: %w", err)
+	}
+	defer rows.Close()
+
+	categories, err := scanCategories(rows)
+	if err != nil || len(categories) == 0 {
+		return nil, err
+	}
+	return &categories[0], nil
+}
+
+// scanCategories groups (category, locale, name) rows ordered by category_id into categories
+func scanCategories(rows *sql.Rows) ([]Category, error) {
+	var categories []Category
+	for rows.Next() {
+		var c Category
+		var parentID sql.NullInt64
+		var locale, name sql.NullString
+		if err := rows.Scan(&c.CategoryID, &c.Slug, &parentID, &locale, &name); err != nil {
+			return nil, fmt.Errorf("error scanning category: %w", err)
+		}
+		if n := len(categories); n == 0 || categories[n-1].CategoryID != c.CategoryID {
+			if parentID.Valid {
+				id := int(parentID.Int64)
+				c.ParentID = &id
+			}
+			c.Names = make(map[string]string)
+			categories = append(categories, c)
+		}
+		if locale.Valid {
+			categories[len(categories)-1].Names[locale.String] = name.String
+		}
+	}
+	return categories, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
+
+// GetUserStreak retrieves streak information for a user
+func (s *MySQLStore) GetUserStreak(userID int) (*UserStreak, error) {
+	streak := &UserStreak{UserID: userID}
+
+	err := s.db.QueryRow(`
+		SELECT current_streak, longest_streak, last_activity_date, streak_type, is_active
+		FROM user_streaks WHERE user_id = ?
+	`, userID).Scan(&streak.CurrentStreak, &streak.LongestStreak, &streak.LastActivityDate, &streak.StreakType, &streak.IsActive)
+
+	if err == sql.ErrNoRows {
+		return nil, nil // User has no streak data yet
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching user streak: %w", err)
+	}
+
+	return streak, nil
+}
+
+// UpdateUserStreak updates or creates streak data for a user
+func (s *MySQLStore) UpdateUserStreak(userID int, currentStreak int, lastActivityDate time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_streaks (user_id, current_streak, longest_streak, last_activity_date, streak_type, is_active)
+		VALUES (?, ?, ?, ?, 'engagement', TRUE)
+		ON DUPLICATE KEY UPDATE
+		current_streak = VALUES(current_streak),
+		longest_streak = GREATEST(longest_streak, VALUES(current_streak)),
+		last_activity_date = VALUES(last_activity_date),
+		is_active = TRUE
+	`, userID, currentStreak, currentStreak, lastActivityDate)
+
+	return err
+}
+
+// RecordUserActivity records a new user activity
+func (s *MySQLStore) RecordUserActivity(userID int, activityType string, activityValue float64) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_activities (user_id, activity_type, activity_date, activity_value)
+		VALUES (?, ?, NOW(), ?)
+	`, userID, activityType, activityValue)
+
+	return err
+}
+
+// RecordUserActivities records a batch of activities in one transaction
+func (s *MySQLStore) RecordUserActivities(activities []ActivityInput) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	for _, a := range activities {
+		_, err := tx.Exec(`
+			INSERT INTO user_activities (user_id, activity_type, activity_date, activity_value)
+			VALUES (?, ?, NOW(), ?)
+		`, a.UserID, a.ActivityType, a.ActivityValue)
+		if err != nil {
+			return fmt.Errorf("error recording activity for user %d: %w", a.UserID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// RecordPurchaseActivity records the "purchase" activity of an order
+func (s *MySQLStore) RecordPurchaseActivity(userID, orderID int, amount float64) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_activities (user_id, activity_type, activity_date, activity_value, order_id)
+		VALUES (?, 'purchase', NOW(), ?, ?)
+	`, userID, amount, orderID)
+
+	return err
+}
+
+// GetUserActivities retrieves recent activities for a user, without the purchases of
+// cancelled and refunded orders
+func (s *MySQLStore) GetUserActivities(userID int, limit int) ([]UserActivity, error) {
+	rows, err := s.db.Query(`
+		SELECT a.activity_type, a.activity_date, a.activity_value, a.order_id
+		FROM user_activities a
+		LEFT JOIN orders o ON o.order_id = a.order_id
+		WHERE a.user_id = ? AND (o.status IS NULL OR o.status NOT IN ('cancelled', 'refunded'))
+		ORDER BY a.activity_date DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []UserActivity
+
+	for rows.Next() {
+		var activity UserActivity
+		var orderID sql.NullInt64
+		err := rows.Scan(&activity.ActivityType, &activity.ActivityDate, &activity.ActivityValue, &orderID)
+		if err != nil {
+			return nil, err
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			activity.OrderID = &id
+		}
+		activities = append(activities, activity)
+	}
+
+	return activities, nil
+}
+
+// SaveStreakPrediction saves a prediction to the database
+func (s *MySQLStore) SaveStreakPrediction(prediction StreakPrediction) error {
+	_, err := s.db.Exec(`
+		INSERT INTO streak_predictions 
+		(user_id, prediction_date, probability_of_streak_drop, predicted_days_to_streak_drop, risk_level, confidence)
+		VALUES (?, NOW(), ?, ?, ?, ?)
+	`, prediction.UserID, prediction.ProbabilityOfStreakDrop, prediction.PredictedDaysToStreakDrop,
+		prediction.RiskLevel, prediction.Confidence)
+
+	return err
+}
+
+// GetStreakPredictions retrieves predictions for a user
+func (s *MySQLStore) GetStreakPredictions(userID int, limit int) ([]StreakPrediction, error) {
+	rows, err := s.db.Query(`
+		SELECT user_id, probability_of_streak_drop, predicted_days_to_streak_drop, 
+		       risk_level, confidence, actual_streak_dropped
+		FROM streak_predictions
+		WHERE user_id = ?
+		ORDER BY prediction_date DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var predictions []StreakPrediction
+	for rows.Next() {
+		var pred StreakPrediction
+		var actualDropped sql.NullBool
+		err := rows.Scan(&pred.UserID, &pred.ProbabilityOfStreakDrop, &pred.PredictedDaysToStreakDrop,
+			&pred.RiskLevel, &pred.Confidence, &actualDropped)
+		if err != nil {
+			return nil, err
+		}
+		predictions = append(predictions, pred)
+	}
+
+	return predictions, nil
+}
+
+// SaveStreakModel saves a trained model to the database
+func (s *MySQLStore) SaveStreakModel(model StreakModel) error {
+	paramsJSON, err := json.Marshal(model.Parameters)
+	if err != nil {
+		return err
+	}
+
+	featuresJSON, err := json.Marshal(model.FeatureNames)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO streak_models (model_type, version, training_date, accuracy, parameters, feature_names, is_active)
+		VALUES (?, ?, ?, ?, ?, ?, TRUE)
+	`, model.ModelType, model.Version, model.TrainingDate, model.Accuracy, paramsJSON, featuresJSON)
+
+	return err
+}
+
+// GetActiveStreakModel retrieves the currently active model
+func (s *MySQLStore) GetActiveStreakModel() (*StreakModel, error) {
+	var model StreakModel
+	var paramsJSON, featuresJSON []byte
+
+	err := s.db.QueryRow(`
+		SELECT model_type, version, training_date, accuracy, parameters, feature_names
+		FROM streak_models
+		WHERE is_active = TRUE
+		ORDER BY training_date DESC
+		LIMIT 1
+	`).Scan(&model.ModelType, &model.Version, &model.TrainingDate, &model.Accuracy, &paramsJSON, &featuresJSON)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON fields
+	if err := json.Unmarshal(paramsJSON, &model.Parameters); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(featuresJSON, &model.FeatureNames); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+// OpenMySQL opens and verifies a MySQL database connection
+func OpenMySQL(dataSourceName string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %w", err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to the database: %w", err)
+	}
+	fmt.Println("Successfully connected to MySQL database!")
+	return db, nil
+}
+
+// NewMySQLStore opens the MySQL database connection and applies pending schema migrations
+func NewMySQLStore(dataSourceName string) (*MySQLStore, error) {
+	db, err := OpenMySQL(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := MigrateUp(db, 0); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &MySQLStore{db: db}, nil
+}
+
+// InsertSampleData inserts sample data into the database
+func (s *MySQLStore) InsertSampleData() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	users, preferences, err := sampleData()
+	if err != nil {
+		return fmt.Errorf("error preparing sample data: %w", err)
+	}
+
+	for _, u := range users {
+		_, err = tx.Exec("INSERT IGNORE INTO users (user_id, username, email, password_hash, last_login, registered_date) VALUES (?, ?, ?, ?, ?, ?)",
+			u.UserID, u.Username, u.Email, u.PasswordHash, u.LastLogin, u.RegisteredDate)
+		if err != nil {
+			return fmt.Errorf("error inserting user %s: %w", u.Username, err)
+		}
+		if err := insertUserRoles(tx, u.UserID, u.Roles); err != nil {
+			return err
+		}
+	}
+
+	// Insert user preferences (simulated AI output)
+	for _, p := range preferences {
+		_, err = tx.Exec("INSERT IGNORE INTO user_preferences (user_id, churn_risk) VALUES (?, ?)", p.UserID, p.ChurnRisk)
+		if err != nil {
+			return fmt.Errorf("error inserting user preferences for user %d: %w", p.UserID, err)
+		}
+		for position, categoryID := range p.PreferredCategoryIDs {
+			_, err = tx.Exec("INSERT IGNORE INTO user_preferred_categories (user_id, category_id, position) VALUES (?, ?, ?)",
+				p.UserID, categoryID, position)
+			if err != nil {
+				return fmt.Errorf("error inserting preferred categories for user %d: %w", p.UserID, err)
+			}
+		}
+	}
+
+	for _, p := range sampleProducts() {
+		_, err = tx.Exec("INSERT IGNORE INTO products (product_id, product_name, search_name, category_id, price, stock_quantity, low_stock_threshold) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			p.ProductID, p.ProductName, foldVietnamese(p.ProductName), p.CategoryID, p.Price, p.StockQuantity, p.LowStockThreshold)
+		if err != nil {
+			return fmt.Errorf("error inserting product %s: %w", p.ProductName, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	fmt.Println("Sample data inserted successfully.")
+	return nil
+}
+
+// userRolesColumn selects a user's roles as a comma-separated list, for queries FROM users
+const userRolesColumn = "(SELECT GROUP_CONCAT(role_name ORDER BY role_name) FROM user_roles WHERE user_roles.user_id = users.user_id)"
+
+// userColumns is the column list scanned by scanUser
+const userColumns = "user_id, username, email, password_hash, last_login, registered_date, " + userRolesColumn
+
+// scanUser scans a row selected with userColumns
+func scanUser(row *sql.Row) (*User, error) {
+	var user User
+	var lastLogin sql.NullTime
+	var roles sql.NullString
+
+	err := row.Scan(&user.UserID, &user.Username, &user.Email, &user.PasswordHash, &lastLogin, &user.RegisteredDate, &roles)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastLogin.Valid {
+		user.LastLogin = &lastLogin.Time
+	}
+	user.Roles = splitRoles(roles)
+	return &user, nil
+}
+
+// splitRoles parses the result of userRolesColumn
+func splitRoles(roles sql.NullString) []string {
+	if !roles.Valid || roles.String == "" {
+		return []string{}
+	}
+	return strings.Split(roles.String, ",")
+}
+
+// insertUserRoles adds roles to a user inside a transaction; no roles means customer
+func insertUserRoles(tx *sql.Tx, userID int, roles []string) error {
+	if len(roles) == 0 {
+		roles = []string{RoleCustomer}
+	}
+	for _, role := range roles {
+		if _, err := tx.Exec("INSERT IGNORE INTO user_roles (user_id, role_name) VALUES (?, ?)", userID, role); err != nil {
+			return fmt.Errorf("error assigning role %s to user %d: %w", role, userID, err)
+		}
+	}
+	return nil
+}
+
+// SetUserRoles replaces a user's roles
+func (s *MySQLStore) SetUserRoles(userID int, roles []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error clearing roles: %w", err)
+	}
+	if err := insertUserRoles(tx, userID, roles); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateUser inserts a user with empty preferences and a fresh streak in one transaction
+func (s *MySQLStore) CreateUser(user User) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	result, err := tx.Exec("INSERT INTO users (username, email, password_hash, registered_date) VALUES (?, ?, ?, ?)",
+		user.Username, user.Email, user.PasswordHash, user.RegisteredDate)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 { // ER_DUP_ENTRY
+			if strings.Contains(mysqlErr.Message, "uq_users_username") {
+				return 0, ErrUsernameTaken
+			}
+			return 0, ErrEmailTaken
+		}
+		return 0, fmt.Errorf("error inserting user: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading new user id: %w", err)
+	}
+	userID := int(id)
+
+	if err := insertUserRoles(tx, userID, user.Roles); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO user_preferences (user_id, churn_risk) VALUES (?, 0)", userID)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting user preferences: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_streaks (user_id, current_streak, longest_streak, last_activity_date, streak_type, is_active)
+		VALUES (?, 0, 0, ?, 'engagement', TRUE)
+	`, userID, user.RegisteredDate)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting user streak: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// GetUserByID retrieves a user by their ID
+func (s *MySQLStore) GetUserByID(userID int) (*User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE user_id = ?", userID))
+	if err == sql.ErrNoRows {
+		return nil, nil // User not found
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching user by id: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByEmail retrieves a user by their email
+func (s *MySQLStore) GetUserByEmail(email string) (*User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = ?", email))
+	if err == sql.ErrNoRows {
+		return nil, nil // User not found
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching user by email: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user by their username
+func (s *MySQLStore) GetUserByUsername(username string) (*User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", username))
+	if err == sql.ErrNoRows {
+		return nil, nil // User not found
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching user by username: %w", err)
+	}
+	return user, nil
+}
+
+// UpdateUserPasswordHash replaces the stored password hash for a user
+func (s *MySQLStore) UpdateUserPasswordHash(userID int, passwordHash string) error {
+	_, err := s.db.Exec("UPDATE users SET password_hash = ? WHERE user_id = ?", passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password hash: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserLastLogin updates the last_login timestamp for a user
+func (s *MySQLStore) UpdateUserLastLogin(userID int, loginTime time.Time) error {
+	_, err := s.db.Exec("UPDATE users SET last_login = ? WHERE user_id = ?", loginTime, userID)
+	if err != nil {
+		return fmt.Errorf("error updating last login: %w", err)
+	}
+	return nil
+}
+
+// SaveRefreshToken stores a newly issued refresh token
+func (s *MySQLStore) SaveRefreshToken(token RefreshToken) error {
+	_, err := s.db.Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, issued_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, token.UserID, token.FamilyID, token.TokenHash, token.IssuedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error saving refresh token: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by the hash of its value
+func (s *MySQLStore) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	var rotatedAt, revokedAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT token_id, user_id, family_id, token_hash, issued_at, expires_at, rotated_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ?
+	`, tokenHash).Scan(&token.TokenID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.IssuedAt, &token.ExpiresAt, &rotatedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching refresh token: %w", err)
+	}
+
+	if rotatedAt.Valid {
+		token.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenRotated flags a refresh token as used if it is still active
+func (s *MySQLStore) MarkRefreshTokenRotated(tokenID int, rotatedAt time.Time) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE refresh_tokens SET rotated_at = ?
+		WHERE token_id = ? AND rotated_at IS NULL AND revoked_at IS NULL
+	`, rotatedAt, tokenID)
+	if err != nil {
+		return false, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token in a refresh token family
+func (s *MySQLStore) RevokeRefreshTokenFamily(familyID string, revokedAt time.Time) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", revokedAt, familyID)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh token family: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every active refresh token of a user, logging out all sessions
+func (s *MySQLStore) RevokeUserRefreshTokens(userID int, revokedAt time.Time) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// SavePasswordResetToken stores a newly issued password reset token
+func (s *MySQLStore) SavePasswordResetToken(token PasswordResetToken) error {
+	_, err := s.db.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, token.UserID, token.TokenHash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error saving password reset token: %w", err)
+	}
+	return nil
+}
+
+// GetPasswordResetTokenByHash retrieves a password reset token by the hash of its value
+func (s *MySQLStore) GetPasswordResetTokenByHash(tokenHash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	var usedAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT token_id, user_id, token_hash, created_at, expires_at, used_at
+		FROM password_reset_tokens WHERE token_hash = ?
+	`, tokenHash).Scan(&token.TokenID, &token.UserID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching password reset token: %w", err)
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return &token, nil
+}
+
+// GetLatestPasswordResetToken retrieves the password reset token most recently issued to a user
+func (s *MySQLStore) GetLatestPasswordResetToken(userID int) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	var usedAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT token_id, user_id, token_hash, created_at, expires_at, used_at
+		FROM password_reset_tokens WHERE user_id = ?
+		ORDER BY created_at DESC, token_id DESC LIMIT 1
+	`, userID).Scan(&token.TokenID, &token.UserID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching latest password reset token: %w", err)
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return &token, nil
+}
+
+// MarkPasswordResetTokenUsed flags a password reset token as used if it hasn't been used yet
+func (s *MySQLStore) MarkPasswordResetTokenUsed(tokenID int, usedAt time.Time) (bool, error) {
+	result, err := s.db.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE token_id = ? AND used_at IS NULL", usedAt, tokenID)
+	if err != nil {
+		return false, fmt.Errorf("error using password reset token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error using password reset token: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// MarkUserPasswordResetTokensUsed flags every unused password reset token of a user as used
+func (s *MySQLStore) MarkUserPasswordResetTokensUsed(userID int, usedAt time.Time) error {
+	_, err := s.db.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", usedAt, userID)
+	if err != nil {
+		return fmt.Errorf("error using password reset tokens: %w", err)
+	}
+	return nil
+}
+
+// GetUserMFA retrieves a user's TOTP enrolment, or nil if there is none
+func (s *MySQLStore) GetUserMFA(userID int) (*UserMFA, error) {
+	mfa := UserMFA{UserID: userID}
+	var enabledAt sql.NullTime
+
+	err := s.db.QueryRow("SELECT totp_secret, created_at, enabled_at, last_used_step FROM user_mfa WHERE user_id = ?", userID).Scan(
+		&mfa.TOTPSecret, &mfa.CreatedAt, &enabledAt, &mfa.LastUsedStep,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching user MFA: %w", err)
+	}
+
+	if enabledAt.Valid {
+		mfa.EnabledAt = &enabledAt.Time
+	}
+	return &mfa, nil
+}
+
+// SaveUserMFASecret starts (or restarts) a pending TOTP enrolment
+func (s *MySQLStore) SaveUserMFASecret(userID int, secret string, createdAt time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_mfa (user_id, totp_secret, created_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE totp_secret = VALUES(totp_secret), created_at = VALUES(created_at),
+		enabled_at = NULL, last_used_step = 0
+	`, userID, secret, createdAt)
+	if err != nil {
+		return fmt.Errorf("error saving MFA secret: %w", err)
+	}
+	return nil
+}
+
+// EnableUserMFA confirms a TOTP enrolment and replaces the user's recovery codes
+func (s *MySQLStore) EnableUserMFA(userID int, enabledAt time.Time, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec("UPDATE user_mfa SET enabled_at = ? WHERE user_id = ?", enabledAt, userID); err != nil {
+		return fmt.Errorf("error enabling MFA: %w", err)
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// DisableUserMFA removes a user's TOTP enrolment and recovery codes
+func (s *MySQLStore) DisableUserMFA(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error disabling MFA: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// MarkTOTPStepUsed records an accepted TOTP step unless it (or a later one) was already used
+func (s *MySQLStore) MarkTOTPStepUsed(userID int, step int64) (bool, error) {
+	result, err := s.db.Exec("UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?", step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error recording TOTP step: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error recording TOTP step: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones
+func (s *MySQLStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes swaps a user's recovery codes inside a transaction
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return fmt.Errorf("error inserting recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code
+func (s *MySQLStore) UseRecoveryCode(userID int, codeHash string, usedAt time.Time) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, usedAt, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes a user has left
+func (s *MySQLStore) CountUnusedRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// apiKeyColumns is the column list scanned by scanAPIKey
+const apiKeyColumns = "key_id, name, key_prefix, key_hash, scopes, created_by, created_at, last_used_at, revoked_at"
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(scan func(dest ...interface{}) error) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := scan(&key.KeyID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy, &key.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+// CreateAPIKey stores a new API key and returns its ID
+func (s *MySQLStore) CreateAPIKey(key APIKey) (int, error) {
+	result, err := s.db.Exec(`
+		INSERT INTO api_keys (name, key_prefix, key_hash, scopes, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.CreatedBy, key.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("error saving API key: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading new API key id: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its value
+func (s *MySQLStore) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", keyHash).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching API key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys retrieves all API keys, newest first
+func (s *MySQLStore) ListAPIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY created_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			log.Printf("Error scanning API key: %v", err)
+			continue
+		}
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key if it is still active
+func (s *MySQLStore) RevokeAPIKey(keyID int, revokedAt time.Time) (bool, error) {
+	result, err := s.db.Exec("UPDATE api_keys SET revoked_at = ? WHERE key_id = ? AND revoked_at IS NULL", revokedAt, keyID)
+	if err != nil {
+		return false, fmt.Errorf("error revoking API key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error revoking API key: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *MySQLStore) TouchAPIKey(keyID int, usedAt time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE key_id = ?", usedAt, keyID)
+	if err != nil {
+		return fmt.Errorf("error updating API key last use: %w", err)
+	}
+	return nil
+}
+
+// GetUserByIdentity retrieves the user linked to an external OIDC identity
+func (s *MySQLStore) GetUserByIdentity(issuer, subject string) (*User, error) {
+	user, err := scanUser(s.db.QueryRow(`
+		SELECT `+userColumns+` FROM users
+		WHERE user_id = (SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?)
+	`, issuer, subject))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching user by identity: %w", err)
+	}
+	return user, nil
+}
+
+// LinkUserIdentity links an external OIDC identity to a user
+func (s *MySQLStore) LinkUserIdentity(identity UserIdentity) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, identity.UserID, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error linking user identity: %w", err)
+	}
+	return nil
+}
+
+// SaveOIDCLoginRequest stores a pending OIDC login and drops expired ones
+func (s *MySQLStore) SaveOIDCLoginRequest(req OIDCLoginRequest) error {
+	if _, err := s.db.Exec("DELETE FROM oidc_login_requests WHERE expires_at < ?", req.CreatedAt); err != nil {
+		return fmt.Errorf("error deleting expired OIDC login requests: %w", err)
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO oidc_login_requests (state_hash, code_verifier, nonce, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, req.StateHash, req.CodeVerifier, req.Nonce, req.CreatedAt, req.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error saving OIDC login request: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginRequest deletes and returns a pending OIDC login
+func (s *MySQLStore) ConsumeOIDCLoginRequest(stateHash string) (*OIDCLoginRequest, error) {
+	req := OIDCLoginRequest{StateHash: stateHash}
+	err := s.db.QueryRow(
+		"SELECT code_verifier, nonce, created_at, expires_at FROM oidc_login_requests WHERE state_hash = ?", stateHash,
+	).Scan(&req.CodeVerifier, &req.Nonce, &req.CreatedAt, &req.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching OIDC login request: %w", err)
+	}
+
+	// Only the request that actually deletes the row may use it
+	result, err := s.db.Exec("DELETE FROM oidc_login_requests WHERE state_hash = ?", stateHash)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming OIDC login request: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error consuming OIDC login request: %w", err)
+	}
+	if affected != 1 {
+		return nil, nil
+	}
+	return &req, nil
+}
+
+// GetLoginAttempt retrieves the failed login counter for a key
+func (s *MySQLStore) GetLoginAttempt(key string) (*LoginAttempt, error) {
+	attempt := LoginAttempt{Key: key}
+	var lockedUntil sql.NullTime
+
+	err := s.db.QueryRow("SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE attempt_key = ?", key).Scan(
+		&attempt.Failures, &attempt.LastFailureAt, &lockedUntil,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching login attempt: %w", err)
+	}
+
+	if lockedUntil.Valid {
+		attempt.LockedUntil = &lockedUntil.Time
+	}
+	return &attempt, nil
+}
+
+// IncrementLoginFailures atomically counts a failed login for a key
+func (s *MySQLStore) IncrementLoginFailures(key string, now, windowStart time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	// MySQL applies assignments left to right, so failures is computed from the old last_failure_at
+	_, err = tx.Exec(`
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON DUPLICATE KEY UPDATE
+		failures = IF(last_failure_at < ?, 1, failures + 1),
+		last_failure_at = VALUES(last_failure_at)
+	`, key, now, windowStart)
+	if err != nil {
+		return 0, fmt.Errorf("error recording login failure: %w", err)
+	}
+
+	var failures int
+	if err := tx.QueryRow("SELECT failures FROM login_attempts WHERE attempt_key = ?", key).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("error reading login failures: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return failures, nil
+}
+
+// SetLoginLockout blocks logins for a key until the given time
+func (s *MySQLStore) SetLoginLockout(key string, lockedUntil time.Time) error {
+	_, err := s.db.Exec("UPDATE login_attempts SET locked_until = ? WHERE attempt_key = ?", lockedUntil, key)
+	if err != nil {
+		return fmt.Errorf("error setting login lockout: %w", err)
+	}
+	return nil
+}
+
+// ResetLoginAttempts clears the failure counter and any lockout for a key
+func (s *MySQLStore) ResetLoginAttempts(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	if err != nil {
+		return fmt.Errorf("error resetting login attempts: %w", err)
 	}
 	return nil
 }
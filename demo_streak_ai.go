@@ -8,7 +8,7 @@ import (
 
 // DemoStreakAI demonstrates the AI streak prediction system
 func DemoStreakAI() {
-	fmt.Println("=== AI Streak Drop Prediction System Demo ===\n")
+	fmt.Print("=== AI Streak Drop Prediction System Demo ===\n\n")
 
 	// Initialize the AI model
 	fmt.Println("1. Initializing AI Model...")
@@ -38,17 +38,16 @@ func DemoStreakAI() {
 			Email:          "demo@example.com",
 			RegisteredDate: time.Now().Add(-180 * 24 * time.Hour), // 6 months ago
 		},
-		RecentOrders: []struct {
-			OrderDate   time.Time
-			Category    string
-			ProductName string
-		}{
-			{OrderDate: time.Now().Add(-5 * 24 * time.Hour), Category: "Thời trang nữ", ProductName: "Áo Khoác"},
-			{OrderDate: time.Now().Add(-15 * 24 * time.Hour), Category: "Thời trang nữ", ProductName: "Váy Hoa"},
-			{OrderDate: time.Now().Add(-30 * 24 * time.Hour), Category: "Giày dép nữ", ProductName: "Giày Cao Gót"},
+		RecentOrders: []Order{
+			{OrderDate: time.Now().Add(-5 * 24 * time.Hour), Status: OrderPaid, TotalPrice: 450000, Items: []OrderItem{{CategoryID: 2, ProductName: "Áo Khoác", Quantity: 1, UnitPrice: 450000, LineTotal: 450000}}},
+			{OrderDate: time.Now().Add(-15 * 24 * time.Hour), Status: OrderPaid, TotalPrice: 600000, Items: []OrderItem{
+				{CategoryID: 2, ProductName: "Váy Hoa", Quantity: 1, UnitPrice: 400000, LineTotal: 400000},
+				{CategoryID: 2, ProductName: "Khăn Lụa", Quantity: 2, UnitPrice: 100000, LineTotal: 200000},
+			}},
+			{OrderDate: time.Now().Add(-30 * 24 * time.Hour), Status: OrderPaid, TotalPrice: 700000, Items: []OrderItem{{CategoryID: 5, ProductName: "Giày Cao Gót", Quantity: 1, UnitPrice: 700000, LineTotal: 700000}}},
 		},
-		PreferredCategories: []string{"Thời trang nữ", "Giày dép nữ"},
-		ChurnRisk:           0.75, // High churn risk
+		PreferredCategoryIDs: []int{2, 5}, // Thời trang nữ, Giày dép nữ
+		ChurnRisk:            0.75,        // High churn risk
 	}
 	fmt.Println("   ✓ Sample user data created")
 
@@ -67,6 +66,9 @@ func DemoStreakAI() {
 		ChurnRisk:                0.75,
 		PreferredCategoriesCount: 2,
 		LastOrderDaysAgo:         5,
+		OrderFrequency:           1.5,
+		AverageBasketSize:        1.3,
+		SpendTrend:               -0.4,
 		SeasonalFactor:           1.0,
 		WeekendActivityRatio:     0.4,
 		EveningActivityRatio:     0.6,
@@ -96,6 +98,7 @@ func DemoStreakAI() {
 	fmt.Printf("  • Average streak length: %.1f\n", features.AverageStreakLength)
 	fmt.Printf("  • Streak break frequency: %.1f%%\n", features.StreakBreakFrequency*100)
 	fmt.Printf("  • Last order days ago: %d\n", features.LastOrderDaysAgo)
+	fmt.Printf("  • Spend trend: %+.2f\n", features.SpendTrend)
 	fmt.Printf("  • Churn risk: %.1f%%\n", features.ChurnRisk*100)
 
 	fmt.Println("\nRecommended Actions:")
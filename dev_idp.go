@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The stand-in identity provider is served by this server under /dev-idp when
+// OIDC_DEV_IDP=true, so the OIDC login can be tried without a corporate IdP
+const (
+	devIdPIssuer   = "http://localhost:8080/dev-idp"
+	devIdPClientID = "tic-dev"
+	devIdPCodeTTL  = time.Minute
+	devIdPTokenTTL = 5 * time.Minute
+)
+
+// devAuthCode is an authorization code issued by the dev IdP, with what it was issued for
+type devAuthCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+	emailVerified bool
+	name          string
+	expiresAt     time.Time
+}
+
+// DevIdentityProvider is a minimal OpenID Connect provider for local development and
+// testing. It logs in whoever types an email address and signs ID tokens with a key
+// generated at startup. Never enable it in production.
+type DevIdentityProvider struct {
+	issuer string
+	kid    string
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]devAuthCode
+}
+
+// NewDevIdentityProvider creates a stand-in provider with a fresh RSA signing key
+func NewDevIdentityProvider(issuer string) (*DevIdentityProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("error generating dev IdP key: %w", err)
+	}
+	return &DevIdentityProvider{
+		issuer: issuer,
+		kid:    "dev-" + newTokenID()[:8],
+		key:    key,
+		codes:  make(map[string]devAuthCode),
+	}, nil
+}
+
+// DiscoveryHandler serves /.well-known/openid-configuration
+func (p *DevIdentityProvider) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"claims_supported":                      []string{"sub", "email", "email_verified", "name"},
+	})
+}
+
+// JWKSHandler serves the public signing key
+func (p *DevIdentityProvider) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pub := p.key.PublicKey
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: p.kid,
+			Use: "sig",
+			Alg: jwt.SigningMethodRS256.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// devLoginForm asks for the identity to log in as, resubmitting the authorization request
+var devLoginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Dev IdP login</title></head>
+<body>
+<h1>Dev identity provider</h1>
+<p>Local stand-in for the corporate IdP. Any email address is accepted.</p>
+<form method="get">
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<p><label>Email <input type="email" name="login_hint" required></label></p>
+<p><label>Name <input type="text" name="name"></label></p>
+<p><label>Email verified <select name="email_verified"><option value="true">yes</option><option value="false">no</option></select></label></p>
+<p><button type="submit">Log in</button></p>
+</form>
+</body></html>
+`))
+
+// AuthorizeHandler runs the authorization endpoint. Without login_hint it shows a login
+// form; with it, the user is logged in and sent back with a code right away.
+func (p *DevIdentityProvider) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "redirect_uri must be an absolute URL", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("client_id") == "" {
+		http.Error(w, "response_type=code and client_id are required", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with code_challenge_method=S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(q.Get("login_hint")))
+	if email == "" {
+		params := url.Values{}
+		for name, values := range q {
+			if name != "login_hint" && name != "name" && name != "email_verified" {
+				params[name] = values
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		devLoginForm.Execute(w, map[string]interface{}{"Params": params})
+		return
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		http.Error(w, "login_hint must be an email address", http.StatusBadRequest)
+		return
+	}
+
+	code := newTokenID()
+	p.mu.Lock()
+	for c, issued := range p.codes {
+		if time.Now().After(issued.expiresAt) {
+			delete(p.codes, c)
+		}
+	}
+	p.codes[code] = devAuthCode{
+		clientID:      q.Get("client_id"),
+		redirectURI:   redirectURI.String(),
+		codeChallenge: q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+		email:         email,
+		emailVerified: q.Get("email_verified") != "false",
+		name:          strings.TrimSpace(q.Get("name")),
+		expiresAt:     time.Now().Add(devIdPCodeTTL),
+	}
+	p.mu.Unlock()
+	log.Printf("Dev IdP: logged in %s for client %s", email, q.Get("client_id"))
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	if state := q.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// TokenHandler redeems an authorization code for an ID token after checking the PKCE verifier
+func (p *DevIdentityProvider) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", "malformed form body")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if basicID, _, ok := r.BasicAuth(); ok && clientID == "" {
+		clientID, _ = url.QueryUnescape(basicID)
+	}
+
+	// Codes are single-use: remove it before checking anything else
+	p.mu.Lock()
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(code.expiresAt) {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	if code.clientID != clientID || code.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "client_id or redirect_uri does not match the authorization request")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(pkceChallenge(r.PostForm.Get("code_verifier"))), []byte(code.codeChallenge)) != 1 {
+		tokenError(w, "invalid_grant", "code_verifier does not match code_challenge")
+		return
+	}
+
+	now := time.Now()
+	claims := OIDCClaims{
+		Email:         code.email,
+		EmailVerified: code.emailVerified,
+		Name:          code.name,
+		Nonce:         code.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.issuer,
+			Subject:   devSubject(code.email),
+			Audience:  jwt.ClaimStrings{code.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(devIdPTokenTTL)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		log.Printf("Dev IdP: error signing ID token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Dev IdP: error generating access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(devIdPTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// devSubject derives a stable subject identifier from the email, like a real IdP's user ID
+func devSubject(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return "dev-" + hex.EncodeToString(sum[:8])
+}
+
+// tokenError writes an OAuth 2.0 token endpoint error response (RFC 6749 section 5.2)
+func tokenError(w http.ResponseWriter, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DevUser is a development login seeded when SEED_DEV_USERS=true
+type DevUser struct {
+	Username string
+	Email    string
+	Password string
+	Roles    []string
+}
+
+// devUsers are the accounts used by test_api.sh and the API docs.
+// They replace the old hardcoded credential map in api.go and live in the users
+// table like any other account, so the real LoginHandler authenticates them.
+// The store assigns their IDs, so they never collide with registered users.
+var devUsers = []DevUser{
+	{Username: "admin", Email: "admin@example.com", Password: "admin123", Roles: []string{RoleCustomer, RoleAdmin}},
+	{Username: "user1", Email: "user1@example.com", Password: "password1"},
+	{Username: "demo", Email: "demo@example.com", Password: "demo123"},
+	{Username: "testuser", Email: "testuser@example.com", Password: "testpass"},
+	{Username: "john_doe", Email: "john_doe@example.com", Password: "john123"},
+	{Username: "marketer", Email: "marketer@example.com", Password: "marketer123", Roles: []string{RoleCustomer, RoleMarketer}},
+	{Username: "analyst", Email: "analyst@example.com", Password: "analyst123", Roles: []string{RoleCustomer, RoleAnalyst}},
+	{Username: "support", Email: "support@example.com", Password: "support123", Roles: []string{RoleCustomer, RoleSupport}},
+}
+
+// SeedDevUsers creates the dev users that don't exist yet and prints the ID each
+// login actually has. A dev user whose username or email belongs to another
+// account is reported instead of silently skipped.
+func SeedDevUsers() error {
+	fmt.Println("Development users (username / password):")
+	for _, d := range devUsers {
+		userID, err := seedDevUser(d)
+		if errors.Is(err, ErrUsernameTaken) || errors.Is(err, ErrEmailTaken) {
+			fmt.Printf("  %s / %s (not seeded: %v)\n", d.Username, d.Password, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("  %s / %s (ID: %d)\n", d.Username, d.Password, userID)
+	}
+	return nil
+}
+
+// seedDevUser returns the ID of the dev user, creating the account when neither its
+// username nor its email is in use. An existing account counts as seeded only when
+// both match, since its password is then the fixture's unless someone changed it.
+func seedDevUser(d DevUser) (int, error) {
+	existing, err := store.GetUserByUsername(d.Username)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		if !strings.EqualFold(existing.Email, d.Email) {
+			return 0, ErrUsernameTaken
+		}
+		return existing.UserID, nil
+	}
+
+	passwordHash, err := HashPassword(d.Password)
+	if err != nil {
+		return 0, fmt.Errorf("error hashing password for dev user %s: %w", d.Username, err)
+	}
+	return store.CreateUser(User{
+		Username:       d.Username,
+		Email:          d.Email,
+		PasswordHash:   passwordHash,
+		RegisteredDate: time.Now(),
+		Roles:          d.Roles,
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSeedDevUsersAfterRegistrations(t *testing.T) {
+	useMemoryStore(t)
+	// Registered users take the IDs fixtures used to hard-code
+	for _, name := range []string{"alice", "bob", "carol"} {
+		createTestUser(t, name, "unused")
+	}
+	taken := createTestUser(t, "demo", "unused")
+
+	if err := SeedDevUsers(); err != nil {
+		t.Fatalf("SeedDevUsers: %v", err)
+	}
+	// Seeding again leaves the accounts alone
+	if err := SeedDevUsers(); err != nil {
+		t.Fatalf("SeedDevUsers again: %v", err)
+	}
+
+	rec := postJSON(t, LoginHandler, "/api/login", LoginRequest{Username: "user1", Password: "password1"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("user1 login: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	admin, _ := store.GetUserByUsername("admin")
+	if admin == nil || !rolesGrant(admin.Roles, PermUsersManage) {
+		t.Errorf("admin was not seeded with the admin role: %+v", admin)
+	}
+
+	// The registered "demo" keeps its account and password
+	demo, _ := store.GetUserByUsername("demo")
+	if demo.UserID != taken.UserID || demo.PasswordHash != "unused" {
+		t.Errorf("registered demo account was overwritten: %+v", demo)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// writeCachedJSON writes v as JSON with a strong ETag computed from the body, and a
+// Last-Modified header unless lastModified is zero. Clients that already hold this
+// representation (If-None-Match, or If-Modified-Since when no ETag is sent) get an
+// empty 304 Not Modified instead.
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, v interface{}, lastModified time.Time) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n') // same output as json.NewEncoder(w).Encode
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "no-cache") // may be stored, but must be revalidated before reuse
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// notModified evaluates the conditional request headers (RFC 9110 section 13.2.2):
+// If-None-Match takes precedence over If-Modified-Since
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// If-None-Match uses the weak comparison, so W/"x" matches "x"
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		// HTTP dates have one-second resolution
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// getWithHeaders runs handler for GET path with the given request headers; id, when
+// positive, is the {id} path value
+func getWithHeaders(handler http.HandlerFunc, path string, id int, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if id > 0 {
+		req.SetPathValue("id", strconv.Itoa(id))
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestNotModified(t *testing.T) {
+	const etag = `"abc123"`
+	modified := time.Date(2025, 3, 1, 10, 30, 15, 500_000_000, time.UTC)
+	httpDate := func(t time.Time) string { return t.UTC().Format(http.TimeFormat) }
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		lastModified time.Time
+		want         bool
+	}{
+		{"no conditional headers", nil, modified, false},
+		{"matching ETag", map[string]string{"If-None-Match": etag}, modified, true},
+		{"weak form of the ETag", map[string]string{"If-None-Match": `W/"abc123"`}, modified, true},
+		{"ETag in a list", map[string]string{"If-None-Match": `"old", W/"abc123" ,"other"`}, modified, true},
+		{"wildcard", map[string]string{"If-None-Match": "*"}, modified, true},
+		{"other ETag", map[string]string{"If-None-Match": `"old"`}, modified, false},
+		{"not modified since", map[string]string{"If-Modified-Since": httpDate(modified)}, modified, true},
+		{"modified since", map[string]string{"If-Modified-Since": httpDate(modified.Add(-time.Second))}, modified, false},
+		{"If-Modified-Since without Last-Modified", map[string]string{"If-Modified-Since": httpDate(modified)}, time.Time{}, false},
+		{"If-None-Match wins over If-Modified-Since", map[string]string{
+			"If-None-Match": `"old"`, "If-Modified-Since": httpDate(modified.Add(time.Hour))}, modified, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := notModified(req, etag, tt.lastModified); got != tt.want {
+				t.Errorf("notModified = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetProductHandlerConditional(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	first := getWithHeaders(GetProductHandler, "/api/products/1", 1, nil)
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("status %d, ETag %q, Last-Modified %q; want 200 with both", first.Code, etag, lastModified)
+	}
+
+	rec := getWithHeaders(GetProductHandler, "/api/products/1", 1, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("matching ETag: status %d with %d bytes, want an empty 304", rec.Code, rec.Body.Len())
+	}
+	rec = getWithHeaders(GetProductHandler, "/api/products/1", 1, map[string]string{"If-Modified-Since": lastModified})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: status %d, want 304", rec.Code)
+	}
+
+	// A reservation changes the available stock without touching updated_at
+	_, err := store.ReserveStock(StockReservation{ProductID: 1, UserID: alice.UserID, Quantity: 2,
+		Status: ReservationActive, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("ReserveStock: %v", err)
+	}
+	rec = getWithHeaders(GetProductHandler, "/api/products/1", 1, map[string]string{"If-None-Match": etag, "If-Modified-Since": lastModified})
+	if rec.Code != http.StatusOK {
+		t.Errorf("old ETag after a reservation: status %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("Last-Modified %q sent while stock is reserved", got)
+	}
+	rec = getWithHeaders(GetProductHandler, "/api/products/1", 1, map[string]string{"If-Modified-Since": lastModified})
+	if rec.Code != http.StatusOK {
+		t.Errorf("If-Modified-Since while stock is reserved: status %d, want 200", rec.Code)
+	}
+}
+
+func TestGetProductsHandlerConditional(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+
+	first := getWithHeaders(GetProductsHandler, "/api/products?limit=3", 0, nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status %d, ETag %q; want 200 with an ETag", first.Code, etag)
+	}
+	rec := getWithHeaders(GetProductsHandler, "/api/products?limit=3", 0, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("matching ETag: status %d, want 304", rec.Code)
+	}
+	if rec := getWithHeaders(GetProductsHandler, "/api/products?limit=4", 0, map[string]string{"If-None-Match": etag}); rec.Code != http.StatusOK {
+		t.Errorf("ETag of another page: status %d, want 200", rec.Code)
+	}
+
+	// Any change to a listed product changes the ETag
+	product, _ := store.GetProductByID(1)
+	product.Price++
+	if _, err := store.UpdateProduct(*product, 0); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	if rec := getWithHeaders(GetProductsHandler, "/api/products?limit=3", 0, map[string]string{"If-None-Match": etag}); rec.Code != http.StatusOK {
+		t.Errorf("after a price change: status %d, want 200", rec.Code)
+	}
+}
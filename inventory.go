@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// defaultLowStockThreshold applies to products created without a low_stock_threshold
+	defaultLowStockThreshold = 5
+	// maxReservationQuantity caps the units one reservation can hold, and the units of a
+	// product one user can hold across their active reservations
+	maxReservationQuantity = 100
+	// maxActiveReservationsPerUser caps the active reservations one user can hold, so one
+	// account can't keep the catalogue's stock held
+	maxActiveReservationsPerUser = 10
+	// defaultStockReservationTTL is how long a reservation holds stock before it lapses by itself
+	defaultStockReservationTTL = 15 * time.Minute
+)
+
+// stockReservationTTL is STOCK_RESERVATION_TTL, read at startup by loadDurations
+var stockReservationTTL = defaultStockReservationTTL
+
+// stockedCategories returns the IDs of the categories with available stock, counting a
+// category as stocked when any of its subcategories is
+func stockedCategories() (map[int]bool, error) {
+	available, err := store.GetAvailableStockByCategory()
+	if err != nil {
+		return nil, err
+	}
+	categories, err := store.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	stocked := make(map[int]bool)
+	for _, c := range categories {
+		for _, id := range categoryWithDescendants(categories, c.CategoryID) {
+			if available[id] > 0 {
+				stocked[c.CategoryID] = true
+				break
+			}
+		}
+	}
+	return stocked, nil
+}
+
+// logLowStock logs a low-stock alert when a product has dropped to its threshold
+func logLowStock(product *Product) {
+	if product != nil && product.IsLowStock() {
+		log.Printf("Low stock: product %d (%s) has %d units available (threshold %d)",
+			product.ProductID, product.ProductName, product.AvailableQuantity(), product.LowStockThreshold)
+	}
+}
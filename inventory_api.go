@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UpdateProductStockHandler counts or adjusts a product's stock and its low-stock
+// threshold (PATCH /api/products/{id}/stock)
+func UpdateProductStockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := activeProductFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req StockUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.StockQuantity != nil && req.Adjustment != nil {
+		http.Error(w, "Send either stock_quantity or adjustment, not both", http.StatusBadRequest)
+		return
+	}
+	if req.StockQuantity == nil && req.Adjustment == nil && req.LowStockThreshold == nil {
+		http.Error(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+	if (req.StockQuantity != nil && *req.StockQuantity < 0) || (req.LowStockThreshold != nil && *req.LowStockThreshold < 0) {
+		http.Error(w, "stock_quantity and low_stock_threshold can't be negative", http.StatusBadRequest)
+		return
+	}
+
+	change := StockChange{Quantity: req.StockQuantity, LowStockThreshold: req.LowStockThreshold, ChangedAt: time.Now()}
+	if req.Adjustment != nil {
+		change.Adjustment = *req.Adjustment
+	}
+	updated, err := store.UpdateProductStock(product.ProductID, change)
+	if errors.Is(err, ErrInsufficientStock) {
+		http.Error(w, "Stock can't drop below zero or below the units currently reserved", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error updating stock of product %d: %v", product.ProductID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if updated == nil { // deleted between the lookup and the update
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	log.Printf("Admin %d set the stock of product %d from %d to %d", admin.UserID, product.ProductID, product.StockQuantity, updated.StockQuantity)
+	logLowStock(updated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// LowStockProductsHandler lists the products at or below their low-stock threshold
+// (GET /api/admin/inventory/low-stock)
+func LowStockProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	products, err := store.ListLowStockProducts()
+	if err != nil {
+		log.Printf("Error listing low-stock products: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if products == nil {
+		products = []Product{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"products": products,
+		"total":    len(products),
+	})
+}
+
+// CreateReservationHandler holds units of a product for the logged-in user's checkout
+// (POST /api/products/{id}/reservations). The hold lapses after stockReservationTTL.
+func CreateReservationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := activeProductFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req StockReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Quantity < 1 || req.Quantity > maxReservationQuantity {
+		http.Error(w, fmt.Sprintf("quantity must be between 1 and %d", maxReservationQuantity), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := AuthUserFromContext(r.Context())
+	now := time.Now()
+	reservation := StockReservation{
+		ProductID: product.ProductID,
+		UserID:    user.UserID,
+		Quantity:  req.Quantity,
+		Status:    ReservationActive,
+		CreatedAt: now,
+		ExpiresAt: now.Add(stockReservationTTL),
+	}
+	reservationID, err := store.ReserveStock(reservation)
+	if errors.Is(err, ErrInsufficientStock) {
+		http.Error(w, "Not enough stock available", http.StatusConflict)
+		return
+	} else if errors.Is(err, ErrReservationLimit) {
+		http.Error(w, fmt.Sprintf("You can hold at most %d active reservations and %d units of a product; release one or complete your order first",
+			maxActiveReservationsPerUser, maxReservationQuantity), http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		log.Printf("Error reserving stock of product %d: %v", product.ProductID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	reservation.ReservationID = reservationID
+	if updated, err := store.GetProductByID(product.ProductID); err == nil {
+		logLowStock(updated)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// ReleaseReservationHandler cancels an active reservation, returning its units to stock
+// (DELETE /api/reservations/{id}). Only its owner or a catalogue manager may release it.
+func ReleaseReservationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reservationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || reservationID <= 0 {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+	reservation, err := store.GetStockReservation(reservationID)
+	if err != nil {
+		log.Printf("Error retrieving reservation %d: %v", reservationID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	user, _ := AuthUserFromContext(r.Context())
+	if reservation == nil || (reservation.UserID != user.UserID && !user.HasPermission(PermProductsWrite)) {
+		http.Error(w, "Reservation not found", http.StatusNotFound)
+		return
+	}
+
+	released, err := store.ReleaseStockReservation(reservationID, time.Now())
+	if err != nil {
+		log.Printf("Error releasing reservation %d: %v", reservationID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !released {
+		http.Error(w, "The reservation is no longer active", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"message":        "Reservation released",
+		"reservation_id": reservationID,
+	})
+}
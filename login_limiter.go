@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginPolicy controls how failed logins for one key are throttled.
+// The first FreeFailures failures are free, after that each failure blocks the key
+// for BaseDelay doubled per extra failure (capped at MaxDelay), and reaching
+// LockoutThreshold failures locks it for LockoutDuration. Counters restart after
+// Window without failures.
+type LoginPolicy struct {
+	FreeFailures     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	Window           time.Duration
+}
+
+// blockDuration returns how long a key is blocked after the given number of failures
+func (p LoginPolicy) blockDuration(failures int) time.Duration {
+	if failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeFailures {
+		return 0
+	}
+	shift := failures - p.FreeFailures - 1
+	if shift > 30 {
+		return p.MaxDelay
+	}
+	delay := p.BaseDelay << shift
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// LoginLimiter throttles login attempts per account and per client IP
+type LoginLimiter struct {
+	attempts LoginAttemptStore
+	account  LoginPolicy
+	ip       LoginPolicy
+}
+
+// loginLimiter is the LoginLimiter configured at startup
+var loginLimiter *LoginLimiter
+
+// NewLoginLimiter creates a limiter backed by the given attempt store.
+// LOGIN_LOCKOUT_THRESHOLD (default 10) and LOGIN_LOCKOUT_DURATION (default 15m)
+// configure the per-account lockout.
+func NewLoginLimiter(attempts LoginAttemptStore) (*LoginLimiter, error) {
+	l := &LoginLimiter{
+		attempts: attempts,
+		account: LoginPolicy{
+			FreeFailures:     3,
+			BaseDelay:        time.Second,
+			MaxDelay:         5 * time.Minute,
+			LockoutThreshold: 10,
+			LockoutDuration:  15 * time.Minute,
+			Window:           time.Hour,
+		},
+		// One IP may front many users (NAT, office networks), so it gets more headroom
+		ip: LoginPolicy{
+			FreeFailures:     10,
+			BaseDelay:        time.Second,
+			MaxDelay:         5 * time.Minute,
+			LockoutThreshold: 50,
+			LockoutDuration:  time.Hour,
+			Window:           time.Hour,
+		},
+	}
+
+	if v := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= l.account.FreeFailures {
+			return nil, fmt.Errorf("LOGIN_LOCKOUT_THRESHOLD must be an integer greater than %d", l.account.FreeFailures)
+		}
+		l.account.LockoutThreshold = n
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION %q", v)
+		}
+		l.account.LockoutDuration = d
+	}
+	return l, nil
+}
+
+// accountAttemptKey is the login_attempts key for an account
+func accountAttemptKey(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// ipAttemptKey is the login_attempts key for a client IP
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// CheckIP returns how long logins from this IP are blocked (0 if allowed)
+func (l *LoginLimiter) CheckIP(ip string) (time.Duration, error) {
+	return l.retryAfter(ipAttemptKey(ip))
+}
+
+// CheckAccount returns how long logins to this account are blocked (0 if allowed)
+func (l *LoginLimiter) CheckAccount(userID int) (time.Duration, error) {
+	return l.retryAfter(accountAttemptKey(userID))
+}
+
+// FailIP records a failed login from an IP
+func (l *LoginLimiter) FailIP(ip string) error {
+	return l.fail(ipAttemptKey(ip), l.ip)
+}
+
+// FailAccount records a failed login for an account
+func (l *LoginLimiter) FailAccount(userID int) error {
+	return l.fail(accountAttemptKey(userID), l.account)
+}
+
+// ResetAccount clears failures and lockout for an account, after a successful login or by an admin
+func (l *LoginLimiter) ResetAccount(userID int) error {
+	return l.attempts.ResetLoginAttempts(accountAttemptKey(userID))
+}
+
+// retryAfter returns the remaining block time for a key
+func (l *LoginLimiter) retryAfter(key string) (time.Duration, error) {
+	attempt, err := l.attempts.GetLoginAttempt(key)
+	if err != nil || attempt == nil || attempt.LockedUntil == nil {
+		return 0, err
+	}
+	if remaining := time.Until(*attempt.LockedUntil); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// fail counts a failure for a key and blocks it according to the policy
+func (l *LoginLimiter) fail(key string, policy LoginPolicy) error {
+	now := time.Now()
+	failures, err := l.attempts.IncrementLoginFailures(key, now, now.Add(-policy.Window))
+	if err != nil {
+		return err
+	}
+	if block := policy.blockDuration(failures); block > 0 {
+		return l.attempts.SetLoginLockout(key, now.Add(block))
+	}
+	return nil
+}
+
+// clientIP returns the caller's IP address. X-Forwarded-For is only trusted when
+// TRUST_PROXY_HEADERS=true, i.e. when the API runs behind our own reverse proxies.
+// Every proxy appends the address it received the request from, so the client is the
+// entry TRUSTED_PROXY_HOPS (default 1) from the right. Entries further left come from
+// the client itself and could be forged to dodge the per-IP throttle.
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				forwarded = append(forwarded, strings.TrimSpace(entry))
+			}
+		}
+		if hops := trustedProxyHops(); len(forwarded) >= hops {
+			if ip := forwarded[len(forwarded)-hops]; net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trustedProxyHops returns TRUSTED_PROXY_HOPS, the number of our proxies in front of
+// the API, or 1 if unset or invalid
+func trustedProxyHops() int {
+	if hops, err := strconv.Atoi(os.Getenv("TRUSTED_PROXY_HOPS")); err == nil && hops > 0 {
+		return hops
+	}
+	return 1
+}
+
+// tooManyRequests writes a 429 with a Retry-After header in whole seconds
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, fmt.Sprintf("Too many failed login attempts. Try again in %d seconds.", seconds), http.StatusTooManyRequests)
+}
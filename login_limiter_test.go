@@ -0,0 +1,204 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     string
+		hops      string
+		forwarded []string
+		want      string
+	}{
+		{"proxy headers ignored by default", "", "", []string{"203.0.113.7"}, "192.0.2.1"},
+		{"no X-Forwarded-For", "true", "", nil, "192.0.2.1"},
+		{"single proxy", "true", "", []string{"203.0.113.7"}, "203.0.113.7"},
+		// The client sent "198.51.100.9" itself; only the entry our proxy appended counts
+		{"forged entries ignored", "true", "", []string{"198.51.100.9, 203.0.113.7"}, "203.0.113.7"},
+		{"forged entries in another header", "true", "", []string{"198.51.100.9", "203.0.113.7"}, "203.0.113.7"},
+		{"two proxies", "true", "2", []string{"198.51.100.9, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"fewer entries than proxies", "true", "3", []string{"203.0.113.7, 10.0.0.2"}, "192.0.2.1"},
+		{"not an IP", "true", "", []string{"203.0.113.7, garbage"}, "192.0.2.1"},
+		{"invalid hop count", "true", "zero", []string{"198.51.100.9, 203.0.113.7"}, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUST_PROXY_HEADERS", tt.trust)
+			t.Setenv("TRUSTED_PROXY_HOPS", tt.hops)
+			r := httptest.NewRequest("POST", "/api/login", nil)
+			r.RemoteAddr = "192.0.2.1:54321"
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginPolicyBlockDuration(t *testing.T) {
+	policy := LoginPolicy{
+		FreeFailures:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Second,
+		LockoutThreshold: 10,
+		LockoutDuration:  time.Hour,
+	}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 5 * time.Second}, // capped at MaxDelay
+		{9, 5 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.blockDuration(tt.failures); got != tt.want {
+			t.Errorf("blockDuration(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// loginFrom posts a login for username to LoginHandler from the client at remoteAddr
+func loginFrom(t *testing.T, remoteAddr, username, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newJSONRequest(t, http.MethodPost, "/api/login", LoginRequest{Username: username, Password: password})
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	LoginHandler(rec, req)
+	return rec
+}
+
+// createLoginTestUser creates username with password hashed as at registration
+func createLoginTestUser(t *testing.T, username, password string) *User {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	return createTestUser(t, username, hash)
+}
+
+// expireLoginBlock ends the current block of key, as if its delay had passed
+func expireLoginBlock(memory *MemoryStore, key string) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	attempt := memory.loginAttempts[key]
+	past := time.Now().Add(-time.Second)
+	attempt.LockedUntil = &past
+	memory.loginAttempts[key] = attempt
+}
+
+// lockAccount fails logins for user until the account reaches the lockout
+// threshold, waiting out the short delays on the way
+func lockAccount(t *testing.T, memory *MemoryStore, user *User) {
+	t.Helper()
+	for i := 1; i <= loginLimiter.account.LockoutThreshold; i++ {
+		if rec := loginFrom(t, "192.0.2.1:1234", user.Username, "wrong pass"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d, want 401", i, rec.Code)
+		}
+		if i < loginLimiter.account.LockoutThreshold {
+			expireLoginBlock(memory, accountAttemptKey(user.UserID))
+		}
+	}
+}
+
+func TestLoginHandlerLocksAccount(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "5")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "10m")
+	memory := useMemoryStore(t)
+	alice := createLoginTestUser(t, "alice", "right pass1")
+
+	// The failures after the free ones block the account briefly, even for the right password
+	for i := 1; i <= loginLimiter.account.FreeFailures+1; i++ {
+		if rec := loginFrom(t, "192.0.2.1:1234", "alice", "wrong pass"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d, want 401", i, rec.Code)
+		}
+	}
+	rec := loginFrom(t, "192.0.2.1:1234", "alice", "right pass1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("after %d failures: status %d, Retry-After %q; want 429 after 1 second",
+			loginLimiter.account.FreeFailures+1, rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Reaching the threshold locks it for LOGIN_LOCKOUT_DURATION, from any IP
+	expireLoginBlock(memory, accountAttemptKey(alice.UserID))
+	if rec := loginFrom(t, "192.0.2.1:1234", "alice", "wrong pass"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("failure 5: status %d, want 401", rec.Code)
+	}
+	rec = loginFrom(t, "198.51.100.1:1234", "alice", "right pass1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "600" {
+		t.Errorf("right password while locked: status %d, Retry-After %q; want 429 after 600 seconds",
+			rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoginHandlerThrottlesIP(t *testing.T) {
+	useMemoryStore(t)
+	createLoginTestUser(t, "alice", "right pass1")
+
+	// Failures for unknown accounts still count against the IP
+	for i := 1; i <= loginLimiter.ip.FreeFailures+1; i++ {
+		if rec := loginFrom(t, "203.0.113.7:1234", "nobody", "wrong pass"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d, want 401", i, rec.Code)
+		}
+	}
+	rec := loginFrom(t, "203.0.113.7:1234", "alice", "right pass1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("throttled IP: status %d, Retry-After %q; want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := loginFrom(t, "198.51.100.1:1234", "alice", "right pass1"); rec.Code != http.StatusOK {
+		t.Errorf("another IP: status %d, want 200", rec.Code)
+	}
+}
+
+func TestLoginHandlerResetsAccountOnSuccess(t *testing.T) {
+	useMemoryStore(t)
+	alice := createLoginTestUser(t, "alice", "right pass1")
+
+	// Without the reset, the failures on each side of the successful login would add
+	// up past the free ones and block the account
+	for round := 0; round < 2; round++ {
+		for i := 0; i < loginLimiter.account.FreeFailures; i++ {
+			loginFrom(t, "192.0.2.1:1234", "alice", "wrong pass")
+		}
+		if rec := loginFrom(t, "192.0.2.1:1234", "alice", "right pass1"); rec.Code != http.StatusOK {
+			t.Fatalf("round %d: status %d, want 200", round+1, rec.Code)
+		}
+	}
+	if attempt, _ := store.GetLoginAttempt(accountAttemptKey(alice.UserID)); attempt != nil && attempt.Failures != 0 {
+		t.Errorf("%d failures left after a successful login, want 0", attempt.Failures)
+	}
+}
+
+func TestUnlockUserHandler(t *testing.T) {
+	memory := useMemoryStore(t)
+	admin := createTestUser(t, "admin", "unused")
+	alice := createLoginTestUser(t, "alice", "right pass1")
+	lockAccount(t, memory, alice)
+	if rec := loginFrom(t, "192.0.2.1:1234", "alice", "right pass1"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked account: status %d, want 429", rec.Code)
+	}
+
+	if rec := serveWithID(t, UnlockUserHandler, http.MethodPost, 9999, nil, callerFor(admin)); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want 404", rec.Code)
+	}
+	if rec := serveWithID(t, UnlockUserHandler, http.MethodPost, alice.UserID, nil, callerFor(admin)); rec.Code != http.StatusOK {
+		t.Fatalf("unlock: status %d, want 200", rec.Code)
+	}
+	if rec := loginFrom(t, "192.0.2.1:1234", "alice", "right pass1"); rec.Code != http.StatusOK {
+		t.Errorf("unlocked account: status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Email is an outgoing plain-text message
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MailSender delivers emails. The backend is chosen with MAIL_SENDER so flows like
+// password reset work the same in development (log/file) and production (smtp).
+type MailSender interface {
+	Send(msg Email) error
+}
+
+// mailer is the MailSender configured at startup
+var mailer MailSender
+
+// NewMailSenderFromEnv builds the MailSender selected by MAIL_SENDER:
+//   - "log" (default): writes messages to the server log
+//   - "file": writes each message to a file in MAIL_OUTBOX_DIR (default "outbox")
+//   - "smtp": sends through SMTP_HOST:SMTP_PORT with SMTP_USERNAME/SMTP_PASSWORD, from MAIL_FROM
+func NewMailSenderFromEnv() (MailSender, error) {
+	switch backend := os.Getenv("MAIL_SENDER"); backend {
+	case "", "log":
+		return LogMailSender{}, nil
+	case "file":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("error creating mail outbox %s: %w", dir, err)
+		}
+		return FileMailSender{Dir: dir}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		from := os.Getenv("MAIL_FROM")
+		if host == "" || from == "" {
+			return nil, fmt.Errorf("MAIL_SENDER=smtp requires SMTP_HOST and MAIL_FROM")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailSender{
+			Addr:     host + ":" + port,
+			Host:     host,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_SENDER %q (expected log, file or smtp)", backend)
+	}
+}
+
+// LogMailSender writes emails to the server log. Development only: the log then
+// contains live reset links.
+type LogMailSender struct{}
+
+// Send logs the message
+func (LogMailSender) Send(msg Email) error {
+	log.Printf("Email to %s\nSubject: %s\n\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailSender writes each email to its own .eml file, for inspecting mail locally
+type FileMailSender struct {
+	Dir string
+}
+
+// Send writes the message to the outbox directory
+func (f FileMailSender) Send(msg Email) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitizeFileName(msg.To))
+	path := filepath.Join(f.Dir, name)
+	if err := os.WriteFile(path, formatEmail("", msg), 0o600); err != nil {
+		return fmt.Errorf("error writing email to %s: %w", path, err)
+	}
+	log.Printf("Email to %s written to %s", msg.To, path)
+	return nil
+}
+
+// SMTPMailSender sends email through an SMTP relay
+type SMTPMailSender struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message over SMTP (STARTTLS is used when the server offers it)
+func (s *SMTPMailSender) Send(msg Email) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, formatEmail(s.From, msg)); err != nil {
+		return fmt.Errorf("error sending email to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// formatEmail renders a minimal RFC 5322 message
+func formatEmail(from string, msg Email) []byte {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", from)
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// sanitizeFileName keeps only characters that are safe in a file name
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -250,24 +250,90 @@ func main() {
 		log.Println("No .env file found or error loading .env. Assuming environment variables are set.")
 	}
 
+	// STORE_BACKEND chọn nơi lưu dữ liệu: "mysql" (mặc định) hoặc "memory" (chạy không cần MySQL)
+	backend := os.Getenv("STORE_BACKEND")
 	mysqlDSN := os.Getenv("MYSQL_DSN")
-	if mysqlDSN == "" {
-		log.Fatal("MYSQL_DSN environment variable is not set. Please set it in .env or system.")
+
+	// `go run . migrate [up [version] | down [steps] | status]` chỉ chạy migration rồi thoát
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := RunMigrateCommand(mysqlDSN, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	if (backend == "" || backend == "mysql") && mysqlDSN == "" {
+		log.Fatal("MYSQL_DSN environment variable is not set. Please set it in .env or system, or use STORE_BACKEND=memory.")
+	}
+
+	store, err = OpenStore(backend, mysqlDSN)
+	if err != nil {
+		log.Fatalf("Error opening store: %v", err)
+	}
+	defer store.Close()
+
+	// `go run . products import [-dry-run] <file>` / `go run . products export <file>` nhập/xuất sản phẩm rồi thoát
+	if len(os.Args) > 1 && os.Args[1] == "products" {
+		if err := RunProductsCommand(os.Args[2:]); err != nil {
+			store.Close()
+			log.Fatalf("Products command failed: %v", err)
+		}
+		return
+	}
+
+	if err := store.InsertSampleData(); err != nil {
+		log.Printf("Error inserting sample data: %v", err)
+	}
+
+	// SEED_DEV_USERS=true tạo các tài khoản dùng cho test_api.sh (admin/admin123, user1/password1, ...)
+	if os.Getenv("SEED_DEV_USERS") == "true" {
+		if err := SeedDevUsers(); err != nil {
+			log.Printf("Error seeding dev users: %v", err)
+		}
 	}
 
-	InitDB(mysqlDSN)
-	defer CloseDB()
+	if err := loadDurations(); err != nil {
+		log.Fatalf("Error reading configuration: %v", err)
+	}
 
-	InsertSampleData()
+	tokenIssuer, err = NewTokenIssuerFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring token signing: %v", err)
+	}
+
+	loginLimiter, err = NewLoginLimiter(store)
+	if err != nil {
+		log.Fatalf("Error configuring login throttling: %v", err)
+	}
+
+	// MAIL_SENDER chọn cách gửi email: "log" (mặc định, in ra log), "file" (ghi vào MAIL_OUTBOX_DIR) hoặc "smtp"
+	mailer, err = NewMailSenderFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring mail sender: %v", err)
+	}
+
+	// OIDC_ISSUER bật đăng nhập qua IdP của công ty (OpenID Connect); OIDC_DEV_IDP=true dùng IdP giả lập tại /dev-idp
+	oidcClient, err = NewOIDCClientFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring OIDC login: %v", err)
+	}
+	var devIdP *DevIdentityProvider
+	if os.Getenv("OIDC_DEV_IDP") == "true" {
+		devIdP, err = NewDevIdentityProvider(devIdPIssuer)
+		if err != nil {
+			log.Fatalf("Error starting dev identity provider: %v", err)
+		}
+		log.Println("Warning: OIDC_DEV_IDP=true. The dev identity provider logs in any email address; never enable it in production.")
+	}
 
 	// --- Cấu hình CORS Middleware ---
 	// Cho phép tất cả các Origin, tất cả các phương thức (GET, POST, OPTIONS, v.v.)
 	// và cho phép gửi credentials (ví dụ: cookies, authorization headers)
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},                                                 // CHÚ Ý: Trong môi trường production, hãy thay thế "*" bằng danh sách các domain cụ thể của frontend.
-		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodOptions}, // Cho phép GET, POST, và OPTIONS (cho preflight requests)
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},                     // Cho phép các header này được gửi từ frontend
-		AllowCredentials: true,                                                          // Cho phép gửi cookies, authorization headers, v.v.
+		AllowedOrigins:   []string{"*"},                                                                                                      // CHÚ Ý: Trong môi trường production, hãy thay thế "*" bằng danh sách các domain cụ thể của frontend.
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}, // Cho phép GET, POST, PUT, PATCH, DELETE và OPTIONS (cho preflight requests)
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key", "If-None-Match", "If-Modified-Since"},                       // Cho phép các header này được gửi từ frontend
+		ExposedHeaders:   []string{"ETag", "Last-Modified"},                                                                                  // Cho phép frontend đọc các header dùng cho cache
+		AllowCredentials: true,                                                                                                               // Cho phép gửi cookies, authorization headers, v.v.
 		// Debug: true, // Bật debug mode để xem thông báo CORS trên console (chỉ dùng khi phát triển)
 	})
 
@@ -275,8 +341,77 @@ func main() {
 	mux := http.NewServeMux()
 
 	// Đăng ký các API Endpoints với Mux
-	mux.HandleFunc("/api/products", GetProductsHandler) // API lấy danh sách sản phẩm
-	mux.HandleFunc("/api/login", LoginHandler)          // API đăng nhập
+	mux.HandleFunc("/api/health", handleHealth)                    // API kiểm tra trạng thái server
+	mux.HandleFunc("/api/products", GetProductsHandler)            // API lấy danh sách sản phẩm
+	mux.HandleFunc("/api/categories", GetCategoriesHandler)        // API lấy cây danh mục sản phẩm (tên theo ngôn ngữ)
+	mux.HandleFunc("GET /api/products/{id}", GetProductHandler)    // API xem chi tiết sản phẩm (hỗ trợ ETag/Last-Modified, trả 304 nếu không đổi)
+	mux.HandleFunc("/api/register", RegisterHandler)               // API đăng ký tài khoản
+	mux.HandleFunc("/api/login", LoginHandler)                     // API đăng nhập
+	mux.HandleFunc("/api/login/mfa", MFALoginHandler)              // API đăng nhập bước 2: mã TOTP hoặc mã khôi phục
+	mux.HandleFunc("/api/token/refresh", RefreshTokenHandler)      // API đổi refresh token lấy access token mới
+	mux.HandleFunc("/api/logout", LogoutHandler)                   // API đăng xuất (thu hồi refresh token)
+	mux.HandleFunc("/api/password/forgot", ForgotPasswordHandler)  // API gửi email đặt lại mật khẩu
+	mux.HandleFunc("/api/password/reset", ResetPasswordHandler)    // API đặt lại mật khẩu bằng token trong email
+	mux.HandleFunc("/api/auth/oidc/login", OIDCLoginHandler)       // API bắt đầu đăng nhập qua OIDC (chuyển hướng tới IdP)
+	mux.HandleFunc("/api/auth/oidc/callback", OIDCCallbackHandler) // API IdP chuyển hướng về sau khi đăng nhập
+
+	// IdP giả lập cho môi trường phát triển (discovery, authorize, token, JWKS)
+	if devIdP != nil {
+		mux.HandleFunc("/dev-idp/.well-known/openid-configuration", devIdP.DiscoveryHandler)
+		mux.HandleFunc("/dev-idp/authorize", devIdP.AuthorizeHandler)
+		mux.HandleFunc("/dev-idp/token", devIdP.TokenHandler)
+		mux.HandleFunc("/dev-idp/jwks", devIdP.JWKSHandler)
+	}
+
+	// Các API cần đăng nhập: bọc handler bằng RequireUser (header "Authorization: Bearer <token>", không nhận API key)
+	mux.Handle("/api/me", RequireUser(http.HandlerFunc(MeHandler)))                                             // API lấy thông tin người dùng hiện tại
+	mux.Handle("POST /api/products/{id}/reservations", RequireUser(http.HandlerFunc(CreateReservationHandler))) // API giữ hàng trong kho khi thanh toán (tự hết hạn)
+	mux.Handle("DELETE /api/reservations/{id}", RequireUser(http.HandlerFunc(ReleaseReservationHandler)))       // API hủy giữ hàng, trả lại tồn kho
+	mux.Handle("POST /api/orders", RequireUser(http.HandlerFunc(PlaceOrderHandler)))                            // API đặt hàng nhiều sản phẩm (tính tiền phía server, trừ kho, cập nhật streak)
+	mux.Handle("GET /api/me/orders", RequireUser(http.HandlerFunc(MyOrdersHandler)))                            // API xem lịch sử đơn hàng của mình (phân trang, lọc theo ngày)
+	mux.Handle("GET /api/orders/{id}", RequireAuth(http.HandlerFunc(GetOrderHandler)))                          // API xem chi tiết đơn hàng (chủ đơn hoặc quyền orders:read)
+	mux.Handle("POST /api/orders/{id}/cancel", RequireAuth(http.HandlerFunc(CancelOrderHandler)))               // API hủy đơn chưa giao và hoàn lại tồn kho (chủ đơn hoặc quyền orders:write)
+	mux.Handle("GET /api/orders/{id}/events", RequireAuth(http.HandlerFunc(OrderEventsHandler)))                // API xem lịch sử trạng thái đơn hàng (hủy, hoàn tiền, ...)
+	mux.Handle("POST /api/offers/{id}/redeem", RequireUser(http.HandlerFunc(RedeemOfferHandler)))               // API dùng ưu đãi của mình cho một đơn hàng
+	mux.Handle("POST /api/offers/redeem", RequireUser(http.HandlerFunc(RedeemCouponHandler)))                   // API dùng ưu đãi bằng mã coupon
+
+	// Các API quản trị: chỉ tài khoản có role "admin"
+	mux.Handle("/api/mfa/totp", RequireRole(RoleAdmin, http.HandlerFunc(TOTPStatusHandler)))                                   // API xem trạng thái xác thực 2 bước
+	mux.Handle("/api/mfa/totp/enroll", RequireRole(RoleAdmin, http.HandlerFunc(TOTPEnrollHandler)))                            // API tạo secret TOTP và mã QR
+	mux.Handle("/api/mfa/totp/confirm", RequireRole(RoleAdmin, http.HandlerFunc(TOTPConfirmHandler)))                          // API xác nhận mã TOTP để bật 2FA
+	mux.Handle("/api/mfa/totp/disable", RequireRole(RoleAdmin, http.HandlerFunc(TOTPDisableHandler)))                          // API tắt 2FA
+	mux.Handle("/api/mfa/recovery-codes", RequireRole(RoleAdmin, http.HandlerFunc(RecoveryCodesHandler)))                      // API tạo lại mã khôi phục
+	mux.Handle("/api/admin/users/{id}/unlock", RequirePermission(PermUsersManage, http.HandlerFunc(UnlockUserHandler)))        // API mở khóa tài khoản bị khóa do đăng nhập sai
+	mux.Handle("/api/admin/users/{id}/roles", RequirePermission(PermUsersManage, http.HandlerFunc(UserRolesHandler)))          // API xem/đổi role của người dùng
+	mux.Handle("GET /api/admin/api-keys", RequirePermission(PermAPIKeysManage, http.HandlerFunc(ListAPIKeysHandler)))          // API xem danh sách API key
+	mux.Handle("POST /api/admin/api-keys", RequirePermission(PermAPIKeysManage, http.HandlerFunc(CreateAPIKeyHandler)))        // API tạo API key cho hệ thống khác
+	mux.Handle("DELETE /api/admin/api-keys/{id}", RequirePermission(PermAPIKeysManage, http.HandlerFunc(RevokeAPIKeyHandler))) // API thu hồi API key
+
+	// Các API quản lý danh mục sản phẩm (chỉ admin); xóa là xóa mềm để đơn hàng cũ vẫn tra được sản phẩm
+	mux.Handle("POST /api/products", RequirePermission(PermProductsWrite, http.HandlerFunc(CreateProductHandler)))                         // API thêm sản phẩm
+	mux.Handle("PUT /api/products/{id}", RequirePermission(PermProductsWrite, http.HandlerFunc(UpdateProductHandler)))                     // API cập nhật toàn bộ sản phẩm
+	mux.Handle("PATCH /api/products/{id}", RequirePermission(PermProductsWrite, http.HandlerFunc(PatchProductHandler)))                    // API cập nhật một phần sản phẩm
+	mux.Handle("DELETE /api/products/{id}", RequirePermission(PermProductsWrite, http.HandlerFunc(DeleteProductHandler)))                  // API xóa (mềm) sản phẩm
+	mux.Handle("GET /api/products/{id}/price-history", RequirePermission(PermProductsWrite, http.HandlerFunc(ProductPriceHistoryHandler))) // API xem lịch sử thay đổi giá
+	mux.Handle("POST /api/admin/products/import", RequirePermission(PermProductsWrite, http.HandlerFunc(ImportProductsHandler)))           // API nhập sản phẩm từ file CSV/JSONL (dry_run=true để chỉ kiểm tra)
+	mux.Handle("GET /api/admin/products/export", RequirePermission(PermProductsWrite, http.HandlerFunc(ExportProductsHandler)))            // API xuất danh mục sản phẩm ra CSV/JSONL
+	mux.Handle("PATCH /api/products/{id}/stock", RequirePermission(PermProductsWrite, http.HandlerFunc(UpdateProductStockHandler)))        // API kiểm kê/nhập thêm hàng và đặt ngưỡng cảnh báo tồn kho thấp
+	mux.Handle("GET /api/admin/inventory/low-stock", RequirePermission(PermProductsWrite, http.HandlerFunc(LowStockProductsHandler)))      // API xem các sản phẩm sắp hết hàng
+
+	// Các API phân quyền theo permission (xem rbac.go): marketer quản lý ưu đãi, analyst xem phân tích và huấn luyện model, support xem đơn hàng
+	mux.Handle("GET /api/offers", RequirePermission(PermOffersRead, http.HandlerFunc(ListOffersHandler)))                         // API xem ưu đãi đã gửi cho người dùng
+	mux.Handle("POST /api/offers", RequirePermission(PermOffersWrite, http.HandlerFunc(CreateOfferHandler)))                      // API tạo ưu đãi mới
+	mux.Handle("/api/analytics/users/{id}", RequirePermission(PermAnalyticsRead, http.HandlerFunc(UserAnalyticsHandler)))         // API xem dữ liệu phân tích của người dùng
+	mux.Handle("/api/analytics/users/{id}/predict", RequirePermission(PermAnalyticsRead, http.HandlerFunc(PredictStreakHandler))) // API dự đoán khả năng mất streak
+	mux.Handle("/api/models/train", RequirePermission(PermModelsTrain, http.HandlerFunc(TrainModelHandler)))                      // API huấn luyện model dự đoán streak
+	mux.Handle("/api/models/active", RequirePermission(PermModelsRead, http.HandlerFunc(ActiveModelHandler)))                     // API xem model đang dùng
+	mux.Handle("GET /api/users/{id}/orders", RequirePermission(PermOrdersRead, http.HandlerFunc(UserOrdersHandler)))              // API cho nhân viên hỗ trợ xem lịch sử đơn hàng của khách
+	mux.Handle("PATCH /api/orders/{id}/status", RequirePermission(PermOrdersWrite, http.HandlerFunc(UpdateOrderStatusHandler)))   // API chuyển trạng thái đơn hàng (đã thanh toán, đã giao)
+	mux.Handle("POST /api/orders/{id}/refund", RequirePermission(PermOrdersWrite, http.HandlerFunc(RefundOrderHandler)))          // API hoàn tiền đơn đã thanh toán hoặc đã giao
+
+	// Các API cho hệ thống khác (CRM, data pipeline) gọi bằng API key có scope tương ứng
+	mux.Handle("/api/activities", RequirePermission(PermActivitiesWrite, http.HandlerFunc(RecordActivitiesHandler)))            // API ghi nhận hoạt động của người dùng
+	mux.Handle("/api/users/{id}/predictions", RequirePermission(PermPredictionsRead, http.HandlerFunc(UserPredictionsHandler))) // API xem các dự đoán streak của người dùng
 
 	fmt.Println("API server starting on :8080")
 	// Áp dụng CORS middleware cho toàn bộ server HTTP
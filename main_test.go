@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testJWTSecret signs the tokens issued while testing
+var testJWTSecret = []byte("test-secret-for-unit-tests-only")
+
+// useMemoryStore points the package globals at a fresh MemoryStore, an HS256 token
+// issuer and a login limiter, and restores them when the test ends
+func useMemoryStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	// The lowest bcrypt cost keeps the tests fast
+	t.Setenv("BCRYPT_COST", "4")
+
+	oldStore, oldIssuer, oldLimiter := store, tokenIssuer, loginLimiter
+	t.Cleanup(func() {
+		store, tokenIssuer, loginLimiter = oldStore, oldIssuer, oldLimiter
+	})
+
+	memory := NewMemoryStore()
+	store = memory
+	tokenIssuer = newTestTokenIssuer()
+	limiter, err := NewLoginLimiter(memory)
+	if err != nil {
+		t.Fatalf("NewLoginLimiter: %v", err)
+	}
+	loginLimiter = limiter
+	return memory
+}
+
+// newTestTokenIssuer returns an issuer signing HS256 tokens with testJWTSecret
+func newTestTokenIssuer() *TokenIssuer {
+	return &TokenIssuer{
+		issuer:     defaultTokenIssuer,
+		accessTTL:  defaultAccessTokenTTL,
+		refreshTTL: defaultRefreshTokenTTL,
+		currentKID: "test",
+		keys:       map[string]signingKey{"test": hmacSigningKey(testJWTSecret)},
+	}
+}
+
+// createTestUser adds a user whose password_hash column holds passwordHash as given
+func createTestUser(t *testing.T, username, passwordHash string) *User {
+	t.Helper()
+	id, err := store.CreateUser(User{
+		Username:       username,
+		Email:          username + "@example.com",
+		PasswordHash:   passwordHash,
+		RegisteredDate: time.Now().AddDate(0, -2, 0),
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", username, err)
+	}
+	user, err := store.GetUserByID(id)
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByID(%d): %v", id, err)
+	}
+	return user
+}
+
+// newJSONRequest builds a request with body encoded as JSON; a nil body sends none
+func newJSONRequest(t *testing.T, method, path string, body interface{}) *http.Request {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// postJSON sends body as JSON to handler and returns the recorded response
+func postJSON(t *testing.T, handler http.HandlerFunc, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, newJSONRequest(t, http.MethodPost, path, body))
+	return rec
+}
+
+// serveAs runs handler with user as the authenticated caller, as RequireAuth would
+func serveAs(handler http.HandlerFunc, req *http.Request, user *AuthUser) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ctx := context.WithValue(req.Context(), authUserContextKey, user)
+	handler(rec, req.WithContext(ctx))
+	return rec
+}
+
+// createTestProducts adds the sample catalogue, stock included, and returns it
+func createTestProducts(t *testing.T) []Product {
+	t.Helper()
+	products := sampleProducts()
+	for i := range products {
+		products[i].UpdatedAt = time.Now()
+		if _, err := store.CreateProduct(products[i], 0); err != nil {
+			t.Fatalf("CreateProduct(%d): %v", products[i].ProductID, err)
+		}
+	}
+	return products
+}
+
+// callerFor returns the AuthUser RequireAuth would set for user
+func callerFor(user *User) *AuthUser {
+	return &AuthUser{UserID: user.UserID, Roles: user.Roles}
+}
+
+// serveWithID runs handler for a request whose {id} path value is id
+func serveWithID(t *testing.T, handler http.HandlerFunc, method string, id int, body interface{}, caller *AuthUser) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newJSONRequest(t, method, "/", body)
+	req.SetPathValue("id", strconv.Itoa(id))
+	return serveAs(handler, req, caller)
+}
+
+// placeTestOrder places an order for user through PlaceOrderHandler and returns it
+func placeTestOrder(t *testing.T, user *User, items ...PlaceOrderItem) *PlaceOrderResponse {
+	t.Helper()
+	rec := serveAs(PlaceOrderHandler, newJSONRequest(t, http.MethodPost, "/api/orders", PlaceOrderRequest{Items: items}), callerFor(user))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("placing order: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	var resp PlaceOrderResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding order: %v", err)
+	}
+	return &resp
+}
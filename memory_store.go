@@ -0,0 +1,1569 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory Store implementation for development and tests
+type MemoryStore struct {
+	mu          sync.Mutex
+	users       map[int]User
+	products    map[int]Product
+	categories  map[int]Category
+	orders      []Order
+	preferences map[int]UserPreference
+	offers      []Offer
+	streaks     map[int]UserStreak
+	activities  map[int][]UserActivity
+	predictions []StreakPrediction
+	models      []StreakModel
+
+	refreshTokens       []RefreshToken
+	passwordResetTokens []PasswordResetToken
+	mfa                 map[int]UserMFA
+	recoveryCodes       []RecoveryCode
+	apiKeys             []APIKey
+	priceChanges        []ProductPriceChange
+	reservations        []StockReservation
+	orderEvents         []OrderEvent
+	identities          []UserIdentity
+	oidcLoginRequests   map[string]OIDCLoginRequest
+	loginAttempts       map[string]LoginAttempt
+
+	nextOfferID              int
+	nextRefreshTokenID       int
+	nextPasswordResetTokenID int
+	nextOrderItemID          int
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	// The taxonomy is reference data, seeded like migration 14 does for MySQL
+	categories := make(map[int]Category)
+	for _, c := range defaultCategories() {
+		categories[c.CategoryID] = c
+	}
+
+	return &MemoryStore{
+		users:                    make(map[int]User),
+		products:                 make(map[int]Product),
+		categories:               categories,
+		preferences:              make(map[int]UserPreference),
+		streaks:                  make(map[int]UserStreak),
+		activities:               make(map[int][]UserActivity),
+		loginAttempts:            make(map[string]LoginAttempt),
+		mfa:                      make(map[int]UserMFA),
+		oidcLoginRequests:        make(map[string]OIDCLoginRequest),
+		nextOfferID:              1,
+		nextOrderItemID:          1,
+		nextRefreshTokenID:       1,
+		nextPasswordResetTokenID: 1,
+	}
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// InsertSampleData seeds the same demo users and preferences as the MySQL store
+func (s *MemoryStore) InsertSampleData() error {
+	users, preferences, err := sampleData()
+	if err != nil {
+		return fmt.Errorf("error preparing sample data: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range users {
+		if _, exists := s.users[u.UserID]; !exists {
+			s.users[u.UserID] = withDefaultRoles(u)
+		}
+	}
+	for _, p := range preferences {
+		if _, exists := s.preferences[p.UserID]; !exists {
+			s.preferences[p.UserID] = p
+		}
+	}
+	for _, p := range sampleProducts() {
+		if _, exists := s.products[p.ProductID]; !exists {
+			p.UpdatedAt = time.Now()
+			s.products[p.ProductID] = p
+		}
+	}
+	fmt.Println("Sample data inserted successfully.")
+	return nil
+}
+
+// GetUserData fetches all relevant data for a given user
+func (s *MemoryStore) GetUserData(userID int) (*UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("user with ID %d not found", userID)
+	}
+	userData := &UserData{User: user}
+	userData.PasswordHash = ""
+
+	// Get recent orders, newest first
+	orders := s.userOrdersLocked(OrderQuery{UserID: userID})
+	if len(orders) > 5 {
+		orders = orders[:5]
+	}
+	userData.RecentOrders = orders
+
+	if pref, ok := s.preferences[userID]; ok {
+		userData.PreferredCategoryIDs = append([]int(nil), pref.PreferredCategoryIDs...)
+		userData.ChurnRisk = pref.ChurnRisk
+	}
+
+	return userData, nil
+}
+
+// CreateUser inserts a user with empty preferences and a fresh streak
+func (s *MemoryStore) CreateUser(user User) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nextID := 1
+	for id, u := range s.users {
+		if strings.EqualFold(u.Email, user.Email) {
+			return 0, ErrEmailTaken
+		}
+		if strings.EqualFold(u.Username, user.Username) {
+			return 0, ErrUsernameTaken
+		}
+		if id >= nextID {
+			nextID = id + 1
+		}
+	}
+
+	user.UserID = nextID
+	s.users[user.UserID] = withDefaultRoles(user)
+	s.preferences[user.UserID] = UserPreference{UserID: user.UserID}
+	s.streaks[user.UserID] = UserStreak{
+		UserID:           user.UserID,
+		LastActivityDate: user.RegisteredDate,
+		StreakType:       "engagement",
+		IsActive:         true,
+	}
+	return user.UserID, nil
+}
+
+// GetUserByID retrieves a user by their ID
+func (s *MemoryStore) GetUserByID(userID int) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, nil // User not found
+	}
+	return &u, nil
+}
+
+// GetUserByEmail retrieves a user by their email
+func (s *MemoryStore) GetUserByEmail(email string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// MySQL's default collation compares emails case-insensitively
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return &u, nil
+		}
+	}
+	return nil, nil // User not found
+}
+
+// GetUserByUsername retrieves a user by their username
+func (s *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return &u, nil
+		}
+	}
+	return nil, nil // User not found
+}
+
+// withDefaultRoles gives a new user the customer role when no roles are set,
+// like insertUserRoles does for MySQL
+func withDefaultRoles(user User) User {
+	if len(user.Roles) == 0 {
+		user.Roles = []string{RoleCustomer}
+	}
+	return user
+}
+
+// SetUserRoles replaces a user's roles
+func (s *MemoryStore) SetUserRoles(userID int, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+	u.Roles = append([]string(nil), roles...)
+	s.users[userID] = withDefaultRoles(u)
+	return nil
+}
+
+// UpdateUserLastLogin updates the last_login timestamp for a user
+func (s *MemoryStore) UpdateUserLastLogin(userID int, loginTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil // Matches UPDATE ... WHERE affecting no rows
+	}
+	u.LastLogin = &loginTime
+	s.users[userID] = u
+	return nil
+}
+
+// UpdateUserPasswordHash replaces the stored password hash for a user
+func (s *MemoryStore) UpdateUserPasswordHash(userID int, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+	u.PasswordHash = passwordHash
+	s.users[userID] = u
+	return nil
+}
+
+// GetProducts fetches all products
+func (s *MemoryStore) GetProducts() ([]Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var products []Product
+	for _, p := range s.products {
+		if p.DeletedAt == nil {
+			products = append(products, s.withReservedLocked(p, now))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ProductID < products[j].ProductID })
+	return products, nil
+}
+
+// withReservedLocked fills p.ReservedQuantity from the reservations active at now; the
+// caller must hold s.mu
+func (s *MemoryStore) withReservedLocked(p Product, now time.Time) Product {
+	p.ReservedQuantity = 0
+	for _, r := range s.reservations {
+		if r.ProductID == p.ProductID && r.Status == ReservationActive && r.ExpiresAt.After(now) {
+			p.ReservedQuantity += r.Quantity
+		}
+	}
+	return p
+}
+
+// ListProducts fetches one page of products using keyset pagination on (sort field, product_id)
+func (s *MemoryStore) ListProducts(query ProductQuery) ([]Product, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var matches []Product
+	for _, p := range s.products {
+		if p.DeletedAt != nil {
+			continue
+		}
+		p = s.withReservedLocked(p, now)
+		if len(query.CategoryIDs) > 0 && !containsInt(query.CategoryIDs, p.CategoryID) {
+			continue
+		}
+		if (query.MinPrice != nil && p.Price < *query.MinPrice) || (query.MaxPrice != nil && p.Price > *query.MaxPrice) {
+			continue
+		}
+		searchName := foldVietnamese(p.ProductName)
+		found := true
+		for _, term := range query.SearchTerms {
+			if !strings.Contains(searchName, term) {
+				found = false
+				break
+			}
+		}
+		if found {
+			matches = append(matches, p)
+		}
+	}
+	total := len(matches)
+
+	// compare orders two products by the sort field, then by ID
+	compare := func(a Product, name string, price float64, id int) int {
+		switch query.SortBy {
+		case ProductSortName:
+			if c := strings.Compare(foldVietnamese(a.ProductName), foldVietnamese(name)); c != 0 {
+				return c
+			}
+		case ProductSortPrice:
+			if a.Price != price {
+				if a.Price < price {
+					return -1
+				}
+				return 1
+			}
+		}
+		return a.ProductID - id
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		c := compare(matches[i], matches[j].ProductName, matches[j].Price, matches[j].ProductID)
+		if query.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	var products []Product
+	for _, p := range matches {
+		if len(products) == query.Limit {
+			break
+		}
+		if after := query.After; after != nil {
+			c := compare(p, after.Name, after.Price, after.ProductID)
+			if (!query.Desc && c <= 0) || (query.Desc && c >= 0) {
+				continue
+			}
+		}
+		products = append(products, p)
+	}
+	return products, total, nil
+}
+
+// GetProductByID retrieves a product, including soft-deleted ones
+func (s *MemoryStore) GetProductByID(productID int) (*Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.products[productID]
+	if !ok {
+		return nil, nil
+	}
+	p = s.withReservedLocked(p, time.Now())
+	return &p, nil
+}
+
+// CreateProduct inserts a product and records its initial price
+func (s *MemoryStore) CreateProduct(product Product, changedBy int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.products[product.ProductID]; exists {
+		return 0, ErrProductExists
+	}
+	return s.createProductLocked(product, changedBy), nil
+}
+
+// UpdateProduct replaces a product's fields, auditing a price change
+func (s *MemoryStore) UpdateProduct(product Product, changedBy int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateProductLocked(product, changedBy), nil
+}
+
+// UpsertProducts updates or creates every product, or none if one can't be created
+func (s *MemoryStore) UpsertProducts(products []ProductUpsert, changedBy int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check every row first, since there is no transaction to roll back
+	for _, upsert := range products {
+		product := upsert.Product
+		existing, exists := s.products[product.ProductID]
+		if exists && existing.DeletedAt != nil {
+			return fmt.Errorf("product %d: %w", product.ProductID, ErrProductExists)
+		}
+		if exists && upsert.Stock != nil {
+			if _, err := s.stockAfterLocked(existing, *upsert.Stock); err != nil {
+				return fmt.Errorf("product %d: %w", product.ProductID, err)
+			}
+		}
+	}
+	for _, upsert := range products {
+		if !s.updateProductLocked(upsert.Product, changedBy) {
+			s.createProductLocked(upsert.Product, changedBy)
+		} else if upsert.Stock != nil {
+			s.updateProductStockLocked(upsert.Product.ProductID, *upsert.Stock)
+		}
+	}
+	return nil
+}
+
+// createProductLocked inserts a product whose ID (when set) is free, assigning the next
+// ID otherwise; the caller must hold s.mu
+func (s *MemoryStore) createProductLocked(product Product, changedBy int) int {
+	if product.ProductID <= 0 {
+		product.ProductID = 1
+		for id := range s.products {
+			if id >= product.ProductID {
+				product.ProductID = id + 1
+			}
+		}
+	}
+	product.DeletedAt = nil
+	product.ReservedQuantity = 0
+	s.products[product.ProductID] = product
+	s.recordPriceChange(product.ProductID, nil, product.Price, changedBy, product.UpdatedAt)
+	return product.ProductID
+}
+
+// updateProductLocked replaces a non-deleted product; the caller must hold s.mu
+func (s *MemoryStore) updateProductLocked(product Product, changedBy int) bool {
+	existing, ok := s.products[product.ProductID]
+	if !ok || existing.DeletedAt != nil {
+		return false
+	}
+	product.DeletedAt = nil
+	// The inventory only changes through UpdateProductStock and PlaceOrder
+	product.StockQuantity, product.LowStockThreshold = existing.StockQuantity, existing.LowStockThreshold
+	product.ReservedQuantity = 0
+	s.products[product.ProductID] = product
+	if existing.Price != product.Price {
+		oldPrice := existing.Price
+		s.recordPriceChange(product.ProductID, &oldPrice, product.Price, changedBy, product.UpdatedAt)
+	}
+	return true
+}
+
+// recordPriceChange appends an audit entry; the caller must hold s.mu
+func (s *MemoryStore) recordPriceChange(productID int, oldPrice *float64, newPrice float64, changedBy int, changedAt time.Time) {
+	change := ProductPriceChange{
+		ChangeID:  len(s.priceChanges) + 1,
+		ProductID: productID,
+		OldPrice:  oldPrice,
+		NewPrice:  newPrice,
+		ChangedAt: changedAt,
+	}
+	if changedBy > 0 {
+		change.ChangedBy = &changedBy
+	}
+	s.priceChanges = append(s.priceChanges, change)
+}
+
+// DeleteProduct soft-deletes a product
+func (s *MemoryStore) DeleteProduct(productID int, deletedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.products[productID]
+	if !ok || p.DeletedAt != nil {
+		return false, nil
+	}
+	p.DeletedAt = &deletedAt
+	p.UpdatedAt = deletedAt
+	s.products[productID] = p
+	return true, nil
+}
+
+// GetProductPriceChanges retrieves a product's price history, oldest first
+func (s *MemoryStore) GetProductPriceChanges(productID int) ([]ProductPriceChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []ProductPriceChange
+	for _, c := range s.priceChanges {
+		if c.ProductID == productID {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// UpdateProductStock applies a stock count or adjustment to a non-deleted product
+func (s *MemoryStore) UpdateProductStock(productID int, change StockChange) (*Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateProductStockLocked(productID, change)
+}
+
+// updateProductStockLocked applies a stock change to a non-deleted product; the caller
+// must hold s.mu
+func (s *MemoryStore) updateProductStockLocked(productID int, change StockChange) (*Product, error) {
+	p, ok := s.products[productID]
+	if !ok || p.DeletedAt != nil {
+		return nil, nil
+	}
+	p, err := s.stockAfterLocked(p, change)
+	if err != nil {
+		return nil, err
+	}
+	s.products[productID] = p
+	return &p, nil
+}
+
+// stockAfterLocked returns the product as the stock change would leave it, or
+// ErrInsufficientStock; the caller must hold s.mu
+func (s *MemoryStore) stockAfterLocked(p Product, change StockChange) (Product, error) {
+	p = s.withReservedLocked(p, change.ChangedAt)
+
+	stock := p.StockQuantity + change.Adjustment
+	if change.Quantity != nil {
+		stock = *change.Quantity
+	}
+	if stock < 0 || stock < p.ReservedQuantity {
+		return p, ErrInsufficientStock
+	}
+	p.StockQuantity = stock
+	if change.LowStockThreshold != nil {
+		p.LowStockThreshold = *change.LowStockThreshold
+	}
+	p.UpdatedAt = change.ChangedAt
+	return p, nil
+}
+
+// ListLowStockProducts returns the products at or below their low-stock threshold,
+// least available first
+func (s *MemoryStore) ListLowStockProducts() ([]Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var products []Product
+	for _, p := range s.products {
+		if p = s.withReservedLocked(p, now); p.DeletedAt == nil && p.IsLowStock() {
+			products = append(products, p)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		if a, b := products[i].AvailableQuantity(), products[j].AvailableQuantity(); a != b {
+			return a < b
+		}
+		return products[i].ProductID < products[j].ProductID
+	})
+	return products, nil
+}
+
+// GetAvailableStockByCategory sums the available units of non-deleted products per category
+func (s *MemoryStore) GetAvailableStockByCategory() (map[int]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	available := make(map[int]int)
+	for _, p := range s.products {
+		if p.DeletedAt != nil {
+			continue
+		}
+		available[p.CategoryID] += max(s.withReservedLocked(p, now).AvailableQuantity(), 0)
+	}
+	return available, nil
+}
+
+// ReserveStock holds units of a non-deleted product for a user
+func (s *MemoryStore) ReserveStock(reservation StockReservation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.products[reservation.ProductID]
+	if !ok || p.DeletedAt != nil || s.withReservedLocked(p, reservation.CreatedAt).AvailableQuantity() < reservation.Quantity {
+		return 0, ErrInsufficientStock
+	}
+	active, units := 0, 0
+	for _, r := range s.reservations {
+		if r.UserID == reservation.UserID && r.Status == ReservationActive && r.ExpiresAt.After(reservation.CreatedAt) {
+			active++
+			if r.ProductID == reservation.ProductID {
+				units += r.Quantity
+			}
+		}
+	}
+	if active >= maxActiveReservationsPerUser || units+reservation.Quantity > maxReservationQuantity {
+		return 0, ErrReservationLimit
+	}
+
+	reservation.ReservationID = len(s.reservations) + 1
+	reservation.Status = ReservationActive
+	reservation.ReleasedAt, reservation.OrderID = nil, nil
+	s.reservations = append(s.reservations, reservation)
+	p.UpdatedAt = reservation.CreatedAt
+	s.products[p.ProductID] = p
+	return reservation.ReservationID, nil
+}
+
+// GetStockReservation retrieves a reservation, reporting a lapsed active one as expired
+func (s *MemoryStore) GetStockReservation(reservationID int) (*StockReservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.reservations {
+		if r.ReservationID == reservationID {
+			if r.Status == ReservationActive && !r.ExpiresAt.After(time.Now()) {
+				r.Status = ReservationExpired
+			}
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// ReleaseStockReservation marks an active reservation released
+func (s *MemoryStore) ReleaseStockReservation(reservationID int, releasedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.reservations {
+		if r.ReservationID != reservationID {
+			continue
+		}
+		if r.Status != ReservationActive || !r.ExpiresAt.After(releasedAt) {
+			return false, nil
+		}
+		s.reservations[i].Status = ReservationReleased
+		s.reservations[i].ReleasedAt = &releasedAt
+		if p, ok := s.products[r.ProductID]; ok {
+			p.UpdatedAt = releasedAt
+			s.products[r.ProductID] = p
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// PlaceOrder checks every item, then decrements the stock and records the order
+func (s *MemoryStore) PlaceOrder(order Order) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taken := make(map[int]int)                    // units already taken per product by earlier items
+	reservations := make([]int, len(order.Items)) // index in s.reservations, or -1
+	for i, item := range order.Items {
+		p, ok := s.products[item.ProductID]
+		if !ok || p.DeletedAt != nil {
+			return nil, &OrderItemError{ProductID: item.ProductID, Err: ErrInsufficientStock}
+		}
+		available := s.withReservedLocked(p, order.OrderDate).AvailableQuantity() - taken[item.ProductID]
+		reservations[i] = -1
+		if item.ReservationID > 0 {
+			for j, r := range s.reservations {
+				if r.ReservationID == item.ReservationID && r.UserID == order.UserID && r.ProductID == item.ProductID &&
+					r.Status == ReservationActive && r.ExpiresAt.After(order.OrderDate) && r.Quantity >= item.Quantity &&
+					!slices.Contains(reservations[:i], j) {
+					reservations[i] = j
+				}
+			}
+			if reservations[i] < 0 {
+				return nil, &OrderItemError{ProductID: item.ProductID, Err: ErrReservationNotActive}
+			}
+			available += s.reservations[reservations[i]].Quantity // the units held for this order are the ones being sold
+		}
+		if available < item.Quantity {
+			return nil, &OrderItemError{ProductID: item.ProductID, Err: ErrInsufficientStock}
+		}
+		taken[item.ProductID] += item.Quantity
+	}
+
+	order.OrderID = len(s.orders) + 1
+	order.Status, order.UpdatedAt = OrderPending, order.OrderDate
+	order.Items = append([]OrderItem(nil), order.Items...)
+	order.TotalPrice = 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		p := s.products[item.ProductID]
+		p.StockQuantity -= item.Quantity
+		p.UpdatedAt = order.OrderDate
+		s.products[p.ProductID] = p
+
+		item.OrderItemID = s.nextOrderItemID
+		s.nextOrderItemID++
+		item.ProductName, item.CategoryID, item.UnitPrice = p.ProductName, p.CategoryID, p.Price
+		item.LineTotal = orderTotal(p.Price, item.Quantity)
+		order.TotalPrice += item.LineTotal
+		if j := reservations[i]; j >= 0 {
+			s.reservations[j].Status = ReservationOrdered
+			s.reservations[j].ReleasedAt = &order.OrderDate
+			s.reservations[j].OrderID = &order.OrderID
+		}
+	}
+	order.TotalPrice = math.Round(order.TotalPrice*100) / 100
+	s.orders = append(s.orders, order)
+	return &order, nil
+}
+
+// ListOrders fetches one page of a user's orders, newest first
+func (s *MemoryStore) ListOrders(query OrderQuery) ([]Order, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches := s.userOrdersLocked(query)
+	var orders []Order
+	for _, o := range matches {
+		if len(orders) == query.Limit {
+			break
+		}
+		if after := query.After; after != nil &&
+			!(o.OrderDate.Before(after.OrderDate) || (o.OrderDate.Equal(after.OrderDate) && o.OrderID < after.OrderID)) {
+			continue
+		}
+		orders = append(orders, o)
+	}
+	return orders, len(matches), nil
+}
+
+// userOrdersLocked returns the user's orders within the query's date range, newest
+// first, ignoring the cursor and limit; the caller must hold s.mu
+func (s *MemoryStore) userOrdersLocked(query OrderQuery) []Order {
+	var orders []Order
+	for _, o := range s.orders {
+		if o.UserID != query.UserID ||
+			(query.From != nil && o.OrderDate.Before(*query.From)) ||
+			(query.Before != nil && !o.OrderDate.Before(*query.Before)) {
+			continue
+		}
+		orders = append(orders, o)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].OrderDate.Equal(orders[j].OrderDate) {
+			return orders[i].OrderDate.After(orders[j].OrderDate)
+		}
+		return orders[i].OrderID > orders[j].OrderID
+	})
+	return orders
+}
+
+// GetOrderByID retrieves an order with its items
+func (s *MemoryStore) GetOrderByID(orderID int) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.orders {
+		if o.OrderID == orderID {
+			return &o, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetOrderStats aggregates a user's orders except cancelled and refunded ones
+func (s *MemoryStore) GetOrderStats(userID int, trendStart, trendSplit time.Time) (*OrderStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats OrderStats
+	for _, o := range s.orders {
+		if o.UserID != userID || o.Status == OrderCancelled {
+			continue
+		}
+		if o.Status == OrderRefunded {
+			stats.RefundedOrders++
+			continue
+		}
+		stats.TotalOrders++
+		stats.TotalSpent += o.TotalPrice
+		for _, item := range o.Items {
+			stats.TotalUnits += item.Quantity
+		}
+		if stats.FirstOrderDate == nil || o.OrderDate.Before(*stats.FirstOrderDate) {
+			date := o.OrderDate
+			stats.FirstOrderDate = &date
+		}
+		if stats.LastOrderDate == nil || o.OrderDate.After(*stats.LastOrderDate) {
+			date := o.OrderDate
+			stats.LastOrderDate = &date
+		}
+		if !o.OrderDate.Before(trendSplit) {
+			stats.RecentSpent += o.TotalPrice
+		} else if !o.OrderDate.Before(trendStart) {
+			stats.PreviousSpent += o.TotalPrice
+		}
+	}
+	return &stats, nil
+}
+
+// UpdateOrderStatus changes an order's status, restocks its items if asked and records
+// the event
+func (s *MemoryStore) UpdateOrderStatus(event OrderEvent, changedBy int) (*OrderEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, o := range s.orders {
+		if o.OrderID != event.OrderID {
+			continue
+		}
+		if o.Status != event.FromStatus {
+			return nil, nil
+		}
+		s.orders[i].Status, s.orders[i].UpdatedAt = event.ToStatus, event.CreatedAt
+		if event.Restocked {
+			for _, item := range o.Items {
+				if p, ok := s.products[item.ProductID]; ok {
+					p.StockQuantity += item.Quantity
+					p.UpdatedAt = event.CreatedAt
+					s.products[item.ProductID] = p
+				}
+			}
+		}
+		if event.ToStatus == OrderCancelled {
+			for j, offer := range s.offers {
+				if offer.OrderID != nil && *offer.OrderID == event.OrderID && offer.ExpiresAt.After(event.CreatedAt) {
+					s.offers[j].IsUsed, s.offers[j].UsedAt, s.offers[j].OrderID = false, nil, nil
+				}
+			}
+		}
+		event.EventID = len(s.orderEvents) + 1
+		if changedBy > 0 {
+			event.ChangedBy = &changedBy
+		}
+		s.orderEvents = append(s.orderEvents, event)
+		return &event, nil
+	}
+	return nil, nil
+}
+
+// ListOrderEvents returns an order's status changes, oldest first
+func (s *MemoryStore) ListOrderEvents(orderID int) ([]OrderEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []OrderEvent
+	for _, e := range s.orderEvents {
+		if e.OrderID == orderID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// GetCategories returns every category, ordered by ID
+func (s *MemoryStore) GetCategories() ([]Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var categories []Category
+	for _, c := range s.categories {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].CategoryID < categories[j].CategoryID })
+	return categories, nil
+}
+
+// GetCategoryByID returns a category, or nil
+func (s *MemoryStore) GetCategoryByID(categoryID int) (*Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.categories[categoryID]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+// containsInt reports whether ids contains id
+func containsInt(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveOffer saves the generated offer
+func (s *MemoryStore) SaveOffer(offer Offer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offer.OfferID = s.nextOfferID
+	s.nextOfferID++
+	s.offers = append(s.offers, offer)
+	fmt.Printf("Offer saved for User ID: %d\n", offer.UserID)
+	return offer.OfferID, nil
+}
+
+// GetSavedOffers retrieves offers saved for a specific user
+func (s *MemoryStore) GetSavedOffers(userID int) ([]Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var offers []Offer
+	for _, o := range s.offers {
+		if o.UserID == userID {
+			offers = append(offers, o)
+		}
+	}
+	return offers, nil
+}
+
+// GetOfferByID retrieves an offer
+func (s *MemoryStore) GetOfferByID(offerID int) (*Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.offers {
+		if o.OfferID == offerID {
+			return &o, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetOfferByCouponCode retrieves the offer with a coupon code
+func (s *MemoryStore) GetOfferByCouponCode(code string) (*Offer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range s.offers {
+		if o.CouponCode == code {
+			return &o, nil
+		}
+	}
+	return nil, nil
+}
+
+// RedeemOffer marks an unused, unexpired offer used for an order
+func (s *MemoryStore) RedeemOffer(offerID, orderID int, usedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	open := false
+	for _, o := range s.orders {
+		if o.OrderID == orderID {
+			open = o.Status == OrderPending || o.Status == OrderPaid
+			break
+		}
+	}
+	if !open {
+		return false, ErrOrderClosed
+	}
+	for _, o := range s.offers {
+		if o.OrderID != nil && *o.OrderID == orderID && o.OfferID != offerID {
+			return false, ErrOrderHasOffer
+		}
+	}
+	for i, o := range s.offers {
+		if o.OfferID != offerID {
+			continue
+		}
+		if o.IsUsed || !o.ExpiresAt.After(usedAt) {
+			return false, nil
+		}
+		s.offers[i].IsUsed = true
+		s.offers[i].UsedAt = &usedAt
+		s.offers[i].OrderID = &orderID
+		return true, nil
+	}
+	return false, nil
+}
+
+// GetUserStreak retrieves streak information for a user
+func (s *MemoryStore) GetUserStreak(userID int) (*UserStreak, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streak, ok := s.streaks[userID]
+	if !ok {
+		return nil, nil // User has no streak data yet
+	}
+	return &streak, nil
+}
+
+// UpdateUserStreak updates or creates streak data for a user
+func (s *MemoryStore) UpdateUserStreak(userID int, currentStreak int, lastActivityDate time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streak, ok := s.streaks[userID]
+	if !ok {
+		streak = UserStreak{UserID: userID, StreakType: "engagement"}
+	}
+	streak.CurrentStreak = currentStreak
+	if currentStreak > streak.LongestStreak {
+		streak.LongestStreak = currentStreak
+	}
+	streak.LastActivityDate = lastActivityDate
+	streak.IsActive = true
+	s.streaks[userID] = streak
+	return nil
+}
+
+// RecordUserActivity records a new user activity
+func (s *MemoryStore) RecordUserActivity(userID int, activityType string, activityValue float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.activities[userID] = append(s.activities[userID], UserActivity{
+		ActivityType:  activityType,
+		ActivityDate:  time.Now(),
+		ActivityValue: activityValue,
+	})
+	return nil
+}
+
+// RecordUserActivities records a batch of activities under one lock
+func (s *MemoryStore) RecordUserActivities(activities []ActivityInput) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, a := range activities {
+		s.activities[a.UserID] = append(s.activities[a.UserID], UserActivity{
+			ActivityType:  a.ActivityType,
+			ActivityDate:  now,
+			ActivityValue: a.ActivityValue,
+		})
+	}
+	return nil
+}
+
+// RecordPurchaseActivity records the "purchase" activity of an order
+func (s *MemoryStore) RecordPurchaseActivity(userID, orderID int, amount float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.activities[userID] = append(s.activities[userID], UserActivity{
+		ActivityType:  "purchase",
+		ActivityDate:  time.Now(),
+		ActivityValue: amount,
+		OrderID:       &orderID,
+	})
+	return nil
+}
+
+// GetUserActivities retrieves recent activities for a user, newest first, without the
+// purchases of cancelled and refunded orders
+func (s *MemoryStore) GetUserActivities(userID int, limit int) ([]UserActivity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reversed := make(map[int]bool)
+	for _, o := range s.orders {
+		if o.Status == OrderCancelled || o.Status == OrderRefunded {
+			reversed[o.OrderID] = true
+		}
+	}
+	var activities []UserActivity
+	for _, a := range s.activities[userID] {
+		if a.OrderID == nil || !reversed[*a.OrderID] {
+			activities = append(activities, a)
+		}
+	}
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].ActivityDate.After(activities[j].ActivityDate)
+	})
+	if len(activities) > limit {
+		activities = activities[:limit]
+	}
+	return activities, nil
+}
+
+// SaveStreakPrediction saves a prediction
+func (s *MemoryStore) SaveStreakPrediction(prediction StreakPrediction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.predictions = append(s.predictions, prediction)
+	return nil
+}
+
+// GetStreakPredictions retrieves predictions for a user, newest first
+func (s *MemoryStore) GetStreakPredictions(userID int, limit int) ([]StreakPrediction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var predictions []StreakPrediction
+	for i := len(s.predictions) - 1; i >= 0 && len(predictions) < limit; i-- {
+		p := s.predictions[i]
+		if p.UserID != userID {
+			continue
+		}
+		// Only the columns stored by the MySQL table are returned
+		predictions = append(predictions, StreakPrediction{
+			UserID:                    p.UserID,
+			ProbabilityOfStreakDrop:   p.ProbabilityOfStreakDrop,
+			PredictedDaysToStreakDrop: p.PredictedDaysToStreakDrop,
+			RiskLevel:                 p.RiskLevel,
+			Confidence:                p.Confidence,
+		})
+	}
+	return predictions, nil
+}
+
+// SaveStreakModel saves a trained model
+func (s *MemoryStore) SaveStreakModel(model StreakModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.models = append(s.models, model)
+	return nil
+}
+
+// GetActiveStreakModel retrieves the most recently trained model
+func (s *MemoryStore) GetActiveStreakModel() (*StreakModel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var active *StreakModel
+	for i := range s.models {
+		if active == nil || s.models[i].TrainingDate.After(active.TrainingDate) {
+			active = &s.models[i]
+		}
+	}
+	if active == nil {
+		return nil, nil
+	}
+	model := *active
+	return &model, nil
+}
+
+// SaveRefreshToken stores a newly issued refresh token
+func (s *MemoryStore) SaveRefreshToken(token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.TokenHash == token.TokenHash {
+			return fmt.Errorf("error saving refresh token: duplicate token hash")
+		}
+	}
+	token.TokenID = s.nextRefreshTokenID
+	s.nextRefreshTokenID++
+	s.refreshTokens = append(s.refreshTokens, token)
+	return nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by the hash of its value
+func (s *MemoryStore) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.TokenHash == tokenHash {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+// MarkRefreshTokenRotated flags a refresh token as used if it is still active
+func (s *MemoryStore) MarkRefreshTokenRotated(tokenID int, rotatedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.refreshTokens {
+		t := &s.refreshTokens[i]
+		if t.TokenID != tokenID {
+			continue
+		}
+		if t.RotatedAt != nil || t.RevokedAt != nil {
+			return false, nil
+		}
+		t.RotatedAt = &rotatedAt
+		return true, nil
+	}
+	return false, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token in a refresh token family
+func (s *MemoryStore) RevokeRefreshTokenFamily(familyID string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.refreshTokens {
+		t := &s.refreshTokens[i]
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every active refresh token of a user, logging out all sessions
+func (s *MemoryStore) RevokeUserRefreshTokens(userID int, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.refreshTokens {
+		t := &s.refreshTokens[i]
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// SavePasswordResetToken stores a newly issued password reset token
+func (s *MemoryStore) SavePasswordResetToken(token PasswordResetToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.passwordResetTokens {
+		if t.TokenHash == token.TokenHash {
+			return fmt.Errorf("error saving password reset token: duplicate token hash")
+		}
+	}
+	token.TokenID = s.nextPasswordResetTokenID
+	s.nextPasswordResetTokenID++
+	s.passwordResetTokens = append(s.passwordResetTokens, token)
+	return nil
+}
+
+// GetPasswordResetTokenByHash retrieves a password reset token by the hash of its value
+func (s *MemoryStore) GetPasswordResetTokenByHash(tokenHash string) (*PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.passwordResetTokens {
+		if t.TokenHash == tokenHash {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetLatestPasswordResetToken retrieves the password reset token most recently issued to a user
+func (s *MemoryStore) GetLatestPasswordResetToken(userID int) (*PasswordResetToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Tokens are appended as they are issued
+	for i := len(s.passwordResetTokens) - 1; i >= 0; i-- {
+		if t := s.passwordResetTokens[i]; t.UserID == userID {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+// MarkPasswordResetTokenUsed flags a password reset token as used if it hasn't been used yet
+func (s *MemoryStore) MarkPasswordResetTokenUsed(tokenID int, usedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.passwordResetTokens {
+		t := &s.passwordResetTokens[i]
+		if t.TokenID != tokenID {
+			continue
+		}
+		if t.UsedAt != nil {
+			return false, nil
+		}
+		t.UsedAt = &usedAt
+		return true, nil
+	}
+	return false, nil
+}
+
+// MarkUserPasswordResetTokensUsed flags every unused password reset token of a user as used
+func (s *MemoryStore) MarkUserPasswordResetTokensUsed(userID int, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.passwordResetTokens {
+		if t := &s.passwordResetTokens[i]; t.UserID == userID && t.UsedAt == nil {
+			t.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+// GetUserMFA retrieves a user's TOTP enrolment, or nil if there is none
+func (s *MemoryStore) GetUserMFA(userID int) (*UserMFA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, ok := s.mfa[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &mfa, nil
+}
+
+// SaveUserMFASecret starts (or restarts) a pending TOTP enrolment
+func (s *MemoryStore) SaveUserMFASecret(userID int, secret string, createdAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mfa[userID] = UserMFA{UserID: userID, TOTPSecret: secret, CreatedAt: createdAt}
+	return nil
+}
+
+// EnableUserMFA confirms a TOTP enrolment and replaces the user's recovery codes
+func (s *MemoryStore) EnableUserMFA(userID int, enabledAt time.Time, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, ok := s.mfa[userID]
+	if !ok {
+		return nil
+	}
+	mfa.EnabledAt = &enabledAt
+	s.mfa[userID] = mfa
+	s.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+// DisableUserMFA removes a user's TOTP enrolment and recovery codes
+func (s *MemoryStore) DisableUserMFA(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.mfa, userID)
+	s.replaceRecoveryCodes(userID, nil)
+	return nil
+}
+
+// MarkTOTPStepUsed records an accepted TOTP step unless it (or a later one) was already used
+func (s *MemoryStore) MarkTOTPStepUsed(userID int, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, ok := s.mfa[userID]
+	if !ok || mfa.LastUsedStep >= step {
+		return false, nil
+	}
+	mfa.LastUsedStep = step
+	s.mfa[userID] = mfa
+	return true, nil
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones
+func (s *MemoryStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// replaceRecoveryCodes swaps a user's recovery codes; the caller must hold s.mu
+func (s *MemoryStore) replaceRecoveryCodes(userID int, codeHashes []string) {
+	kept := s.recoveryCodes[:0]
+	for _, c := range s.recoveryCodes {
+		if c.UserID != userID {
+			kept = append(kept, c)
+		}
+	}
+	for _, hash := range codeHashes {
+		kept = append(kept, RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	s.recoveryCodes = kept
+}
+
+// UseRecoveryCode consumes an unused recovery code
+func (s *MemoryStore) UseRecoveryCode(userID int, codeHash string, usedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.recoveryCodes {
+		c := &s.recoveryCodes[i]
+		if c.UserID == userID && c.CodeHash == codeHash && c.UsedAt == nil {
+			c.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes a user has left
+func (s *MemoryStore) CountUnusedRecoveryCodes(userID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, c := range s.recoveryCodes {
+		if c.UserID == userID && c.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CreateAPIKey stores a new API key and returns its ID
+func (s *MemoryStore) CreateAPIKey(key APIKey) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.KeyHash == key.KeyHash {
+			return 0, fmt.Errorf("error saving API key: duplicate key hash")
+		}
+	}
+	key.KeyID = len(s.apiKeys) + 1
+	s.apiKeys = append(s.apiKeys, key)
+	return key.KeyID, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its value
+func (s *MemoryStore) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.KeyHash == keyHash {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListAPIKeys retrieves all API keys, newest first
+func (s *MemoryStore) ListAPIKeys() ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.apiKeys))
+	for i := len(s.apiKeys) - 1; i >= 0; i-- {
+		keys = append(keys, s.apiKeys[i])
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key if it is still active
+func (s *MemoryStore) RevokeAPIKey(keyID int, revokedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.apiKeys {
+		k := &s.apiKeys[i]
+		if k.KeyID == keyID && k.RevokedAt == nil {
+			k.RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *MemoryStore) TouchAPIKey(keyID int, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.apiKeys {
+		if s.apiKeys[i].KeyID == keyID {
+			s.apiKeys[i].LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+// GetUserByIdentity retrieves the user linked to an external OIDC identity
+func (s *MemoryStore) GetUserByIdentity(issuer, subject string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, identity := range s.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			if u, ok := s.users[identity.UserID]; ok {
+				return &u, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// LinkUserIdentity links an external OIDC identity to a user
+func (s *MemoryStore) LinkUserIdentity(identity UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.identities {
+		if existing.Issuer == identity.Issuer && existing.Subject == identity.Subject {
+			return fmt.Errorf("error linking user identity: identity already linked")
+		}
+	}
+	identity.IdentityID = len(s.identities) + 1
+	s.identities = append(s.identities, identity)
+	return nil
+}
+
+// SaveOIDCLoginRequest stores a pending OIDC login and drops expired ones
+func (s *MemoryStore) SaveOIDCLoginRequest(req OIDCLoginRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, pending := range s.oidcLoginRequests {
+		if pending.ExpiresAt.Before(req.CreatedAt) {
+			delete(s.oidcLoginRequests, hash)
+		}
+	}
+	s.oidcLoginRequests[req.StateHash] = req
+	return nil
+}
+
+// ConsumeOIDCLoginRequest deletes and returns a pending OIDC login
+func (s *MemoryStore) ConsumeOIDCLoginRequest(stateHash string) (*OIDCLoginRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.oidcLoginRequests[stateHash]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.oidcLoginRequests, stateHash)
+	return &req, nil
+}
+
+// GetLoginAttempt retrieves the failed login counter for a key
+func (s *MemoryStore) GetLoginAttempt(key string) (*LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.loginAttempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+// IncrementLoginFailures atomically counts a failed login for a key
+func (s *MemoryStore) IncrementLoginFailures(key string, now, windowStart time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.loginAttempts[key]
+	if !ok {
+		attempt = LoginAttempt{Key: key}
+	}
+	if attempt.LastFailureAt.Before(windowStart) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	s.loginAttempts[key] = attempt
+	return attempt.Failures, nil
+}
+
+// SetLoginLockout blocks logins for a key until the given time
+func (s *MemoryStore) SetLoginLockout(key string, lockedUntil time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.loginAttempts[key]
+	if !ok {
+		return nil
+	}
+	attempt.LockedUntil = &lockedUntil
+	s.loginAttempts[key] = attempt
+	return nil
+}
+
+// ResetLoginAttempts clears the failure counter and any lockout for a key
+func (s *MemoryStore) ResetLoginAttempts(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginAttempts, key)
+	return nil
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// verifyMFACode checks a TOTP code, or a recovery code when allowRecovery is set, and
+// consumes it: TOTP steps can't be replayed and recovery codes work only once
+func verifyMFACode(mfa *UserMFA, code string, allowRecovery bool) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := verifyTOTP(mfa.TOTPSecret, code, time.Now()); ok {
+		return store.MarkTOTPStepUsed(mfa.UserID, step)
+	}
+	if !allowRecovery || len(code) == totpDigits {
+		return false, nil
+	}
+	return store.UseRecoveryCode(mfa.UserID, hashRecoveryCode(code), time.Now())
+}
+
+// issueRecoveryCodes generates a new set of recovery codes and their hashes for storage
+func issueRecoveryCodes() ([]string, []string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// mfaThrottled writes a 429 (or 500) and returns true when code checks from this IP or for
+// this account are blocked. Wrong codes are recorded with recordLoginFailure, so guessing
+// a code anywhere counts towards the same lockout as guessing the password.
+func mfaThrottled(w http.ResponseWriter, ip string, userID int) bool {
+	if retryAfter, err := loginLimiter.CheckIP(ip); err != nil {
+		log.Printf("Error checking login throttle for IP %s: %v", ip, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	} else if retryAfter > 0 {
+		tooManyRequests(w, retryAfter)
+		return true
+	}
+	if retryAfter, err := loginLimiter.CheckAccount(userID); err != nil {
+		log.Printf("Error checking login lockout for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	} else if retryAfter > 0 {
+		tooManyRequests(w, retryAfter)
+		return true
+	}
+	return false
+}
+
+// decodeMFACode reads an MFACodeRequest body, writing a 400 if it is missing the code
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+	return req.Code, true
+}
+
+// TOTPStatusHandler reports whether two-factor authentication is enabled for the caller
+func TOTPStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authUser, _ := AuthUserFromContext(r.Context())
+	mfa, err := store.GetUserMFA(authUser.UserID)
+	if err != nil {
+		log.Printf("Error retrieving MFA settings for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	remaining, err := store.CountUnusedRecoveryCodes(authUser.UserID)
+	if err != nil {
+		log.Printf("Error counting recovery codes for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":                  mfa != nil && mfa.EnabledAt != nil,
+		"pending":                  mfa != nil && mfa.EnabledAt == nil,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// TOTPEnrollHandler starts TOTP enrolment: it generates a secret and returns it with the
+// otpauth:// provisioning URI to show as a QR code. Nothing changes at login until the
+// enrolment is confirmed with a code from the authenticator app.
+func TOTPEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authUser, _ := AuthUserFromContext(r.Context())
+	user, err := store.GetUserByID(authUser.UserID)
+	if err != nil || user == nil {
+		log.Printf("Error retrieving user %d for TOTP enrolment: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	mfa, err := store.GetUserMFA(user.UserID)
+	if err != nil {
+		log.Printf("Error retrieving MFA settings for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if mfa != nil && mfa.EnabledAt != nil {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := store.SaveUserMFASecret(user.UserID, secret, time.Now()); err != nil {
+		log.Printf("Error saving TOTP secret for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secret":      secret,
+		"otpauth_uri": totpProvisioningURI(user.Email, secret),
+		"message":     "Scan the QR code, then confirm with a code from the app",
+	})
+}
+
+// TOTPConfirmHandler enables two-factor authentication once the caller proves the
+// authenticator app works, and returns the recovery codes (shown only this once)
+func TOTPConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	authUser, _ := AuthUserFromContext(r.Context())
+	ip := clientIP(r)
+	if mfaThrottled(w, ip, authUser.UserID) {
+		return
+	}
+	mfa, err := store.GetUserMFA(authUser.UserID)
+	if err != nil {
+		log.Printf("Error retrieving MFA settings for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if mfa == nil || mfa.EnabledAt != nil {
+		http.Error(w, "No pending TOTP enrolment", http.StatusConflict)
+		return
+	}
+
+	valid, err := verifyMFACode(mfa, code, false)
+	if err != nil {
+		log.Printf("Error verifying TOTP code for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordLoginFailure(ip, authUser.UserID)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := issueRecoveryCodes()
+	if err == nil {
+		err = store.EnableUserMFA(authUser.UserID, time.Now(), hashes)
+	}
+	if err != nil {
+		log.Printf("Error enabling MFA for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Two-factor authentication enabled for user %d", authUser.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe.",
+		"recovery_codes": codes,
+	})
+}
+
+// TOTPDisableHandler turns two-factor authentication off. It requires a current TOTP
+// or recovery code so a stolen access token alone can't remove the second factor.
+func TOTPDisableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	authUser, _ := AuthUserFromContext(r.Context())
+	ip := clientIP(r)
+	if mfaThrottled(w, ip, authUser.UserID) {
+		return
+	}
+	mfa, err := store.GetUserMFA(authUser.UserID)
+	if err != nil {
+		log.Printf("Error retrieving MFA settings for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if mfa == nil || mfa.EnabledAt == nil {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	valid, err := verifyMFACode(mfa, code, true)
+	if err != nil {
+		log.Printf("Error verifying MFA code for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordLoginFailure(ip, authUser.UserID)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.DisableUserMFA(authUser.UserID); err != nil {
+		log.Printf("Error disabling MFA for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Two-factor authentication disabled for user %d", authUser.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RecoveryCodesHandler replaces the caller's recovery codes after a TOTP check
+func RecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	authUser, _ := AuthUserFromContext(r.Context())
+	ip := clientIP(r)
+	if mfaThrottled(w, ip, authUser.UserID) {
+		return
+	}
+	mfa, err := store.GetUserMFA(authUser.UserID)
+	if err != nil {
+		log.Printf("Error retrieving MFA settings for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if mfa == nil || mfa.EnabledAt == nil {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	valid, err := verifyMFACode(mfa, code, false)
+	if err != nil {
+		log.Printf("Error verifying TOTP code for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordLoginFailure(ip, authUser.UserID)
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := issueRecoveryCodes()
+	if err == nil {
+		err = store.ReplaceRecoveryCodes(authUser.UserID, hashes)
+	}
+	if err != nil {
+		log.Printf("Error replacing recovery codes for user %d: %v", authUser.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"recovery_codes": codes,
+	})
+}
+
+// MFALoginHandler is the second step of a two-step login: it exchanges the challenge
+// token from LoginHandler plus a TOTP or recovery code for a session. Wrong codes count
+// as failed logins, so the lockout in LoginLimiter also stops code guessing.
+func MFALoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := tokenIssuer.ParseToken(req.MFAToken, TokenTypeMFAChallenge)
+	if err != nil {
+		log.Printf("Rejected MFA challenge token: %v", err)
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	ip := clientIP(r)
+	if mfaThrottled(w, ip, claims.UserID) {
+		return
+	}
+
+	user, err := store.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user %d for MFA login: %v", claims.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	mfa, err := store.GetUserMFA(claims.UserID)
+	if err != nil {
+		log.Printf("Error retrieving MFA settings for user %d: %v", claims.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || mfa == nil || mfa.EnabledAt == nil {
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	code, allowRecovery := req.Code, false
+	if req.RecoveryCode != "" {
+		code, allowRecovery = req.RecoveryCode, true
+	}
+	valid, err := verifyMFACode(mfa, code, allowRecovery)
+	if err != nil {
+		log.Printf("Error verifying MFA code for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordLoginFailure(ip, user.UserID)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	if allowRecovery {
+		log.Printf("User %d logged in with a recovery code", user.UserID)
+	}
+
+	completeLogin(w, user)
+}
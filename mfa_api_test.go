@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// currentTOTPCode returns the code an authenticator app shows now, steps later
+func currentTOTPCode(t *testing.T, secretBase32 string, steps int64) string {
+	t.Helper()
+	secret, err := totpEncoding.DecodeString(secretBase32)
+	if err != nil {
+		t.Fatalf("decoding TOTP secret: %v", err)
+	}
+	return totpCode(secret, time.Now().Unix()/totpPeriod+steps)
+}
+
+// enrollTOTP enables TOTP for user through the enrolment handlers and returns the
+// secret and the recovery codes
+func enrollTOTP(t *testing.T, user *User) (string, []string) {
+	t.Helper()
+	rec := serveAs(TOTPEnrollHandler, newJSONRequest(t, http.MethodPost, "/api/mfa/totp/enroll", nil), callerFor(user))
+	var enrolment struct {
+		Secret string `json:"secret"`
+	}
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&enrolment) != nil {
+		t.Fatalf("enrol: status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	rec = serveAs(TOTPConfirmHandler, newJSONRequest(t, http.MethodPost, "/api/mfa/totp/confirm",
+		MFACodeRequest{Code: currentTOTPCode(t, enrolment.Secret, 0)}), callerFor(user))
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&confirmed) != nil {
+		t.Fatalf("confirm: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if len(confirmed.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(confirmed.RecoveryCodes), recoveryCodeCount)
+	}
+	return enrolment.Secret, confirmed.RecoveryCodes
+}
+
+func TestVerifyMFACodeRejectsReuse(t *testing.T) {
+	useMemoryStore(t)
+	user := createTestUser(t, "alice", "unused")
+	secret, recoveryCodes := enrollTOTP(t, user)
+	mfa, err := store.GetUserMFA(user.UserID)
+	if err != nil || mfa == nil {
+		t.Fatalf("GetUserMFA: %v", err)
+	}
+
+	// The confirmation used the current step, so its code can't be replayed
+	if ok, _ := verifyMFACode(mfa, currentTOTPCode(t, secret, 0), false); ok {
+		t.Error("the code used to confirm the enrolment was accepted again")
+	}
+	next := currentTOTPCode(t, secret, 1)
+	if ok, err := verifyMFACode(mfa, next, false); !ok || err != nil {
+		t.Fatalf("next step's code: %t, %v; want accepted", ok, err)
+	}
+	if ok, _ := verifyMFACode(mfa, next, false); ok {
+		t.Error("a TOTP code was accepted twice")
+	}
+
+	if ok, _ := verifyMFACode(mfa, recoveryCodes[0], false); ok {
+		t.Error("a recovery code was accepted where only TOTP is allowed")
+	}
+	if ok, err := verifyMFACode(mfa, recoveryCodes[0], true); !ok || err != nil {
+		t.Fatalf("recovery code: %t, %v; want accepted", ok, err)
+	}
+	if ok, _ := verifyMFACode(mfa, recoveryCodes[0], true); ok {
+		t.Error("a recovery code was accepted twice")
+	}
+	if remaining, _ := store.CountUnusedRecoveryCodes(user.UserID); remaining != recoveryCodeCount-1 {
+		t.Errorf("%d recovery codes left, want %d", remaining, recoveryCodeCount-1)
+	}
+}
+
+func TestMFALoginHandler(t *testing.T) {
+	useMemoryStore(t)
+	passwordHash, err := HashPassword("admin pass")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	user := createTestUser(t, "admin", passwordHash)
+	secret, recoveryCodes := enrollTOTP(t, user)
+
+	// challenge logs in with the password and returns the MFA challenge token
+	challenge := func() string {
+		t.Helper()
+		rec := postJSON(t, LoginHandler, "/api/login", LoginRequest{Username: "admin", Password: "admin pass"})
+		var resp LoginResponse
+		if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&resp) != nil {
+			t.Fatalf("login: status %d, body %q", rec.Code, rec.Body.String())
+		}
+		if !resp.MFARequired || resp.MFAToken == "" || resp.Token != "" || resp.RefreshToken != "" {
+			t.Fatalf("login with TOTP enabled issued %+v, want only a challenge", resp)
+		}
+		return resp.MFAToken
+	}
+
+	tests := []struct {
+		name string
+		req  func(token string) MFALoginRequest
+		want int
+	}{
+		{"wrong code", func(token string) MFALoginRequest {
+			return MFALoginRequest{MFAToken: token, Code: "000000"}
+		}, http.StatusUnauthorized},
+		{"access token instead of a challenge", func(string) MFALoginRequest {
+			access, _, _ := tokenIssuer.IssueAccessToken(user.UserID, user.Roles)
+			return MFALoginRequest{MFAToken: access, Code: currentTOTPCode(t, secret, 1)}
+		}, http.StatusUnauthorized},
+		{"TOTP code", func(token string) MFALoginRequest {
+			return MFALoginRequest{MFAToken: token, Code: currentTOTPCode(t, secret, 1)}
+		}, http.StatusOK},
+		{"replayed TOTP code", func(token string) MFALoginRequest {
+			return MFALoginRequest{MFAToken: token, Code: currentTOTPCode(t, secret, 1)}
+		}, http.StatusUnauthorized},
+		{"recovery code", func(token string) MFALoginRequest {
+			return MFALoginRequest{MFAToken: token, RecoveryCode: recoveryCodes[3]}
+		}, http.StatusOK},
+		{"used recovery code", func(token string) MFALoginRequest {
+			return MFALoginRequest{MFAToken: token, RecoveryCode: recoveryCodes[3]}
+		}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postJSON(t, MFALoginHandler, "/api/login/mfa", tt.req(challenge()))
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d; body %q", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var resp LoginResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding session: %v", err)
+			}
+			claims, err := tokenIssuer.ParseToken(resp.Token, TokenTypeAccess)
+			if err != nil || claims.UserID != user.UserID || resp.RefreshToken == "" {
+				t.Errorf("session %+v is not a valid session for user %d: %v", resp, user.UserID, err)
+			}
+		})
+	}
+}
+
+func TestMFACodeEndpointsAreThrottled(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// enrol sets up user for the endpoint and returns the TOTP secret
+		enrol func(t *testing.T, user *User) string
+	}{
+		{"confirm", TOTPConfirmHandler, func(t *testing.T, user *User) string {
+			rec := serveAs(TOTPEnrollHandler, newJSONRequest(t, http.MethodPost, "/api/mfa/totp/enroll", nil), callerFor(user))
+			var enrolment struct {
+				Secret string `json:"secret"`
+			}
+			if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&enrolment) != nil {
+				t.Fatalf("enrol: status %d, body %q", rec.Code, rec.Body.String())
+			}
+			return enrolment.Secret
+		}},
+		{"disable", TOTPDisableHandler, func(t *testing.T, user *User) string {
+			secret, _ := enrollTOTP(t, user)
+			return secret
+		}},
+		{"recovery codes", RecoveryCodesHandler, func(t *testing.T, user *User) string {
+			secret, _ := enrollTOTP(t, user)
+			return secret
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMemoryStore(t)
+			user := createTestUser(t, "admin", "unused")
+			secret := tt.enrol(t, user)
+			enabled := func() bool {
+				mfa, _ := store.GetUserMFA(user.UserID)
+				return mfa != nil && mfa.EnabledAt != nil
+			}
+			wasEnabled := enabled()
+
+			// Each wrong code counts as a failed login until the account is blocked
+			free := loginLimiter.account.FreeFailures
+			for i := 0; i <= free; i++ {
+				rec := serveAs(tt.handler, newJSONRequest(t, http.MethodPost, "/", MFACodeRequest{Code: "000000"}), callerFor(user))
+				if rec.Code != http.StatusBadRequest {
+					t.Fatalf("wrong code %d: status %d, want 400", i+1, rec.Code)
+				}
+			}
+
+			// Once blocked, even the right code is refused
+			rec := serveAs(tt.handler, newJSONRequest(t, http.MethodPost, "/",
+				MFACodeRequest{Code: currentTOTPCode(t, secret, 1)}), callerFor(user))
+			if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+				t.Fatalf("after %d wrong codes: status %d, Retry-After %q; want 429 with Retry-After",
+					free+1, rec.Code, rec.Header().Get("Retry-After"))
+			}
+			if enabled() != wasEnabled {
+				t.Error("a throttled request changed the MFA settings")
+			}
+		})
+	}
+}
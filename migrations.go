@@ -0,0 +1,1375 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is a numbered, reversible schema change.
+// MySQL commits DDL implicitly, so each step runs outside a transaction and a
+// migration is only recorded in schema_migrations once its Up step succeeds.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(db *sql.DB) error
+	Down    func(db *sql.DB) error
+}
+
+// migrations lists every schema change in order. Append new migrations at the end
+// and never edit one that has already been released.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_core_tables",
+		// IF NOT EXISTS lets databases created by the old InitDB adopt the migration history
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS users (
+                user_id INT PRIMARY KEY,
+                username VARCHAR(255) NOT NULL,
+                email VARCHAR(255) UNIQUE NOT NULL,
+                last_login DATETIME,
+                registered_date DATETIME
+            );`,
+			`CREATE TABLE IF NOT EXISTS products (
+                product_id INT PRIMARY KEY,
+                product_name VARCHAR(255) NOT NULL,
+                category VARCHAR(255) NOT NULL,
+                price DECIMAL(10, 2)
+            );`,
+			`CREATE TABLE IF NOT EXISTS orders (
+                order_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT,
+                product_id INT,
+                order_date DATETIME,
+                quantity INT,
+                total_price DECIMAL(10, 2),
+                FOREIGN KEY (user_id) REFERENCES users(user_id),
+                FOREIGN KEY (product_id) REFERENCES products(product_id)
+            );`,
+			`CREATE TABLE IF NOT EXISTS user_preferences (
+                user_id INT PRIMARY KEY,
+                preferred_categories TEXT,
+                churn_risk DECIMAL(3, 2),
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+			`CREATE TABLE IF NOT EXISTS offers (
+                offer_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT,
+                offer_type VARCHAR(50),
+                offer_value VARCHAR(100),
+                target_category VARCHAR(255),
+                generated_message TEXT,
+                sent_date DATETIME,
+                is_used BOOLEAN DEFAULT FALSE,
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+		),
+		Down: execStatements(
+			"DROP TABLE IF EXISTS offers",
+			"DROP TABLE IF EXISTS user_preferences",
+			"DROP TABLE IF EXISTS orders",
+			"DROP TABLE IF EXISTS products",
+			"DROP TABLE IF EXISTS users",
+		),
+	},
+	{
+		Version: 2,
+		Name:    "add_users_password_hash",
+		Up:      addColumnIfMissing("users", "password_hash", "VARCHAR(255) NOT NULL DEFAULT '' AFTER email"),
+		Down:    dropColumnIfExists("users", "password_hash"),
+	},
+	{
+		Version: 3,
+		Name:    "create_streak_tables",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS user_streaks (
+                user_id INT PRIMARY KEY,
+                current_streak INT DEFAULT 0,
+                longest_streak INT DEFAULT 0,
+                last_activity_date DATETIME,
+                streak_type VARCHAR(50) DEFAULT 'engagement',
+                is_active BOOLEAN DEFAULT TRUE,
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+			`CREATE TABLE IF NOT EXISTS user_activities (
+                activity_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT,
+                activity_type VARCHAR(50),
+                activity_date DATETIME,
+                activity_value FLOAT DEFAULT 0,
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+			`CREATE TABLE IF NOT EXISTS streak_predictions (
+                prediction_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT,
+                prediction_date DATETIME,
+                probability_of_streak_drop DECIMAL(5,4),
+                predicted_days_to_streak_drop INT,
+                risk_level VARCHAR(20),
+                confidence DECIMAL(5,4),
+                actual_streak_dropped BOOLEAN DEFAULT NULL,
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+			`CREATE TABLE IF NOT EXISTS streak_models (
+                model_id INT PRIMARY KEY AUTO_INCREMENT,
+                model_type VARCHAR(100),
+                version VARCHAR(50),
+                training_date DATETIME,
+                accuracy DECIMAL(5,4),
+                parameters JSON,
+                feature_names JSON,
+                is_active BOOLEAN DEFAULT TRUE
+            );`,
+		),
+		Down: execStatements(
+			"DROP TABLE IF EXISTS streak_models",
+			"DROP TABLE IF EXISTS streak_predictions",
+			"DROP TABLE IF EXISTS user_activities",
+			"DROP TABLE IF EXISTS user_streaks",
+		),
+	},
+	{
+		Version: 4,
+		Name:    "create_refresh_tokens",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS refresh_tokens (
+                token_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT NOT NULL,
+                family_id CHAR(32) NOT NULL,
+                token_hash CHAR(64) NOT NULL UNIQUE,
+                issued_at DATETIME NOT NULL,
+                expires_at DATETIME NOT NULL,
+                rotated_at DATETIME NULL,
+                revoked_at DATETIME NULL,
+                INDEX idx_refresh_tokens_family (family_id),
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+		),
+		Down: execStatements("DROP TABLE IF EXISTS refresh_tokens"),
+	},
+	{
+		Version: 5,
+		Name:    "users_auto_increment_unique_username",
+		Up: func(db *sql.DB) error {
+			if err := withoutForeignKeyChecks("ALTER TABLE users MODIFY user_id INT NOT NULL AUTO_INCREMENT")(db); err != nil {
+				return err
+			}
+			return createUniqueIndexIfMissing("users", "uq_users_username", "username")(db)
+		},
+		Down: func(db *sql.DB) error {
+			if err := dropIndexIfExists("users", "uq_users_username")(db); err != nil {
+				return err
+			}
+			return withoutForeignKeyChecks("ALTER TABLE users MODIFY user_id INT NOT NULL")(db)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_login_attempts",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS login_attempts (
+                attempt_key VARCHAR(255) PRIMARY KEY,
+                failures INT NOT NULL DEFAULT 0,
+                last_failure_at DATETIME NOT NULL,
+                locked_until DATETIME NULL
+            );`,
+		),
+		Down: execStatements("DROP TABLE IF EXISTS login_attempts"),
+	},
+	{
+		Version: 7,
+		Name:    "create_password_reset_tokens",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+                token_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT NOT NULL,
+                token_hash CHAR(64) NOT NULL UNIQUE,
+                created_at DATETIME NOT NULL,
+                expires_at DATETIME NOT NULL,
+                used_at DATETIME NULL,
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+		),
+		Down: execStatements("DROP TABLE IF EXISTS password_reset_tokens"),
+	},
+	{
+		Version: 8,
+		Name:    "create_mfa_tables",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS user_mfa (
+                user_id INT PRIMARY KEY,
+                totp_secret VARCHAR(64) NOT NULL,
+                created_at DATETIME NOT NULL,
+                enabled_at DATETIME NULL,
+                last_used_step BIGINT NOT NULL DEFAULT 0,
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+			`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+                code_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT NOT NULL,
+                code_hash CHAR(64) NOT NULL,
+                used_at DATETIME NULL,
+                UNIQUE KEY uq_mfa_recovery_codes_user_hash (user_id, code_hash),
+                FOREIGN KEY (user_id) REFERENCES users(user_id)
+            );`,
+		),
+		Down: execStatements(
+			"DROP TABLE IF EXISTS mfa_recovery_codes",
+			"DROP TABLE IF EXISTS user_mfa",
+		),
+	},
+	{
+		Version: 9,
+		Name:    "create_roles",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS roles (
+                role_name VARCHAR(32) PRIMARY KEY,
+                description VARCHAR(255) NOT NULL
+            );`,
+			`INSERT IGNORE INTO roles (role_name, description) VALUES
+                ('customer', 'Shopper; access to their own account only'),
+                ('marketer', 'Manages offers and reads analytics'),
+                ('analyst', 'Reads analytics and trains prediction models'),
+                ('admin', 'Full access, including user management');`,
+			`CREATE TABLE IF NOT EXISTS user_roles (
+                user_id INT NOT NULL,
+                role_name VARCHAR(32) NOT NULL,
+                PRIMARY KEY (user_id, role_name),
+                FOREIGN KEY (user_id) REFERENCES users(user_id),
+                FOREIGN KEY (role_name) REFERENCES roles(role_name)
+            );`,
+			// Existing accounts are customers; user 1 was the admin of the old hardcoded user map
+			"INSERT IGNORE INTO user_roles (user_id, role_name) SELECT user_id, 'customer' FROM users",
+			"INSERT IGNORE INTO user_roles (user_id, role_name) SELECT user_id, 'admin' FROM users WHERE user_id = 1",
+		),
+		Down: execStatements(
+			"DROP TABLE IF EXISTS user_roles",
+			"DROP TABLE IF EXISTS roles",
+		),
+	},
+	{
+		Version: 10,
+		Name:    "create_api_keys",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS api_keys (
+                key_id INT PRIMARY KEY AUTO_INCREMENT,
+                name VARCHAR(100) NOT NULL,
+                key_prefix VARCHAR(16) NOT NULL,
+                key_hash CHAR(64) NOT NULL UNIQUE,
+                scopes VARCHAR(255) NOT NULL,
+                created_by INT NOT NULL,
+                created_at DATETIME NOT NULL,
+                last_used_at DATETIME NULL,
+                revoked_at DATETIME NULL,
+                FOREIGN KEY (created_by) REFERENCES users(user_id)
+            );`,
+		),
+		Down: execStatements("DROP TABLE IF EXISTS api_keys"),
+	},
+	{
+		Version: 11,
+		Name:    "create_oidc_tables",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS user_identities (
+                identity_id INT PRIMARY KEY AUTO_INCREMENT,
+                user_id INT NOT NULL,
+                issuer VARCHAR(255) NOT NULL,
+                subject VARCHAR(255) NOT NULL,
+                email VARCHAR(255) NOT NULL,
+                created_at DATETIME NOT NULL,
+                UNIQUE KEY uq_user_identities_issuer_subject (issuer, subject),
+                FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+            );`,
+			`CREATE TABLE IF NOT EXISTS oidc_login_requests (
+                state_hash CHAR(64) PRIMARY KEY,
+                code_verifier VARCHAR(128) NOT NULL,
+                nonce VARCHAR(64) NOT NULL,
+                created_at DATETIME NOT NULL,
+                expires_at DATETIME NOT NULL
+            );`,
+		),
+		Down: execStatements(
+			"DROP TABLE IF EXISTS oidc_login_requests",
+			"DROP TABLE IF EXISTS user_identities",
+		),
+	},
+	{
+		Version: 12,
+		Name:    "add_products_search_name",
+		Up: func(db *sql.DB) error {
+			if err := addColumnIfMissing("products", "search_name", "VARCHAR(255) NOT NULL DEFAULT '' AFTER product_name")(db); err != nil {
+				return err
+			}
+			for _, index := range []struct{ name, columns string }{
+				{"idx_products_category", "category"},
+				{"idx_products_price", "price, product_id"},
+				{"idx_products_name", "product_name, product_id"},
+			} {
+				if err := createIndexIfMissing("products", index.name, index.columns)(db); err != nil {
+					return err
+				}
+			}
+			return backfillProductSearchNames(db)
+		},
+		Down: func(db *sql.DB) error {
+			for _, index := range []string{"idx_products_name", "idx_products_price", "idx_products_category"} {
+				if err := dropIndexIfExists("products", index)(db); err != nil {
+					return err
+				}
+			}
+			return dropColumnIfExists("products", "search_name")(db)
+		},
+	},
+	{
+		Version: 13,
+		Name:    "product_soft_delete_and_price_changes",
+		Up: func(db *sql.DB) error {
+			if err := withoutForeignKeyChecks("ALTER TABLE products MODIFY product_id INT NOT NULL AUTO_INCREMENT")(db); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing("products", "deleted_at", "DATETIME NULL")(db); err != nil {
+				return err
+			}
+			return execStatements(
+				`CREATE TABLE IF NOT EXISTS product_price_changes (
+                change_id INT PRIMARY KEY AUTO_INCREMENT,
+                product_id INT NOT NULL,
+                old_price DECIMAL(10, 2) NULL,
+                new_price DECIMAL(10, 2) NOT NULL,
+                changed_by INT NULL,
+                changed_at DATETIME NOT NULL,
+                INDEX idx_product_price_changes_product (product_id, changed_at),
+                FOREIGN KEY (product_id) REFERENCES products(product_id),
+                FOREIGN KEY (changed_by) REFERENCES users(user_id)
+            );`,
+			)(db)
+		},
+		Down: func(db *sql.DB) error {
+			if err := execStatements("DROP TABLE IF EXISTS product_price_changes")(db); err != nil {
+				return err
+			}
+			if err := dropColumnIfExists("products", "deleted_at")(db); err != nil {
+				return err
+			}
+			return withoutForeignKeyChecks("ALTER TABLE products MODIFY product_id INT NOT NULL")(db)
+		},
+	},
+	{
+		Version: 14,
+		Name:    "create_categories",
+		// Replaces the free-text products.category, user_preferences.preferred_categories
+		// and offers.target_category with references to the categories table
+		Up:   migrateCategoriesUp,
+		Down: migrateCategoriesDown,
+	},
+	{
+		Version: 15,
+		Name:    "add_products_updated_at",
+		Up:      addColumnIfMissing("products", "updated_at", "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP"),
+		Down:    dropColumnIfExists("products", "updated_at"),
+	},
+	{
+		Version: 16,
+		Name:    "create_inventory",
+		// Existing products start out of stock until their stock is counted
+		Up: func(db *sql.DB) error {
+			if err := addColumnIfMissing("products", "stock_quantity", "INT NOT NULL DEFAULT 0")(db); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing("products", "low_stock_threshold", "INT NOT NULL DEFAULT 5")(db); err != nil {
+				return err
+			}
+			return execStatements(
+				`CREATE TABLE IF NOT EXISTS stock_reservations (
+                reservation_id INT PRIMARY KEY AUTO_INCREMENT,
+                product_id INT NOT NULL,
+                user_id INT NOT NULL,
+                quantity INT NOT NULL,
+                status VARCHAR(20) NOT NULL DEFAULT 'active',
+                created_at DATETIME NOT NULL,
+                expires_at DATETIME NOT NULL,
+                released_at DATETIME NULL,
+                order_id INT NULL,
+                INDEX idx_stock_reservations_product (product_id, status, expires_at),
+                FOREIGN KEY (product_id) REFERENCES products(product_id),
+                FOREIGN KEY (user_id) REFERENCES users(user_id),
+                FOREIGN KEY (order_id) REFERENCES orders(order_id)
+            );`,
+			)(db)
+		},
+		Down: func(db *sql.DB) error {
+			if err := execStatements("DROP TABLE IF EXISTS stock_reservations")(db); err != nil {
+				return err
+			}
+			if err := dropColumnIfExists("products", "low_stock_threshold")(db); err != nil {
+				return err
+			}
+			return dropColumnIfExists("products", "stock_quantity")(db)
+		},
+	},
+	{
+		Version: 17,
+		Name:    "add_orders_product_snapshot",
+		// Orders keep the product name, category and unit price they were placed at, so
+		// later catalogue edits don't rewrite history. Existing orders get the current
+		// name and category and the price they were actually charged per unit.
+		Up: func(db *sql.DB) error {
+			for _, column := range []struct{ name, definition string }{
+				{"product_name", "VARCHAR(255) NOT NULL DEFAULT '' AFTER product_id"},
+				{"category_id", "INT NULL AFTER product_name"},
+				{"unit_price", "DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER category_id"},
+			} {
+				if err := addColumnIfMissing("orders", column.name, column.definition)(db); err != nil {
+					return err
+				}
+			}
+			err := execStatements(
+				`UPDATE orders o JOIN products p ON p.product_id = o.product_id
+                SET o.product_name = p.product_name,
+                    o.category_id = p.category_id,
+                    o.unit_price = COALESCE(o.total_price / NULLIF(o.quantity, 0), p.price)`,
+				"UPDATE orders SET total_price = unit_price * quantity WHERE total_price IS NULL",
+			)(db)
+			if err != nil {
+				return err
+			}
+			return createIndexIfMissing("orders", "idx_orders_user_date", "user_id, order_date, order_id")(db)
+		},
+		Down: func(db *sql.DB) error {
+			if err := dropIndexIfExists("orders", "idx_orders_user_date")(db); err != nil {
+				return err
+			}
+			for _, column := range []string{"unit_price", "category_id", "product_name"} {
+				if err := dropColumnIfExists("orders", column)(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 18,
+		Name:    "add_support_role",
+		Up: execStatements(
+			"INSERT IGNORE INTO roles (role_name, description) VALUES ('support', 'Reads customer orders to answer support requests')",
+		),
+		Down: execStatements(
+			"DELETE FROM user_roles WHERE role_name = 'support'",
+			"DELETE FROM roles WHERE role_name = 'support'",
+		),
+	},
+	{
+		Version: 19,
+		Name:    "create_order_items",
+		// orders becomes the header of a basket whose products are order_items rows, and
+		// gets a status. Every existing order becomes one item and, having been bought
+		// already, is marked paid.
+		Up: func(db *sql.DB) error {
+			if err := execStatements(
+				`CREATE TABLE IF NOT EXISTS order_items (
+                order_item_id INT PRIMARY KEY AUTO_INCREMENT,
+                order_id INT NOT NULL,
+                product_id INT NOT NULL,
+                product_name VARCHAR(255) NOT NULL DEFAULT '',
+                category_id INT NULL,
+                unit_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+                quantity INT NOT NULL,
+                line_total DECIMAL(10, 2) NOT NULL DEFAULT 0,
+                INDEX idx_order_items_order (order_id),
+                FOREIGN KEY (order_id) REFERENCES orders(order_id),
+                FOREIGN KEY (product_id) REFERENCES products(product_id)
+            );`,
+			)(db); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing("orders", "status", "VARCHAR(20) NOT NULL DEFAULT 'pending' AFTER order_date")(db); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing("orders", "updated_at", "DATETIME NULL AFTER status")(db); err != nil {
+				return err
+			}
+
+			single, err := columnExists(db, "orders", "product_id")
+			if err != nil || !single {
+				return err
+			}
+			if err := execStatements(
+				`INSERT INTO order_items (order_id, product_id, product_name, category_id, unit_price, quantity, line_total)
+                SELECT order_id, product_id, product_name, category_id, unit_price, COALESCE(quantity, 1), COALESCE(total_price, 0)
+                FROM orders
+                WHERE product_id IS NOT NULL AND order_id NOT IN (SELECT order_id FROM order_items)`,
+				"UPDATE orders SET status = 'paid', updated_at = order_date, total_price = COALESCE(total_price, 0)",
+			)(db); err != nil {
+				return err
+			}
+			if err := dropForeignKeysOn("orders", "product_id")(db); err != nil {
+				return err
+			}
+			for _, column := range []string{"product_id", "product_name", "category_id", "unit_price", "quantity"} {
+				if err := dropColumnIfExists("orders", column)(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// Going back keeps only the first item of each order; total_price stays the basket total
+		Down: func(db *sql.DB) error {
+			for _, column := range []struct{ name, definition string }{
+				{"product_id", "INT NULL AFTER user_id"},
+				{"product_name", "VARCHAR(255) NOT NULL DEFAULT '' AFTER product_id"},
+				{"category_id", "INT NULL AFTER product_name"},
+				{"unit_price", "DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER category_id"},
+				{"quantity", "INT NULL AFTER order_date"},
+			} {
+				if err := addColumnIfMissing("orders", column.name, column.definition)(db); err != nil {
+					return err
+				}
+			}
+			if err := execStatements(
+				`UPDATE orders o
+                JOIN (SELECT order_id, MIN(order_item_id) AS first_item FROM order_items GROUP BY order_id) f ON f.order_id = o.order_id
+                JOIN order_items i ON i.order_item_id = f.first_item
+                SET o.product_id = i.product_id,
+                    o.product_name = i.product_name,
+                    o.category_id = i.category_id,
+                    o.unit_price = i.unit_price,
+                    o.quantity = i.quantity`,
+				"ALTER TABLE orders ADD FOREIGN KEY (product_id) REFERENCES products(product_id)",
+				"DROP TABLE IF EXISTS order_items",
+			)(db); err != nil {
+				return err
+			}
+			if err := dropColumnIfExists("orders", "updated_at")(db); err != nil {
+				return err
+			}
+			return dropColumnIfExists("orders", "status")(db)
+		},
+	},
+	{
+		Version: 20,
+		Name:    "create_order_events",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS order_events (
+                event_id INT PRIMARY KEY AUTO_INCREMENT,
+                order_id INT NOT NULL,
+                from_status VARCHAR(20) NOT NULL,
+                to_status VARCHAR(20) NOT NULL,
+                amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+                restocked BOOLEAN NOT NULL DEFAULT FALSE,
+                reason VARCHAR(500) NOT NULL DEFAULT '',
+                changed_by INT NULL,
+                created_at DATETIME NOT NULL,
+                INDEX idx_order_events_order (order_id, created_at),
+                FOREIGN KEY (order_id) REFERENCES orders(order_id),
+                FOREIGN KEY (changed_by) REFERENCES users(user_id)
+            );`,
+		),
+		Down: execStatements("DROP TABLE IF EXISTS order_events"),
+	},
+	{
+		Version: 21,
+		Name:    "add_offer_coupon_codes",
+		// Offers get a coupon code, an expiry and the order they were redeemed against.
+		// Existing offers get a fresh code and expire 14 days after they were sent.
+		Up: func(db *sql.DB) error {
+			for _, column := range []struct{ name, definition string }{
+				{"coupon_code", "VARCHAR(32) NULL AFTER user_id"},
+				{"expires_at", "DATETIME NULL AFTER sent_date"},
+				{"used_at", "DATETIME NULL AFTER is_used"},
+				{"order_id", "INT NULL AFTER used_at"},
+			} {
+				if err := addColumnIfMissing("offers", column.name, column.definition)(db); err != nil {
+					return err
+				}
+			}
+			if err := backfillOfferCouponCodes(db); err != nil {
+				return err
+			}
+			for _, step := range []func(db *sql.DB) error{
+				execStatements(
+					"UPDATE offers SET sent_date = COALESCE(sent_date, NOW()), is_used = COALESCE(is_used, FALSE)",
+					"UPDATE offers SET expires_at = sent_date + INTERVAL 14 DAY WHERE expires_at IS NULL",
+					"ALTER TABLE offers MODIFY coupon_code VARCHAR(32) NOT NULL, MODIFY expires_at DATETIME NOT NULL",
+				),
+				createUniqueIndexIfMissing("offers", "uq_offers_coupon_code", "coupon_code"),
+				createUniqueIndexIfMissing("offers", "uq_offers_order", "order_id"),
+				addForeignKeyIfMissing("offers", "fk_offers_order", "order_id", "orders(order_id)"),
+			} {
+				if err := step(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(db *sql.DB) error {
+			for _, step := range []func(db *sql.DB) error{
+				dropForeignKeyIfExists("offers", "fk_offers_order"),
+				dropIndexIfExists("offers", "uq_offers_order"),
+				dropIndexIfExists("offers", "uq_offers_coupon_code"),
+			} {
+				if err := step(db); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"order_id", "used_at", "expires_at", "coupon_code"} {
+				if err := dropColumnIfExists("offers", column)(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 22,
+		Name:    "add_user_activities_order_id",
+		// Purchase activities point at their order, so they can be left out of the streak
+		// features once the order is cancelled or refunded. Older activities have none.
+		Up: func(db *sql.DB) error {
+			exists, err := columnExists(db, "user_activities", "order_id")
+			if err != nil || exists {
+				return err
+			}
+			return execStatements(`ALTER TABLE user_activities
+                ADD COLUMN order_id INT NULL AFTER activity_value,
+                ADD CONSTRAINT fk_user_activities_order FOREIGN KEY (order_id) REFERENCES orders(order_id)`,
+			)(db)
+		},
+		Down: func(db *sql.DB) error {
+			if err := dropForeignKeysOn("user_activities", "order_id")(db); err != nil {
+				return err
+			}
+			return dropColumnIfExists("user_activities", "order_id")(db)
+		},
+	},
+}
+
+// backfillProductSearchNames fills products.search_name, which is computed in Go
+// (foldVietnamese) because MySQL collations don't fold "đ" to "d"
+func backfillProductSearchNames(db *sql.DB) error {
+	rows, err := db.Query("SELECT product_id, product_name FROM products")
+	if err != nil {
+		return fmt.Errorf("error reading products: %w", err)
+	}
+	names := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fmt.Errorf("error reading products: %w", err)
+		}
+		names[id] = name
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading products: %w", err)
+	}
+
+	for id, name := range names {
+		if _, err := db.Exec("UPDATE products SET search_name = ? WHERE product_id = ?", foldVietnamese(name), id); err != nil {
+			return fmt.Errorf("error updating search name of product %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// backfillOfferCouponCodes gives every offer without a coupon code a new random one,
+// which is generated in Go like the codes of new offers
+func backfillOfferCouponCodes(db *sql.DB) error {
+	rows, err := db.Query("SELECT offer_id FROM offers WHERE coupon_code IS NULL")
+	if err != nil {
+		return fmt.Errorf("error reading offers: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("error reading offers: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading offers: %w", err)
+	}
+
+	for _, id := range ids {
+		code, err := newCouponCode()
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec("UPDATE offers SET coupon_code = ? WHERE offer_id = ?", code, id); err != nil {
+			return fmt.Errorf("error updating coupon code of offer %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// migrateCategoriesUp creates the category tables, seeds defaultCategories and moves
+// every category name stored elsewhere to a category ID. Names that don't match a
+// category (in any locale) become new top-level categories.
+func migrateCategoriesUp(db *sql.DB) error {
+	err := execStatements(
+		`CREATE TABLE IF NOT EXISTS categories (
+            category_id INT PRIMARY KEY AUTO_INCREMENT,
+            slug VARCHAR(100) NOT NULL UNIQUE,
+            parent_id INT NULL,
+            FOREIGN KEY (parent_id) REFERENCES categories(category_id)
+        );`,
+		`CREATE TABLE IF NOT EXISTS category_names (
+            category_id INT NOT NULL,
+            locale VARCHAR(10) NOT NULL,
+            name VARCHAR(255) NOT NULL,
+            PRIMARY KEY (category_id, locale),
+            INDEX idx_category_names_name (name),
+            FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE
+        );`,
+		`CREATE TABLE IF NOT EXISTS user_preferred_categories (
+            user_id INT NOT NULL,
+            category_id INT NOT NULL,
+            position INT NOT NULL,
+            PRIMARY KEY (user_id, category_id),
+            FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+            FOREIGN KEY (category_id) REFERENCES categories(category_id)
+        );`,
+	)(db)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range defaultCategories() {
+		if _, err := db.Exec("INSERT IGNORE INTO categories (category_id, slug, parent_id) VALUES (?, ?, ?)", c.CategoryID, c.Slug, c.ParentID); err != nil {
+			return fmt.Errorf("error seeding category %s: %w", c.Slug, err)
+		}
+		for locale, name := range c.Names {
+			if _, err := db.Exec("INSERT IGNORE INTO category_names (category_id, locale, name) VALUES (?, ?, ?)", c.CategoryID, locale, name); err != nil {
+				return fmt.Errorf("error seeding category %s: %w", c.Slug, err)
+			}
+		}
+	}
+
+	resolver := categoryResolver{db: db, ids: make(map[string]int)}
+
+	// products.category -> products.category_id
+	if err := addColumnIfMissing("products", "category_id", "INT NULL AFTER product_name")(db); err != nil {
+		return err
+	}
+	if exists, err := columnExists(db, "products", "category"); err != nil {
+		return err
+	} else if exists {
+		if err := resolver.backfill("SELECT DISTINCT category FROM products", "UPDATE products SET category_id = ? WHERE category = ?"); err != nil {
+			return err
+		}
+		for _, step := range []func(db *sql.DB) error{
+			execStatements("ALTER TABLE products MODIFY category_id INT NOT NULL"),
+			addForeignKeyIfMissing("products", "fk_products_category", "category_id", "categories(category_id)"),
+			dropIndexIfExists("products", "idx_products_category"),
+			dropColumnIfExists("products", "category"),
+		} {
+			if err := step(db); err != nil {
+				return err
+			}
+		}
+	}
+
+	// user_preferences.preferred_categories (comma-separated) -> user_preferred_categories
+	if exists, err := columnExists(db, "user_preferences", "preferred_categories"); err != nil {
+		return err
+	} else if exists {
+		if err := resolver.backfillPreferences(); err != nil {
+			return err
+		}
+		if err := dropColumnIfExists("user_preferences", "preferred_categories")(db); err != nil {
+			return err
+		}
+	}
+
+	// offers.target_category -> offers.target_category_id
+	if err := addColumnIfMissing("offers", "target_category_id", "INT NULL AFTER offer_value")(db); err != nil {
+		return err
+	}
+	if exists, err := columnExists(db, "offers", "target_category"); err != nil {
+		return err
+	} else if exists {
+		err := resolver.backfill("SELECT DISTINCT target_category FROM offers WHERE target_category <> ''", "UPDATE offers SET target_category_id = ? WHERE target_category = ?")
+		if err != nil {
+			return err
+		}
+		if err := addForeignKeyIfMissing("offers", "fk_offers_target_category", "target_category_id", "categories(category_id)")(db); err != nil {
+			return err
+		}
+		return dropColumnIfExists("offers", "target_category")(db)
+	}
+	return nil
+}
+
+// migrateCategoriesDown copies the default-locale category names back into the old
+// free-text columns and drops the category tables
+func migrateCategoriesDown(db *sql.DB) error {
+	if err := addColumnIfMissing("offers", "target_category", "VARCHAR(255) AFTER offer_value")(db); err != nil {
+		return err
+	}
+	if exists, err := columnExists(db, "offers", "target_category_id"); err != nil {
+		return err
+	} else if exists {
+		for _, step := range []func(db *sql.DB) error{
+			execStatements(`UPDATE offers o JOIN category_names n ON n.category_id = o.target_category_id AND n.locale = 'vi'
+             SET o.target_category = n.name`),
+			dropForeignKeyIfExists("offers", "fk_offers_target_category"),
+			dropColumnIfExists("offers", "target_category_id"),
+		} {
+			if err := step(db); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := addColumnIfMissing("user_preferences", "preferred_categories", "TEXT AFTER user_id")(db); err != nil {
+		return err
+	}
+	err := execStatements(
+		`UPDATE user_preferences p SET preferred_categories = COALESCE((
+             SELECT GROUP_CONCAT(n.name ORDER BY upc.position SEPARATOR ',')
+             FROM user_preferred_categories upc
+             JOIN category_names n ON n.category_id = upc.category_id AND n.locale = 'vi'
+             WHERE upc.user_id = p.user_id
+         ), '')`,
+		"DROP TABLE IF EXISTS user_preferred_categories",
+	)(db)
+	if err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing("products", "category", "VARCHAR(255) NOT NULL DEFAULT '' AFTER product_name")(db); err != nil {
+		return err
+	}
+	if exists, err := columnExists(db, "products", "category_id"); err != nil {
+		return err
+	} else if exists {
+		for _, step := range []func(db *sql.DB) error{
+			execStatements(
+				`UPDATE products p JOIN category_names n ON n.category_id = p.category_id AND n.locale = 'vi'
+             SET p.category = n.name`,
+				"ALTER TABLE products MODIFY category VARCHAR(255) NOT NULL",
+			),
+			createIndexIfMissing("products", "idx_products_category", "category"),
+			dropForeignKeyIfExists("products", "fk_products_category"),
+			dropColumnIfExists("products", "category_id"),
+		} {
+			if err := step(db); err != nil {
+				return err
+			}
+		}
+	}
+
+	return execStatements(
+		"DROP TABLE IF EXISTS category_names",
+		"DROP TABLE IF EXISTS categories",
+	)(db)
+}
+
+// categoryResolver maps free-text category names to category IDs during migration 14,
+// creating a category for each name it can't match
+type categoryResolver struct {
+	db  *sql.DB
+	ids map[string]int
+}
+
+// categoryID returns the ID of the category with this name (in any locale) or slug
+func (r categoryResolver) categoryID(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Khác" // products.category was NOT NULL but could be empty
+	}
+	if id, ok := r.ids[name]; ok {
+		return id, nil
+	}
+
+	slug := categorySlug(name)
+	var id int
+	err := r.db.QueryRow(`
+		SELECT category_id FROM category_names WHERE name = ?
+		UNION SELECT category_id FROM categories WHERE slug = ?
+		LIMIT 1
+	`, name, slug).Scan(&id)
+	if err == sql.ErrNoRows {
+		id, err = r.createCategory(name, slug)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error resolving category %q: %w", name, err)
+	}
+	r.ids[name] = id
+	return id, nil
+}
+
+// createCategory inserts a top-level category, suffixing the slug until it is unique
+func (r categoryResolver) createCategory(name, slug string) (int, error) {
+	if slug == "" {
+		slug = "category"
+	}
+	candidate := slug
+	for n := 2; ; n++ {
+		var count int
+		if err := r.db.QueryRow("SELECT COUNT(*) FROM categories WHERE slug = ?", candidate).Scan(&count); err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			break
+		}
+		candidate = slug + "-" + strconv.Itoa(n)
+	}
+
+	result, err := r.db.Exec("INSERT INTO categories (slug) VALUES (?)", candidate)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.db.Exec("INSERT INTO category_names (category_id, locale, name) VALUES (?, ?, ?)", id, defaultLocale, name); err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// backfill resolves each name returned by selectNames and runs update with (id, name)
+func (r categoryResolver) backfill(selectNames, update string) error {
+	names, err := queryStrings(r.db, selectNames)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		id, err := r.categoryID(name)
+		if err != nil {
+			return err
+		}
+		if _, err := r.db.Exec(update, id, name); err != nil {
+			return fmt.Errorf("error migrating category %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// backfillPreferences splits user_preferences.preferred_categories into user_preferred_categories rows
+func (r categoryResolver) backfillPreferences() error {
+	rows, err := r.db.Query("SELECT user_id, preferred_categories FROM user_preferences WHERE preferred_categories <> ''")
+	if err != nil {
+		return fmt.Errorf("error reading user preferences: %w", err)
+	}
+	preferences := make(map[int]string)
+	for rows.Next() {
+		var userID int
+		var categories string
+		if err := rows.Scan(&userID, &categories); err != nil {
+			rows.Close()
+			return fmt.Errorf("error reading user preferences: %w", err)
+		}
+		preferences[userID] = categories
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading user preferences: %w", err)
+	}
+
+	for userID, categories := range preferences {
+		position := 0
+		for _, name := range strings.Split(categories, ",") {
+			if strings.TrimSpace(name) == "" {
+				continue
+			}
+			id, err := r.categoryID(name)
+			if err != nil {
+				return err
+			}
+			_, err = r.db.Exec("INSERT IGNORE INTO user_preferred_categories (user_id, category_id, position) VALUES (?, ?, ?)", userID, id, position)
+			if err != nil {
+				return fmt.Errorf("error migrating preferred categories of user %d: %w", userID, err)
+			}
+			position++
+		}
+	}
+	return nil
+}
+
+// queryStrings returns the first column of every row of a query
+func queryStrings(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w\nSQL: %s", err, query)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// execStatements returns a migration step that runs the given SQL statements in order
+func execStatements(statements ...string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		for _, stmt := range statements {
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("%w\nSQL: %s", err, stmt)
+			}
+		}
+		return nil
+	}
+}
+
+// withoutForeignKeyChecks returns a migration step that runs statements with
+// FOREIGN_KEY_CHECKS disabled, which MySQL requires to alter a column other tables reference.
+// The setting is per session, so every statement runs on the same pooled connection.
+func withoutForeignKeyChecks(statements ...string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		ctx := context.Background()
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1")
+
+		for _, stmt := range statements {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%w\nSQL: %s", err, stmt)
+			}
+		}
+		return nil
+	}
+}
+
+// addColumnIfMissing returns a migration step that adds a column unless it already exists.
+// MySQL has no ADD COLUMN IF NOT EXISTS, so information_schema is checked first.
+func addColumnIfMissing(table, column, definition string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		exists, err := columnExists(db, table, column)
+		if err != nil || exists {
+			return err
+		}
+		return execStatements(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))(db)
+	}
+}
+
+// dropColumnIfExists returns a migration step that drops a column if it exists
+func dropColumnIfExists(table, column string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		exists, err := columnExists(db, table, column)
+		if err != nil || !exists {
+			return err
+		}
+		return execStatements(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column))(db)
+	}
+}
+
+// createIndexIfMissing returns a migration step that adds an index if it doesn't exist,
+// so a migration that failed after creating it can be re-run
+func createIndexIfMissing(table, index, columns string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		exists, err := indexExists(db, table, index)
+		if err != nil || exists {
+			return err
+		}
+		return execStatements(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", index, table, columns))(db)
+	}
+}
+
+// createUniqueIndexIfMissing is createIndexIfMissing for a unique index
+func createUniqueIndexIfMissing(table, index, columns string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		exists, err := indexExists(db, table, index)
+		if err != nil || exists {
+			return err
+		}
+		return execStatements(fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", index, table, columns))(db)
+	}
+}
+
+// dropIndexIfExists returns a migration step that drops an index if it exists
+func dropIndexIfExists(table, index string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		exists, err := indexExists(db, table, index)
+		if err != nil || !exists {
+			return err
+		}
+		return execStatements(fmt.Sprintf("DROP INDEX %s ON %s", index, table))(db)
+	}
+}
+
+// addForeignKeyIfMissing returns a migration step that adds a named foreign key from
+// column to references, e.g. "categories(category_id)", unless it already exists
+func addForeignKeyIfMissing(table, constraint, column, references string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		exists, err := foreignKeyExists(db, table, constraint)
+		if err != nil || exists {
+			return err
+		}
+		return execStatements(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s", table, constraint, column, references))(db)
+	}
+}
+
+// dropForeignKeyIfExists returns a migration step that drops a named foreign key if it exists
+func dropForeignKeyIfExists(table, constraint string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		exists, err := foreignKeyExists(db, table, constraint)
+		if err != nil || !exists {
+			return err
+		}
+		return execStatements(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, constraint))(db)
+	}
+}
+
+// dropForeignKeysOn returns a migration step that drops the foreign keys on a column,
+// whose names MySQL generated when the table was created
+func dropForeignKeysOn(table, column string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		rows, err := db.Query(`
+			SELECT constraint_name FROM information_schema.key_column_usage
+			WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ? AND referenced_table_name IS NOT NULL
+		`, table, column)
+		if err != nil {
+			return fmt.Errorf("error listing foreign keys on %s.%s: %w", table, column, err)
+		}
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			names = append(names, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if err := execStatements(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, name))(db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// columnExists reports whether a column exists in the current database
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?
+	`, table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking column %s.%s: %w", table, column, err)
+	}
+	return count > 0, nil
+}
+
+// indexExists checks information_schema for an index on a table in the current database
+func indexExists(db *sql.DB, table, index string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?
+	`, table, index).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking index %s.%s: %w", table, index, err)
+	}
+	return count > 0, nil
+}
+
+// foreignKeyExists checks information_schema for a foreign key on a table in the current database
+func foreignKeyExists(db *sql.DB, table, constraint string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.table_constraints
+		WHERE table_schema = DATABASE() AND table_name = ? AND constraint_name = ? AND constraint_type = 'FOREIGN KEY'
+	`, table, constraint).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking foreign key %s.%s: %w", table, constraint, err)
+	}
+	return count > 0, nil
+}
+
+// ensureMigrationsTable creates the schema_migrations bookkeeping table
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INT PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        applied_at DATETIME NOT NULL
+    );`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the set of migration versions recorded in schema_migrations
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// sortedMigrations returns the migrations ordered by version
+func sortedMigrations() []Migration {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+// MigrateUp applies pending migrations up to and including target (0 means latest)
+func MigrateUp(db *sql.DB, target int) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, m := range sortedMigrations() {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, done := applied[m.Version]; done {
+			continue
+		}
+
+		fmt.Printf("Applying migration %d_%s...\n", m.Version, m.Name)
+		if err := m.Up(db); err != nil {
+			return fmt.Errorf("error applying migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now())
+		if err != nil {
+			return fmt.Errorf("error recording migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	if count == 0 {
+		fmt.Println("Database schema is up to date.")
+	} else {
+		fmt.Printf("Applied %d migration(s).\n", count)
+	}
+	return nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, steps at a time
+func MigrateDown(db *sql.DB, steps int) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	sorted := sortedMigrations()
+	for i := len(sorted) - 1; i >= 0 && steps > 0; i-- {
+		m := sorted[i]
+		if _, done := applied[m.Version]; !done {
+			continue
+		}
+
+		fmt.Printf("Reverting migration %d_%s...\n", m.Version, m.Name)
+		if err := m.Down(db); err != nil {
+			return fmt.Errorf("error reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := db.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+			return fmt.Errorf("error unrecording migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+// PrintMigrationStatus lists every known migration and whether it has been applied
+func PrintMigrationStatus(db *sql.DB) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sortedMigrations() {
+		if appliedAt, done := applied[m.Version]; done {
+			fmt.Printf("  [x] %03d_%s (applied %s)\n", m.Version, m.Name, appliedAt.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Printf("  [ ] %03d_%s\n", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// RunMigrateCommand handles `migrate up [version]`, `migrate down [steps]` and `migrate status`
+func RunMigrateCommand(mysqlDSN string, args []string) error {
+	if mysqlDSN == "" {
+		return fmt.Errorf("MYSQL_DSN must be set to run migrations")
+	}
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	// up defaults to every pending migration, down to the latest one; an explicit
+	// `migrate down 0` reverts nothing
+	n := 0
+	if action == "down" {
+		n = 1
+	}
+	if len(args) > 1 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid migration argument %q", args[1])
+		}
+	}
+
+	db, err := OpenMySQL(mysqlDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch action {
+	case "up":
+		return MigrateUp(db, n)
+	case "down":
+		return MigrateDown(db, n)
+	case "status":
+		return PrintMigrationStatus(db)
+	default:
+		return fmt.Errorf("unknown migrate action %q (expected up, down or status)", action)
+	}
+}
@@ -2,53 +2,349 @@ package main
 
 import "time"
 
-// Order struct represents a row in the orders table
+// Order struct represents a row in the orders table: the header of an order, whose
+// products are its Items (rows of order_items)
 type Order struct {
+	OrderID    int         `json:"order_id"`
+	UserID     int         `json:"user_id"`
+	OrderDate  time.Time   `json:"order_date"`
+	Status     string      `json:"status"`      // see the Order* status constants
+	UpdatedAt  time.Time   `json:"updated_at"`  // when the status last changed
+	TotalPrice float64     `json:"total_price"` // the sum of the items' line totals
+	Items      []OrderItem `json:"items"`
+}
+
+// Order statuses. An order is placed pending, then paid and shipped; it can be
+// cancelled before it ships and refunded once paid (see orderStatusTransitions).
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+// OrderItem struct represents a row in the order_items table: one product of an order.
+// ProductName, CategoryID and UnitPrice are a snapshot of the product when it was ordered.
+type OrderItem struct {
+	OrderItemID int     `json:"order_item_id"`
+	ProductID   int     `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	CategoryID  int     `json:"category_id"`
+	UnitPrice   float64 `json:"unit_price"`
+	Quantity    int     `json:"quantity"`
+	LineTotal   float64 `json:"line_total"`
+	// ReservationID is only read by PlaceOrder: the reservation the units are taken from
+	ReservationID int `json:"-"`
+}
+
+// OrderQuery filters and pages a user's order history, newest first
+type OrderQuery struct {
+	UserID int
+	From   *time.Time // inclusive
+	Before *time.Time // exclusive
+	// After continues the listing after the order a previous page ended with
+	After *OrderCursor
+	Limit int
+}
+
+// OrderCursor is the keyset position of the last order on a page, handed to clients
+// as an opaque string like ProductCursor
+type OrderCursor struct {
+	OrderDate time.Time `json:"t"`
+	OrderID   int       `json:"id"`
+}
+
+// OrderStats summarises a user's whole order history for the streak features. Cancelled
+// and refunded orders are left out of everything but RefundedOrders. RecentSpent and
+// PreviousSpent split the spend into two trend windows.
+type OrderStats struct {
+	TotalOrders    int
+	RefundedOrders int
+	TotalSpent     float64
+	TotalUnits     int // units across every item, for the basket size
+	FirstOrderDate *time.Time
+	LastOrderDate  *time.Time
+	RecentSpent    float64 // placed at or after the trend split
+	PreviousSpent  float64 // placed in [trend start, trend split)
+}
+
+// OrderListResponse is the envelope returned by GET /api/me/orders
+type OrderListResponse struct {
+	Orders     []Order `json:"orders"`
+	NextCursor *string `json:"next_cursor"`
+	Total      int     `json:"total"`
+}
+
+// PlaceOrderRequest struct for POST /api/orders; prices are always taken from the catalogue.
+// A single product can still be ordered with the top-level fields instead of items.
+type PlaceOrderRequest struct {
+	Items         []PlaceOrderItem `json:"items"`
+	ProductID     int              `json:"product_id"`
+	Quantity      int              `json:"quantity"`
+	ReservationID int              `json:"reservation_id"`
+}
+
+// PlaceOrderItem is one line of a PlaceOrderRequest
+type PlaceOrderItem struct {
+	ProductID     int `json:"product_id"`
+	Quantity      int `json:"quantity"`
+	ReservationID int `json:"reservation_id"` // optional, from POST /api/products/{id}/reservations
+}
+
+// OrderStatusRequest struct for PATCH /api/orders/{id}/status
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// OrderReversalRequest struct for POST /api/orders/{id}/cancel and /refund
+type OrderReversalRequest struct {
+	Reason string `json:"reason"` // optional
+}
+
+// OrderEvent struct represents a row in the order_events table: one status change of an
+// order. Cancellations and refunds are reversal events, whose Amount is the money given
+// back as a negative number.
+type OrderEvent struct {
+	EventID    int       `json:"event_id"`
 	OrderID    int       `json:"order_id"`
-	UserID     int       `json:"user_id"`
-	ProductID  int       `json:"product_id"`
-	OrderDate  time.Time `json:"order_date"`
-	Quantity   int       `json:"quantity"`
-	TotalPrice float64   `json:"total_price"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Amount     float64   `json:"amount"`
+	Restocked  bool      `json:"restocked"` // the items' units went back into stock
+	Reason     string    `json:"reason,omitempty"`
+	ChangedBy  *int      `json:"changed_by"` // nil for API keys
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PlaceOrderResponse struct for a placed order and the purchase streak it extended
+type PlaceOrderResponse struct {
+	Order
+	CurrentStreak int `json:"current_streak"`
 }
 
 // Product struct represents a row in the products table
 type Product struct {
-	ProductID   int     `json:"product_id"`
-	ProductName string  `json:"product_name"`
-	Category    string  `json:"category"`
-	Price       float64 `json:"price"`
+	ProductID   int        `json:"product_id"`
+	ProductName string     `json:"product_name"`
+	CategoryID  int        `json:"category_id"`
+	Price       float64    `json:"price"`
+	UpdatedAt   time.Time  `json:"updated_at"`           // Last-Modified of GET /api/products/{id}
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // Soft delete; orders keep referencing the row
+
+	StockQuantity     int `json:"stock_quantity"`      // Units on hand
+	ReservedQuantity  int `json:"reserved_quantity"`   // Units held by active, unexpired reservations
+	LowStockThreshold int `json:"low_stock_threshold"` // Low-stock alert when the available quantity drops to this
+}
+
+// AvailableQuantity is the stock that can still be reserved or ordered
+func (p Product) AvailableQuantity() int {
+	return p.StockQuantity - p.ReservedQuantity
+}
+
+// IsLowStock reports whether the available quantity is at or below the low-stock threshold
+func (p Product) IsLowStock() bool {
+	return p.AvailableQuantity() <= p.LowStockThreshold
+}
+
+// StockReservation represents a row in the stock_reservations table: units of a product
+// held for a user's checkout until ExpiresAt
+type StockReservation struct {
+	ReservationID int        `json:"reservation_id"`
+	ProductID     int        `json:"product_id"`
+	UserID        int        `json:"user_id"`
+	Quantity      int        `json:"quantity"`
+	Status        string     `json:"status"` // active, released, ordered or expired
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"` // When it was released or ordered
+	OrderID       *int       `json:"order_id,omitempty"`
+}
+
+// Stock reservation statuses; "expired" is never stored, it is an active reservation past ExpiresAt
+const (
+	ReservationActive   = "active"
+	ReservationReleased = "released"
+	ReservationOrdered  = "ordered"
+	ReservationExpired  = "expired"
+)
+
+// StockChange is an inventory update applied by UpdateProductStock
+type StockChange struct {
+	Quantity          *int // Sets the stock on hand (a stock count); takes precedence over Adjustment
+	Adjustment        int  // Added to the stock on hand (a delivery, or a write-off when negative)
+	LowStockThreshold *int
+	ChangedAt         time.Time
+}
+
+// ProductUpsert is one product saved by UpsertProducts. A created product takes its
+// stock from Product; an updated one keeps its inventory unless Stock is set.
+type ProductUpsert struct {
+	Product Product
+	Stock   *StockChange
+}
+
+// ProductPriceChange represents a row in the product_price_changes audit table
+type ProductPriceChange struct {
+	ChangeID  int       `json:"change_id"`
+	ProductID int       `json:"product_id"`
+	OldPrice  *float64  `json:"old_price"` // nil when the product was created
+	NewPrice  float64   `json:"new_price"`
+	ChangedBy *int      `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ProductRequest struct for creating (POST) or replacing (PUT) a product
+type ProductRequest struct {
+	ProductID   int      `json:"product_id"` // optional on create
+	ProductName string   `json:"product_name"`
+	CategoryID  int      `json:"category_id"`
+	Price       *float64 `json:"price"`
+
+	// Create only; PUT and PATCH leave the inventory alone (see PATCH /api/products/{id}/stock)
+	StockQuantity     int  `json:"stock_quantity"`
+	LowStockThreshold *int `json:"low_stock_threshold"`
+}
+
+// ProductPatchRequest struct for partial product updates; nil fields are left unchanged
+type ProductPatchRequest struct {
+	ProductName *string  `json:"product_name"`
+	CategoryID  *int     `json:"category_id"`
+	Price       *float64 `json:"price"`
+}
+
+// StockUpdateRequest struct for PATCH /api/products/{id}/stock; nil fields are left unchanged
+type StockUpdateRequest struct {
+	StockQuantity     *int `json:"stock_quantity"` // Absolute count, e.g. after a stocktake
+	Adjustment        *int `json:"adjustment"`     // Relative change; can't be combined with stock_quantity
+	LowStockThreshold *int `json:"low_stock_threshold"`
+}
+
+// StockReservationRequest struct for POST /api/products/{id}/reservations
+type StockReservationRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// Sort fields accepted by ListProducts, named after the JSON fields
+const (
+	ProductSortID    = "product_id"
+	ProductSortName  = "product_name"
+	ProductSortPrice = "price"
+)
+
+// ProductQuery filters, sorts and pages the product listing
+type ProductQuery struct {
+	// CategoryIDs restricts the listing to these categories (a category and its subcategories)
+	CategoryIDs []int
+	MinPrice    *float64
+	MaxPrice    *float64
+	// SearchTerms are folded words (see searchTerms) that must all appear in the name
+	SearchTerms []string
+	SortBy      string
+	Desc        bool
+	// After continues the listing after the product a previous page ended with
+	After *ProductCursor
+	Limit int
+}
+
+// Category represents a row in the categories table with its localized names.
+// Name and Children are filled in for API responses (see buildCategoryTree).
+type Category struct {
+	CategoryID int               `json:"category_id"`
+	Slug       string            `json:"slug"`
+	ParentID   *int              `json:"parent_id"`
+	Names      map[string]string `json:"names"` // locale -> name, from category_names
+	Name       string            `json:"name"`
+	Children   []*Category       `json:"children,omitempty"`
+}
+
+// CategoryRef is a short reference to a category, as used in breadcrumbs
+type CategoryRef struct {
+	CategoryID int    `json:"category_id"`
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+}
+
+// ProductDetailResponse is returned by GET /api/products/{id}
+type ProductDetailResponse struct {
+	Product
+	Category     *Category     `json:"category"`
+	CategoryPath []CategoryRef `json:"category_path"` // From the top-level category down to Category
+}
+
+// ProductImportReport summarizes a bulk product import (see importProducts)
+type ProductImportReport struct {
+	DryRun    bool                 `json:"dry_run"`
+	Rows      int                  `json:"rows"`
+	Created   int                  `json:"created"`
+	Updated   int                  `json:"updated"`
+	Unchanged int                  `json:"unchanged"`
+	Errors    []ProductImportError `json:"errors"`
+}
+
+// ProductImportError reports why a row of an import file was rejected
+type ProductImportError struct {
+	Line      int    `json:"line"` // Line of the file the row starts on
+	ProductID int    `json:"product_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+// ProductCursor is the keyset position of the last product on a page. It is handed
+// to clients as an opaque string (see encodeProductCursor).
+type ProductCursor struct {
+	SortBy    string  `json:"s"`
+	Desc      bool    `json:"d,omitempty"`
+	Price     float64 `json:"p,omitempty"`
+	Name      string  `json:"n,omitempty"`
+	ProductID int     `json:"id"`
+}
+
+// ProductListResponse is the envelope returned by GET /api/products
+type ProductListResponse struct {
+	Products   []Product `json:"products"`
+	NextCursor *string   `json:"next_cursor"`
+	Total      int       `json:"total"`
 }
 
 // UserPreference struct represents a row in the user_preferences table
 type UserPreference struct {
-	UserID              int     `json:"user_id"`
-	PreferredCategories string  `json:"preferred_categories"` // Comma-separated string
-	ChurnRisk           float64 `json:"churn_risk"`
+	UserID               int     `json:"user_id"`
+	PreferredCategoryIDs []int   `json:"preferred_category_ids"` // Most preferred first, from user_preferred_categories
+	ChurnRisk            float64 `json:"churn_risk"`
 }
 
-// Offer struct represents a row in the offers table
+// Offer struct represents a row in the offers table. Redeeming it against an order sets
+// IsUsed, UsedAt and OrderID.
 type Offer struct {
-	OfferID          int       `json:"offer_id"`
-	UserID           int       `json:"user_id"`
-	OfferType        string    `json:"offer_type"`
-	OfferValue       string    `json:"offer_value"`
-	TargetCategory   string    `json:"target_category"`
-	GeneratedMessage string    `json:"generated_message"`
-	SentDate         time.Time `json:"sent_date"`
-	IsUsed           bool      `json:"is_used"`
+	OfferID          int        `json:"offer_id"`
+	UserID           int        `json:"user_id"`
+	CouponCode       string     `json:"coupon_code"`
+	OfferType        string     `json:"offer_type"`
+	OfferValue       string     `json:"offer_value"`
+	TargetCategoryID int        `json:"target_category_id"`
+	GeneratedMessage string     `json:"generated_message"`
+	SentDate         time.Time  `json:"sent_date"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	IsUsed           bool       `json:"is_used"`
+	UsedAt           *time.Time `json:"used_at,omitempty"`
+	OrderID          *int       `json:"order_id,omitempty"`
+}
+
+// RedeemOfferRequest struct for POST /api/offers/{id}/redeem and POST /api/offers/redeem;
+// the coupon code is only read by the latter
+type RedeemOfferRequest struct {
+	CouponCode string `json:"coupon_code"`
+	OrderID    int    `json:"order_id"`
 }
 
 // UserData combines various user-related information for processing
 type UserData struct {
 	User
-	RecentOrders []struct {
-		OrderDate   time.Time
-		Category    string
-		ProductName string
-	}
-	PreferredCategories []string
-	ChurnRisk           float64
+	RecentOrders         []Order // the latest 5, newest first
+	PreferredCategoryIDs []int
+	ChurnRisk            float64
+	// SerialReturner is set by callers that check the refund rate (see serialReturner)
+	SerialReturner bool
 }
 
 // OpenAI structures for API request/response
@@ -80,6 +376,14 @@ type UserStreak struct {
 	IsActive         bool      `json:"is_active"`
 }
 
+// UserActivity represents a row in the user_activities table
+type UserActivity struct {
+	ActivityType  string    `json:"activity_type"`
+	ActivityDate  time.Time `json:"activity_date"`
+	ActivityValue float64   `json:"activity_value"`
+	OrderID       *int      `json:"order_id,omitempty"` // Set on the "purchase" activity of an order
+}
+
 // StreakFeatures contains features for ML model prediction
 type StreakFeatures struct {
 	UserID                   int     `json:"user_id"`
@@ -94,6 +398,10 @@ type StreakFeatures struct {
 	ChurnRisk                float64 `json:"churn_risk"`
 	PreferredCategoriesCount int     `json:"preferred_categories_count"`
 	LastOrderDaysAgo         int     `json:"last_order_days_ago"`
+	OrderFrequency           float64 `json:"order_frequency"`     // orders per 30 days since the first order
+	AverageBasketSize        float64 `json:"average_basket_size"` // units per order
+	SpendTrend               float64 `json:"spend_trend"`         // -1 (stopped spending) to 1 (started), last 90 days against the 90 before
+	RefundRate               float64 `json:"refund_rate"`         // share of the orders (not cancelled) that were refunded
 	SeasonalFactor           float64 `json:"seasonal_factor"`
 	WeekendActivityRatio     float64 `json:"weekend_activity_ratio"`
 	EveningActivityRatio     float64 `json:"evening_activity_ratio"`
@@ -131,9 +439,10 @@ type User struct {
 	UserID         int        `json:"user_id"`
 	Username       string     `json:"username"`
 	Email          string     `json:"email"`
-	PasswordHash   string     `json:"password_hash"` // Added for password, JSON ignore
+	PasswordHash   string     `json:"-"` // bcrypt/argon2id hash, never serialized
 	LastLogin      *time.Time `json:"last_login"`
 	RegisteredDate time.Time  `json:"registered_date"`
+	Roles          []string   `json:"roles"` // From user_roles; see rbac.go
 }
 
 // ... (các structs khác giữ nguyên) ...
@@ -145,14 +454,27 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// RegisterRequest struct for API registration
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 // LoginResponse struct for API login
 type LoginResponse struct {
 	UserID            int                `json:"user_id"`
 	Username          string             `json:"username"`
-	Token             string             `json:"token"` // In a real app, this would be a JWT or session token
+	Token             string             `json:"token"`         // Signed JWT access token
+	TokenType         string             `json:"token_type"`    // Always "Bearer"
+	ExpiresIn         int                `json:"expires_in"`    // Access token lifetime in seconds
+	RefreshToken      string             `json:"refresh_token"` // Opaque, long-lived; exchange at /api/token/refresh
+	Roles             []string           `json:"roles"`
 	Message           string             `json:"message"`
 	Success           bool               `json:"success"`
 	OfferNotification *OfferNotification `json:"offer_notification,omitempty"` // Optional for push notification
+	MFARequired       bool               `json:"mfa_required,omitempty"`       // Password accepted, a TOTP code is still needed
+	MFAToken          string             `json:"mfa_token,omitempty"`          // Challenge token for /api/login/mfa
 }
 
 // OfferNotification struct for push notification
@@ -160,5 +482,164 @@ type OfferNotification struct {
 	Title   string `json:"title"`
 	Message string `json:"message"`
 	OfferID int    `json:"offer_id"`
+	// CouponCode redeems the offer at checkout (POST /api/offers/redeem)
+	CouponCode string `json:"coupon_code"`
 	// Thêm các trường khác cần thiết cho frontend (ví dụ: offer_type, offer_value)
 }
+
+// RefreshToken represents a row in the refresh_tokens table.
+// Only the SHA-256 hash of the token is stored. Every rotation stays in the same
+// family, so reuse of an already rotated token can revoke the whole session.
+type RefreshToken struct {
+	TokenID   int        `json:"token_id"`
+	UserID    int        `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	TokenHash string     `json:"-"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// LoginAttempt represents a row in the login_attempts table: the failed login
+// counter for one account ("user:<id>") or one client IP ("ip:<addr>")
+type LoginAttempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// PasswordResetToken represents a row in the password_reset_tokens table.
+// Like refresh tokens, only the SHA-256 hash of the emailed token is stored.
+type PasswordResetToken struct {
+	TokenID   int        `json:"token_id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// ForgotPasswordRequest struct for API password reset requests
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest struct for API password resets
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// UserMFA represents a row in the user_mfa table. EnabledAt is nil while an
+// enrolment is pending confirmation. LastUsedStep is the last accepted TOTP time
+// step, so a code can't be replayed within its validity window.
+type UserMFA struct {
+	UserID       int        `json:"user_id"`
+	TOTPSecret   string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	EnabledAt    *time.Time `json:"enabled_at"`
+	LastUsedStep int64      `json:"-"`
+}
+
+// RecoveryCode represents a row in the mfa_recovery_codes table
+type RecoveryCode struct {
+	CodeID   int        `json:"code_id"`
+	UserID   int        `json:"user_id"`
+	CodeHash string     `json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+// UpdateRolesRequest struct for API user role changes
+type UpdateRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// CreateOfferRequest struct for API offer creation by marketers
+type CreateOfferRequest struct {
+	UserID           int    `json:"user_id"`
+	OfferType        string `json:"offer_type"`
+	OfferValue       string `json:"offer_value"`
+	TargetCategoryID int    `json:"target_category_id"`
+	Message          string `json:"message"` // Optional; generated with the LLM when empty
+}
+
+// MFACodeRequest struct for API TOTP confirmation, disabling and recovery code regeneration
+type MFACodeRequest struct {
+	Code string `json:"code"` // TOTP code, or a recovery code where accepted
+}
+
+// MFALoginRequest struct for the second step of a two-step login
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// APIKey represents a row in the api_keys table: a credential for backend-to-backend
+// calls. Only the SHA-256 hash of the key is stored; Prefix identifies it in listings.
+type APIKey struct {
+	KeyID      int        `json:"key_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  int        `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// CreateAPIKeyRequest struct for API key creation
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// ActivityInput is one activity pushed through /api/activities
+type ActivityInput struct {
+	UserID        int     `json:"user_id"`
+	ActivityType  string  `json:"activity_type"`
+	ActivityValue float64 `json:"activity_value"`
+}
+
+// RecordActivitiesRequest struct for API activity ingestion
+type RecordActivitiesRequest struct {
+	Activities []ActivityInput `json:"activities"`
+}
+
+// UserIdentity represents a row in the user_identities table: an external OpenID
+// Connect account (issuer + subject) linked to a local user
+type UserIdentity struct {
+	IdentityID int       `json:"identity_id"`
+	UserID     int       `json:"user_id"`
+	Issuer     string    `json:"issuer"`
+	Subject    string    `json:"subject"`
+	Email      string    `json:"email"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OIDCLoginRequest represents a row in the oidc_login_requests table: the PKCE verifier
+// and nonce of an authorization request, looked up by the hash of its state parameter
+type OIDCLoginRequest struct {
+	StateHash    string
+	CodeVerifier string
+	Nonce        string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// RefreshTokenRequest struct for API token refresh and logout
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse struct for API token refresh
+type TokenResponse struct {
+	Token        string   `json:"token"`
+	TokenType    string   `json:"token_type"`
+	ExpiresIn    int      `json:"expires_in"`
+	RefreshToken string   `json:"refresh_token"`
+	Roles        []string `json:"roles"`
+}
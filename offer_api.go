@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListOffersHandler returns the offers sent to a user (?user_id=)
+func ListOffersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || userID <= 0 {
+		http.Error(w, "user_id query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	offers, err := store.GetSavedOffers(userID)
+	if err != nil {
+		log.Printf("Error fetching saved offers for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if offers == nil {
+		offers = []Offer{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offers)
+}
+
+// CreateOfferHandler sends an offer to a user. Without a message, one is generated
+// with the LLM like the automatic offers in LoginHandler.
+func CreateOfferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateOfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.OfferType = strings.TrimSpace(req.OfferType)
+	req.OfferValue = strings.TrimSpace(req.OfferValue)
+	if req.UserID <= 0 || req.OfferType == "" || req.OfferValue == "" || req.TargetCategoryID <= 0 {
+		http.Error(w, "user_id, offer_type, offer_value and target_category_id are required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := store.GetUserByID(req.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user %d: %v", req.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	category, err := store.GetCategoryByID(req.TargetCategoryID)
+	if err != nil {
+		log.Printf("Error retrieving category %d: %v", req.TargetCategoryID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if category == nil {
+		http.Error(w, "Unknown target_category_id", http.StatusBadRequest)
+		return
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		message, err = GeneratePersonalizedMessageWithLLM(user.Username, req.OfferValue, category.LocalizedName(defaultLocale))
+		if err != nil {
+			log.Printf("Error generating LLM message for user %d: %v", user.UserID, err)
+			message = "Bạn có một ưu đãi đặc biệt đang chờ!"
+		}
+	}
+
+	offer, err := issueOffer(Offer{
+		UserID:           user.UserID,
+		OfferType:        req.OfferType,
+		OfferValue:       req.OfferValue,
+		TargetCategoryID: category.CategoryID,
+		GeneratedMessage: message,
+		SentDate:         time.Now(),
+		IsUsed:           false,
+	})
+	if err != nil {
+		log.Printf("Error saving offer for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authUser, _ := AuthUserFromContext(r.Context())
+	log.Printf("User %d created offer %d for user %d", authUser.UserID, offer.OfferID, user.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(offer)
+}
+
+// RedeemOfferHandler redeems one of the logged-in user's offers against one of their
+// orders (POST /api/offers/{id}/redeem)
+func RedeemOfferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	offerID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || offerID <= 0 {
+		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+		return
+	}
+	var req RedeemOfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	offer, err := store.GetOfferByID(offerID)
+	if err != nil {
+		log.Printf("Error retrieving offer %d: %v", offerID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	redeemOffer(w, r, offer, req.OrderID)
+}
+
+// RedeemCouponHandler redeems an offer by its coupon code (POST /api/offers/redeem), the
+// way a customer types it at checkout
+func RedeemCouponHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RedeemOfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	code := normalizeCouponCode(req.CouponCode)
+	if code == "" {
+		http.Error(w, "Invalid coupon_code", http.StatusBadRequest)
+		return
+	}
+	offer, err := store.GetOfferByCouponCode(code)
+	if err != nil {
+		log.Printf("Error retrieving offer by coupon code: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	redeemOffer(w, r, offer, req.OrderID)
+}
+
+// redeemOffer checks that the offer and the order belong to the caller, that the offer
+// is unused and unexpired and that the order has a product in the offer's category (or
+// a subcategory), then marks the offer used for the order and writes it
+func redeemOffer(w http.ResponseWriter, r *http.Request, offer *Offer, orderID int) {
+	caller, _ := AuthUserFromContext(r.Context())
+	// Someone else's offer is reported as missing, so coupon codes and offer IDs can't be probed
+	if offer == nil || offer.UserID != caller.UserID {
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	if orderID <= 0 {
+		http.Error(w, "order_id is required", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if offer.IsUsed {
+		http.Error(w, "The offer has already been used", http.StatusConflict)
+		return
+	}
+	if !offer.ExpiresAt.After(now) {
+		http.Error(w, "The offer has expired", http.StatusConflict)
+		return
+	}
+
+	order, err := store.GetOrderByID(orderID)
+	if err != nil {
+		log.Printf("Error retrieving order %d: %v", orderID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if order == nil || order.UserID != caller.UserID {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if order.Status != OrderPending && order.Status != OrderPaid {
+		http.Error(w, fmt.Sprintf("An offer can't be applied to an order that is %s", order.Status), http.StatusConflict)
+		return
+	}
+	categories, err := store.GetCategories()
+	if err != nil {
+		log.Printf("Error getting categories: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	matches := false
+	targets := categoryWithDescendants(categories, offer.TargetCategoryID)
+	for _, item := range order.Items {
+		if slices.Contains(targets, item.CategoryID) {
+			matches = true
+			break
+		}
+	}
+	if !matches {
+		http.Error(w, "The order has no product in the offer's category", http.StatusConflict)
+		return
+	}
+
+	redeemed, err := store.RedeemOffer(offer.OfferID, order.OrderID, now)
+	if errors.Is(err, ErrOrderHasOffer) {
+		http.Error(w, "The order already has an offer applied", http.StatusConflict)
+		return
+	} else if errors.Is(err, ErrOrderClosed) { // cancelled or refunded since it was read
+		http.Error(w, "An offer can't be applied to an order that is no longer pending or paid", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error redeeming offer %d: %v", offer.OfferID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !redeemed { // used or expired since it was read
+		http.Error(w, "The offer has already been used or has expired", http.StatusConflict)
+		return
+	}
+	log.Printf("User %d redeemed offer %d on order %d", caller.UserID, offer.OfferID, order.OrderID)
+
+	offer, err = store.GetOfferByID(offer.OfferID)
+	if err != nil || offer == nil {
+		log.Printf("Error retrieving offer after redemption: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
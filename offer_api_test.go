@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// issueTestOffer saves an offer for user on a category, sent at sentDate
+func issueTestOffer(t *testing.T, user *User, categoryID int, sentDate time.Time) *Offer {
+	t.Helper()
+	offer, err := issueOffer(Offer{UserID: user.UserID, OfferType: "Discount", OfferValue: "25% giảm giá",
+		TargetCategoryID: categoryID, GeneratedMessage: "test", SentDate: sentDate})
+	if err != nil {
+		t.Fatalf("issueOffer: %v", err)
+	}
+	return offer
+}
+
+// redeem posts a redemption of offerID for orderID as caller
+func redeem(t *testing.T, offerID, orderID int, caller *AuthUser) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveWithID(t, RedeemOfferHandler, http.MethodPost, offerID, RedeemOfferRequest{OrderID: orderID}, caller)
+}
+
+func TestOrderReversalAndRedeemedOffer(t *testing.T) {
+	memory := useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+	admin := &AuthUser{UserID: 1, Roles: []string{RoleCustomer, RoleAdmin}}
+	cancel := func(orderID int) int {
+		return serveWithID(t, CancelOrderHandler, http.MethodPost, orderID, nil, callerFor(alice)).Code
+	}
+
+	tests := []struct {
+		name     string
+		expired  bool
+		reverse  func(orderID int) int
+		wantUsed bool
+	}{
+		{"cancelled order releases the offer", false, cancel, false},
+		{"cancelled order keeps an expired offer", true, cancel, true},
+		{"refunded order keeps the offer", false, func(orderID int) int {
+			serveWithID(t, UpdateOrderStatusHandler, http.MethodPatch, orderID, OrderStatusRequest{Status: OrderPaid}, admin)
+			return serveWithID(t, RefundOrderHandler, http.MethodPost, orderID, nil, admin).Code
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 1, Quantity: 1})
+			offer := issueTestOffer(t, alice, 2, time.Now())
+			if rec := redeem(t, offer.OfferID, order.OrderID, callerFor(alice)); rec.Code != http.StatusOK {
+				t.Fatalf("redeem: status %d, body %q", rec.Code, rec.Body.String())
+			}
+			if tt.expired {
+				memory.offers[offer.OfferID-1].ExpiresAt = time.Now().Add(-time.Minute)
+			}
+
+			if code := tt.reverse(order.OrderID); code != http.StatusOK {
+				t.Fatalf("reversing the order: status %d", code)
+			}
+			after, _ := store.GetOfferByID(offer.OfferID)
+			if after.IsUsed != tt.wantUsed || (after.OrderID != nil) != tt.wantUsed || (after.UsedAt != nil) != tt.wantUsed {
+				t.Fatalf("offer after the reversal: %+v, want used %t", after, tt.wantUsed)
+			}
+			if tt.wantUsed {
+				return
+			}
+
+			// The released offer can go on the next order
+			next := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 2, Quantity: 1})
+			rec := redeem(t, offer.OfferID, next.OrderID, callerFor(alice))
+			var redeemed Offer
+			json.NewDecoder(rec.Body).Decode(&redeemed)
+			if rec.Code != http.StatusOK || redeemed.OrderID == nil || *redeemed.OrderID != next.OrderID {
+				t.Errorf("redeeming the released offer: status %d, offer %+v", rec.Code, redeemed)
+			}
+		})
+	}
+}
+
+func TestNormalizeCouponCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"TIC-7KQM-3XWA-PL5D-J2RT", "TIC-7KQM-3XWA-PL5D-J2RT"},
+		{"tic7kqm3xwapl5dj2rt", "TIC-7KQM-3XWA-PL5D-J2RT"},
+		{" tic 7kqm-3xwa pl5d-j2rt ", "TIC-7KQM-3XWA-PL5D-J2RT"},
+		{"TIC--7KQM--3XWA--PL5D--J2RT", "TIC-7KQM-3XWA-PL5D-J2RT"},
+		{"", ""},
+		{"TIC-7KQM-3XWA-PL5D", ""},       // too short
+		{"TIC-7KQM-3XWA-PL5D-J2RTX", ""}, // too long
+		{"ABC-7KQM-3XWA-PL5D-J2RT", ""},  // wrong prefix
+	}
+	for _, tt := range tests {
+		if got := normalizeCouponCode(tt.in); got != tt.want {
+			t.Errorf("normalizeCouponCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	code, err := newCouponCode()
+	if err != nil {
+		t.Fatalf("newCouponCode: %v", err)
+	}
+	if normalizeCouponCode(strings.ToLower(strings.ReplaceAll(code, "-", ""))) != code {
+		t.Errorf("new coupon code %q doesn't survive normalizing", code)
+	}
+	if other, _ := newCouponCode(); other == code {
+		t.Error("two coupon codes were the same")
+	}
+}
+
+func TestRedeemOffer(t *testing.T) {
+	memory := useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+	bob := createTestUser(t, "bob", "unused")
+
+	// Product 1 is in "Thời trang nữ" (2), under "Thời trang" (1); product 5 is in "Điện tử" (6)
+	fashionOrder := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 1, Quantity: 1})
+	electronicsOrder := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 5, Quantity: 1})
+	bobsOrder := placeTestOrder(t, bob, PlaceOrderItem{ProductID: 1, Quantity: 1})
+
+	bobsOffer := issueTestOffer(t, bob, 2, time.Now())
+	if rec := redeem(t, bobsOffer.OfferID, fashionOrder.OrderID, callerFor(alice)); rec.Code != http.StatusNotFound {
+		t.Errorf("another user's offer: status %d, want 404", rec.Code)
+	}
+	offer := issueTestOffer(t, alice, 1, time.Now())
+	if rec := redeem(t, offer.OfferID, bobsOrder.OrderID, callerFor(alice)); rec.Code != http.StatusNotFound {
+		t.Errorf("another user's order: status %d, want 404", rec.Code)
+	}
+
+	expired := issueTestOffer(t, alice, 2, time.Now().Add(-offerTTL-time.Minute))
+	if rec := redeem(t, expired.OfferID, fashionOrder.OrderID, callerFor(alice)); rec.Code != http.StatusConflict {
+		t.Errorf("expired offer: status %d, want 409", rec.Code)
+	}
+	if rec := redeem(t, offer.OfferID, electronicsOrder.OrderID, callerFor(alice)); rec.Code != http.StatusConflict {
+		t.Errorf("order outside the offer's category: status %d, want 409", rec.Code)
+	}
+
+	// The offer targets the parent of the ordered product's category; redeem it by code
+	req := newJSONRequest(t, http.MethodPost, "/api/offers/redeem", RedeemOfferRequest{
+		CouponCode: strings.ToLower(strings.ReplaceAll(offer.CouponCode, "-", " ")), OrderID: fashionOrder.OrderID})
+	if rec := serveAs(RedeemCouponHandler, req, callerFor(alice)); rec.Code != http.StatusOK {
+		t.Fatalf("redeeming by code on a subcategory: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if rec := redeem(t, offer.OfferID, fashionOrder.OrderID, callerFor(alice)); rec.Code != http.StatusConflict {
+		t.Errorf("double redemption: status %d, want 409", rec.Code)
+	}
+
+	// An order takes one offer
+	second := issueTestOffer(t, alice, 2, time.Now())
+	if rec := redeem(t, second.OfferID, fashionOrder.OrderID, callerFor(alice)); rec.Code != http.StatusConflict {
+		t.Errorf("second offer on an order: status %d, want 409", rec.Code)
+	}
+	if _, err := memory.RedeemOffer(second.OfferID, fashionOrder.OrderID, time.Now()); !errors.Is(err, ErrOrderHasOffer) {
+		t.Errorf("RedeemOffer of a second offer on an order: %v, want ErrOrderHasOffer", err)
+	}
+	if after, _ := store.GetOfferByID(second.OfferID); after.IsUsed {
+		t.Error("the rejected second offer was marked used")
+	}
+
+	// An order cancelled after the handler read it as pending takes no offer
+	cancelled, err := store.UpdateOrderStatus(OrderEvent{OrderID: electronicsOrder.OrderID, FromStatus: OrderPending,
+		ToStatus: OrderCancelled, Restocked: true, CreatedAt: time.Now()}, alice.UserID)
+	if err != nil || cancelled == nil {
+		t.Fatalf("cancelling order %d: %v", electronicsOrder.OrderID, err)
+	}
+	if _, err := memory.RedeemOffer(second.OfferID, electronicsOrder.OrderID, time.Now()); !errors.Is(err, ErrOrderClosed) {
+		t.Errorf("RedeemOffer on a cancelled order: %v, want ErrOrderClosed", err)
+	}
+	if after, _ := store.GetOfferByID(second.OfferID); after.IsUsed {
+		t.Error("an offer was marked used on a cancelled order")
+	}
+}
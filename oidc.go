@@ -0,0 +1,367 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcLoginTTL is how long a user has to finish logging in at the identity provider
+	oidcLoginTTL = 10 * time.Minute
+	// jwksRefreshInterval limits how often an unknown kid triggers a JWKS download
+	jwksRefreshInterval = time.Minute
+)
+
+// OIDCConfig configures login through an external OpenID Connect identity provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // optional, public clients rely on PKCE alone
+	RedirectURL  string
+	// AllowedDomains restricts which email domains may log in; empty allows all
+	AllowedDomains []string
+}
+
+// OIDCClaims are the ID token claims used to link or provision a local user
+type OIDCClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// oidcDiscovery is the subset of the provider's openid-configuration document we use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCClient runs the authorization code flow with PKCE against one provider. The
+// discovery document and signing keys are fetched on first use and cached.
+type OIDCClient struct {
+	config OIDCConfig
+	http   *resty.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]signingKey
+	keysFetchedAt time.Time
+}
+
+// oidcClient is the OIDCClient configured at startup, nil when OIDC login is disabled
+var oidcClient *OIDCClient
+
+// NewOIDCClientFromEnv configures OIDC login from the environment, returning nil when
+// OIDC_ISSUER is not set:
+//
+//	OIDC_ISSUER           issuer URL; discovery is read from <issuer>/.well-known/openid-configuration
+//	OIDC_CLIENT_ID        client ID registered at the provider
+//	OIDC_CLIENT_SECRET    client secret, if the provider issued one
+//	OIDC_REDIRECT_URL     this server's callback, e.g. https://api.example.com/api/auth/oidc/callback
+//	OIDC_ALLOWED_DOMAINS  email domains allowed to log in, comma-separated (default: any)
+//
+// With OIDC_DEV_IDP=true the issuer, client ID and redirect URL default to the local
+// stand-in provider served under /dev-idp.
+func NewOIDCClientFromEnv() (*OIDCClient, error) {
+	config := OIDCConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}
+	if os.Getenv("OIDC_DEV_IDP") == "true" {
+		if config.Issuer == "" {
+			config.Issuer = devIdPIssuer
+		}
+		if config.ClientID == "" {
+			config.ClientID = devIdPClientID
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = "http://localhost:8080/api/auth/oidc/callback"
+		}
+	}
+	if config.Issuer == "" {
+		return nil, nil
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("OIDC_ISSUER requires OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+	}
+	for _, domain := range strings.Split(os.Getenv("OIDC_ALLOWED_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			config.AllowedDomains = append(config.AllowedDomains, domain)
+		}
+	}
+	return NewOIDCClient(config), nil
+}
+
+// NewOIDCClient creates a client for the provider described by config
+func NewOIDCClient(config OIDCConfig) *OIDCClient {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &OIDCClient{
+		config: config,
+		http:   resty.New().SetTimeout(10 * time.Second),
+		keys:   make(map[string]signingKey),
+	}
+}
+
+// Issuer returns the issuer identities from this provider are linked under
+func (c *OIDCClient) Issuer() string {
+	return c.config.Issuer
+}
+
+// EmailAllowed reports whether the email's domain may log in through the provider
+func (c *OIDCClient) EmailAllowed(email string) bool {
+	if len(c.config.AllowedDomains) == 0 {
+		return true
+	}
+	_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, allowed := range c.config.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// getDiscovery returns the provider metadata, fetching it on first use
+func (c *OIDCClient) getDiscovery() (*oidcDiscovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := c.getJSON(c.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("error fetching OIDC discovery document: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != c.config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery issuer %q does not match %q", discovery.Issuer, c.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+	c.discovery = &discovery
+	return c.discovery, nil
+}
+
+// AuthCodeURL returns the provider URL the user is sent to, carrying the state, the
+// nonce expected in the ID token and the PKCE challenge for codeVerifier
+func (c *OIDCClient) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	discovery, err := c.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.config.ClientID)
+	params.Set("redirect_uri", c.config.RedirectURL)
+	params.Set("scope", "openid email profile")
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", pkceChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (c *OIDCClient) Exchange(code, codeVerifier, nonce string) (*OIDCClaims, error) {
+	discovery, err := c.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	req := c.http.R().SetFormData(map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"redirect_uri":  c.config.RedirectURL,
+		"client_id":     c.config.ClientID,
+		"code_verifier": codeVerifier,
+	})
+	if c.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+	}
+	resp, err := req.Post(discovery.TokenEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error calling OIDC token endpoint: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("OIDC token endpoint returned %d - %s", resp.StatusCode(), resp.String())
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(resp.Body(), &tokens); err != nil || tokens.IDToken == "" {
+		return nil, fmt.Errorf("OIDC token response has no id_token")
+	}
+	return c.verifyIDToken(tokens.IDToken, nonce)
+}
+
+// verifyIDToken checks the ID token's signature, issuer, audience, expiry and nonce
+func (c *OIDCClient) verifyIDToken(rawIDToken, nonce string) (*OIDCClaims, error) {
+	claims := &OIDCClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := c.signingKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	},
+		jwt.WithIssuer(c.config.Issuer),
+		jwt.WithAudience(c.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("invalid ID token: missing sub")
+	}
+	return claims, nil
+}
+
+// signingKey returns the provider key with the given kid, downloading the JWKS again
+// when the kid is unknown (the provider rotated its keys)
+func (c *OIDCClient) signingKey(kid string) (signingKey, error) {
+	discovery, err := c.getDiscovery()
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(c.keysFetchedAt) < jwksRefreshInterval {
+		return signingKey{}, fmt.Errorf("unknown OIDC signing key %q", kid)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return signingKey{}, fmt.Errorf("error fetching OIDC JWKS: %w", err)
+	}
+	keys := make(map[string]signingKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.signingKey()
+		if err != nil {
+			continue // e.g. key types we don't use
+		}
+		keys[jwk.Kid] = key
+	}
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return signingKey{}, fmt.Errorf("unknown OIDC signing key %q", kid)
+	}
+	return key, nil
+}
+
+// getJSON fetches a JSON document from the provider
+func (c *OIDCClient) getJSON(url string, v interface{}) error {
+	resp, err := c.http.R().SetHeader("Accept", "application/json").Get(url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode())
+	}
+	return json.Unmarshal(resp.Body(), v)
+}
+
+// jsonWebKey is one entry of a JWKS document (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// signingKey converts an RSA or P-256 JWK into a verification key
+func (k jsonWebKey) signingKey() (signingKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return signingKey{}, fmt.Errorf("invalid RSA JWK %q", k.Kid)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return signingKey{method: jwt.SigningMethodRS256, verifyKey: pub}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return signingKey{}, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return signingKey{}, fmt.Errorf("invalid EC JWK %q", k.Kid)
+		}
+		// crypto/ecdh rejects points that are not on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return signingKey{}, fmt.Errorf("invalid EC JWK %q: %w", k.Kid, err)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return signingKey{method: jwt.SigningMethodES256, verifyKey: pub}, nil
+	default:
+		return signingKey{}, fmt.Errorf("unsupported JWK type %q", k.Kty)
+	}
+}
+
+// pkceChallenge returns the S256 code challenge for a PKCE code verifier (RFC 7636)
+func pkceChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so an attacker can't
+// log a victim into the attacker's account by sending them a callback link (login CSRF)
+const oidcStateCookie = "oidc_state"
+
+// OIDCLoginHandler starts an OpenID Connect login: it stores the PKCE verifier and nonce
+// under a random state and redirects the browser to the identity provider
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if oidcClient == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, errState := newOpaqueToken()
+	codeVerifier, errVerifier := newOpaqueToken()
+	if errState != nil || errVerifier != nil {
+		log.Printf("Error generating OIDC login request: %v %v", errState, errVerifier)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce := newTokenID()
+
+	authURL, err := oidcClient.AuthCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("Error building OIDC authorization URL: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	err = store.SaveOIDCLoginRequest(OIDCLoginRequest{
+		StateHash:    hashOpaqueToken(state),
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oidcLoginTTL),
+	})
+	if err != nil {
+		log.Printf("Error saving OIDC login request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(oidcClient.config.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes an OpenID Connect login: it redeems the code with the PKCE
+// verifier, verifies the ID token, links or provisions the local user by verified email
+// and responds like LoginHandler (a session, or an MFA challenge)
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if oidcClient == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		log.Printf("OIDC login failed at the identity provider: %s %s", errCode, q.Get("error_description"))
+		http.Error(w, "Login was cancelled or rejected by the identity provider", http.StatusUnauthorized)
+		return
+	}
+	state, code := q.Get("state"), q.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "state and code are required", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, "Login was not started from this browser", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/api/auth/oidc", MaxAge: -1})
+
+	loginReq, err := store.ConsumeOIDCLoginRequest(hashOpaqueToken(state))
+	if err != nil {
+		log.Printf("Error retrieving OIDC login request: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if loginReq == nil || time.Now().After(loginReq.ExpiresAt) {
+		http.Error(w, "Login request is invalid or expired, please start again", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := oidcClient.Exchange(code, loginReq.CodeVerifier, loginReq.Nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		http.Error(w, "Login with the identity provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	// Accounts are matched by email, so only addresses the provider has verified count
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" || !claims.EmailVerified {
+		http.Error(w, "The identity provider did not return a verified email address", http.StatusForbidden)
+		return
+	}
+	if !oidcClient.EmailAllowed(email) {
+		log.Printf("OIDC login rejected for %s: email domain not allowed", email)
+		http.Error(w, "This email domain is not allowed to log in", http.StatusForbidden)
+		return
+	}
+
+	user, err := userForOIDCLogin(oidcClient.Issuer(), claims.Subject, email, claims.PreferredUsername)
+	if err != nil {
+		log.Printf("Error resolving user for OIDC login %s: %v", email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if startMFAChallenge(w, user) {
+		return
+	}
+	completeLogin(w, user)
+}
+
+// userForOIDCLogin returns the user linked to the external identity. An identity seen for
+// the first time is linked to the account with the same email, or to a new customer account.
+func userForOIDCLogin(issuer, subject, email, preferredUsername string) (*User, error) {
+	user, err := store.GetUserByIdentity(issuer, subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	user, err = store.GetUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		user, err = provisionOIDCUser(email, preferredUsername)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = store.LinkUserIdentity(UserIdentity{
+		UserID:    user.UserID,
+		Issuer:    issuer,
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Linked OIDC identity %s of %s to user %d", subject, email, user.UserID)
+	return user, nil
+}
+
+// usernameDisallowedChars matches what usernamePattern doesn't allow
+var usernameDisallowedChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// provisionOIDCUser creates a customer account for an email seen for the first time. The
+// password is random and never shown, so the account can only log in through the provider
+// until the user sets a password with the password reset flow.
+func provisionOIDCUser(email, preferredUsername string) (*User, error) {
+	password, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	base := preferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = usernameDisallowedChars.ReplaceAllString(base, "")
+	if len(base) > 26 {
+		base = base[:26]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	user := User{
+		Email:          email,
+		PasswordHash:   passwordHash,
+		RegisteredDate: time.Now(),
+		Roles:          []string{RoleCustomer},
+	}
+	// Retry with a random suffix when the username is already taken
+	for attempt := 0; attempt < 5; attempt++ {
+		user.Username = base
+		if attempt > 0 {
+			n, err := rand.Int(rand.Reader, big.NewInt(100000))
+			if err != nil {
+				return nil, err
+			}
+			user.Username = fmt.Sprintf("%s-%05d", base, n.Int64())
+		}
+		user.UserID, err = store.CreateUser(user)
+		if errors.Is(err, ErrUsernameTaken) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Provisioned user %s (ID: %d) from OIDC login", user.Username, user.UserID)
+		return &user, nil
+	}
+	return nil, fmt.Errorf("could not find a free username for %s", email)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// oidcTestServer serves the OIDC login handlers and the dev IdP from one test server,
+// as main does with OIDC_DEV_IDP=true, and points oidcClient at it
+type oidcTestServer struct {
+	*httptest.Server
+	client *http.Client
+}
+
+func newOIDCTestServer(t *testing.T) *oidcTestServer {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	idp, err := NewDevIdentityProvider(server.URL + "/dev-idp")
+	if err != nil {
+		t.Fatalf("NewDevIdentityProvider: %v", err)
+	}
+	mux.HandleFunc("/api/auth/oidc/login", OIDCLoginHandler)
+	mux.HandleFunc("/api/auth/oidc/callback", OIDCCallbackHandler)
+	mux.HandleFunc("/dev-idp/.well-known/openid-configuration", idp.DiscoveryHandler)
+	mux.HandleFunc("/dev-idp/authorize", idp.AuthorizeHandler)
+	mux.HandleFunc("/dev-idp/token", idp.TokenHandler)
+	mux.HandleFunc("/dev-idp/jwks", idp.JWKSHandler)
+
+	oldClient := oidcClient
+	t.Cleanup(func() { oidcClient = oldClient })
+	oidcClient = NewOIDCClient(OIDCConfig{
+		Issuer:      server.URL + "/dev-idp",
+		ClientID:    devIdPClientID,
+		RedirectURL: server.URL + "/api/auth/oidc/callback",
+	})
+
+	// Redirects are followed by hand so each leg of the flow can be checked
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	return &oidcTestServer{Server: server, client: client}
+}
+
+// get requests rawURL, sending cookie when it isn't nil
+func (s *oidcTestServer) get(t *testing.T, rawURL string, cookie *http.Cookie) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest(%s): %v", rawURL, err)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", rawURL, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// login starts a login and returns the IdP authorization URL and the state cookie
+func (s *oidcTestServer) login(t *testing.T) (*url.URL, *http.Cookie) {
+	t.Helper()
+	resp := s.get(t, s.URL+"/api/auth/oidc/login", nil)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login: status %d, want 302", resp.StatusCode)
+	}
+	authURL, err := resp.Location()
+	if err != nil {
+		t.Fatalf("login redirect: %v", err)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return authURL, cookie
+		}
+	}
+	t.Fatal("login did not set the state cookie")
+	return nil, nil
+}
+
+// authorize logs in at the dev IdP as email and returns the callback URL it redirects to
+func (s *oidcTestServer) authorize(t *testing.T, authURL *url.URL, email string, emailVerified bool) string {
+	t.Helper()
+	q := authURL.Query()
+	q.Set("login_hint", email)
+	if !emailVerified {
+		q.Set("email_verified", "false")
+	}
+	u := *authURL
+	u.RawQuery = q.Encode()
+
+	resp := s.get(t, u.String(), nil)
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, want 302", resp.StatusCode)
+	}
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize redirect: %v", err)
+	}
+	return callback.String()
+}
+
+// callback finishes the login and decodes the response when it succeeded
+func (s *oidcTestServer) callback(t *testing.T, callbackURL string, cookie *http.Cookie) (int, *LoginResponse) {
+	t.Helper()
+	resp := s.get(t, callbackURL, cookie)
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	var login LoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		t.Fatalf("decoding login response: %v", err)
+	}
+	return resp.StatusCode, &login
+}
+
+func TestOIDCLoginLinksAndProvisionsUsers(t *testing.T) {
+	useMemoryStore(t)
+	server := newOIDCTestServer(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	// The first login with alice's email is linked to the existing account
+	authURL, cookie := server.login(t)
+	status, login := server.callback(t, server.authorize(t, authURL, "Alice@Example.com", true), cookie)
+	if status != http.StatusOK {
+		t.Fatalf("existing email: status %d, want 200", status)
+	}
+	if login.UserID != alice.UserID || login.Token == "" || login.RefreshToken == "" {
+		t.Errorf("existing email: got user %d with token %t, want a session for user %d", login.UserID, login.Token != "", alice.UserID)
+	}
+	linked, err := store.GetUserByIdentity(oidcClient.Issuer(), devSubject("alice@example.com"))
+	if err != nil || linked == nil || linked.UserID != alice.UserID {
+		t.Fatalf("identity linked to %v (%v), want user %d", linked, err, alice.UserID)
+	}
+
+	// Later logins find the account through the linked identity
+	authURL, cookie = server.login(t)
+	if _, login := server.callback(t, server.authorize(t, authURL, "alice@example.com", true), cookie); login == nil || login.UserID != alice.UserID {
+		t.Errorf("second login: got %+v, want user %d", login, alice.UserID)
+	}
+
+	// An unknown email gets a new customer account
+	authURL, cookie = server.login(t)
+	status, login = server.callback(t, server.authorize(t, authURL, "newcomer@example.com", true), cookie)
+	if status != http.StatusOK {
+		t.Fatalf("new email: status %d, want 200", status)
+	}
+	user, err := store.GetUserByEmail("newcomer@example.com")
+	if err != nil || user == nil {
+		t.Fatalf("no user was provisioned: %v", err)
+	}
+	if login.UserID != user.UserID || user.UserID == alice.UserID || user.Username != "newcomer" {
+		t.Errorf("provisioned user %d %q, login for %d; want a new user \"newcomer\"", user.UserID, user.Username, login.UserID)
+	}
+	if len(user.Roles) != 1 || user.Roles[0] != RoleCustomer {
+		t.Errorf("provisioned user roles %v, want [%s]", user.Roles, RoleCustomer)
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	useMemoryStore(t)
+	server := newOIDCTestServer(t)
+	createTestUser(t, "alice", "unused")
+
+	authURL, cookie := server.login(t)
+	status, _ := server.callback(t, server.authorize(t, authURL, "alice@example.com", false), cookie)
+	if status != http.StatusForbidden {
+		t.Errorf("status %d, want 403", status)
+	}
+	if linked, _ := store.GetUserByIdentity(oidcClient.Issuer(), devSubject("alice@example.com")); linked != nil {
+		t.Errorf("an unverified email was linked to user %d", linked.UserID)
+	}
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	useMemoryStore(t)
+	server := newOIDCTestServer(t)
+
+	authURL, cookie := server.login(t)
+	callbackURL := server.authorize(t, authURL, "alice@example.com", true)
+	_, otherCookie := server.login(t)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"no state cookie", nil},
+		{"another login's state cookie", otherCookie},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := server.callback(t, callbackURL, tt.cookie); status != http.StatusBadRequest {
+				t.Errorf("status %d, want 400", status)
+			}
+		})
+	}
+
+	// Neither attempt used up the login, but finishing it does
+	if status, _ := server.callback(t, callbackURL, cookie); status != http.StatusOK {
+		t.Fatalf("status %d, want 200", status)
+	}
+	if status, _ := server.callback(t, callbackURL, cookie); status != http.StatusBadRequest {
+		t.Errorf("replayed callback: status %d, want 400", status)
+	}
+}
+
+func TestOIDCCallbackChecksPKCEAndNonce(t *testing.T) {
+	useMemoryStore(t)
+	server := newOIDCTestServer(t)
+
+	// A code issued for a different challenge or nonce than the login stored, as when
+	// an attacker injects a code from their own authorization request
+	for _, param := range []string{"code_challenge", "nonce"} {
+		t.Run(param, func(t *testing.T) {
+			authURL, cookie := server.login(t)
+			q := authURL.Query()
+			q.Set(param, pkceChallenge("attacker"))
+			authURL.RawQuery = q.Encode()
+
+			status, _ := server.callback(t, server.authorize(t, authURL, "alice@example.com", true), cookie)
+			if status != http.StatusUnauthorized {
+				t.Errorf("status %d, want 401", status)
+			}
+		})
+	}
+	if user, _ := store.GetUserByEmail("alice@example.com"); user != nil {
+		t.Errorf("user %d was provisioned by a rejected login", user.UserID)
+	}
+}
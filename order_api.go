@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxOrderItems caps the products of one order, maxOrderQuantity the units of one item
+	maxOrderItems    = 50
+	maxOrderQuantity = 100
+	// maxOrderTotal is the largest value orders.total_price (DECIMAL(10,2)) can hold
+	maxOrderTotal = 99999999.99
+
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+// orderTotal prices quantity units, rounded to the cent like orders.total_price
+func orderTotal(price float64, quantity int) float64 {
+	return math.Round(price*float64(quantity)*100) / 100
+}
+
+// orderStatusTransitions lists the statuses each status can move to. PATCH
+// /api/orders/{id}/status only moves orders forward through orderFulfilmentStatuses;
+// cancelling and refunding have their own endpoints because they reverse the order.
+var orderStatusTransitions = map[string][]string{
+	OrderPending: {OrderPaid, OrderCancelled},
+	OrderPaid:    {OrderShipped, OrderCancelled, OrderRefunded},
+	OrderShipped: {OrderRefunded},
+}
+
+// orderFulfilmentStatuses are the statuses PATCH /api/orders/{id}/status can set
+var orderFulfilmentStatuses = []string{OrderPaid, OrderShipped}
+
+// nextStreak returns the streak after activity at now: activity on the same day keeps
+// it, activity on the following day extends it and a longer gap starts a new one
+func nextStreak(streak *UserStreak, now time.Time) int {
+	if streak == nil || streak.LastActivityDate.IsZero() || streak.CurrentStreak <= 0 {
+		return 1
+	}
+	last := streak.LastActivityDate.In(now.Location())
+	sameDay := func(a, b time.Time) bool {
+		ay, am, ad := a.Date()
+		by, bm, bd := b.Date()
+		return ay == by && am == bm && ad == bd
+	}
+	switch {
+	case sameDay(last, now) || last.After(now):
+		return streak.CurrentStreak
+	case sameDay(last, now.AddDate(0, 0, -1)):
+		return streak.CurrentStreak + 1
+	default:
+		return 1
+	}
+}
+
+// PlaceOrderHandler places an order for the logged-in user (POST /api/orders). Prices
+// come from the catalogue, and the stock of every item is taken out in the same
+// transaction. The purchase is then recorded as a "purchase" activity worth the basket
+// total and extends the user's streak, so the streak model sees it straight away.
+func PlaceOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PlaceOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	items := req.Items
+	if len(items) == 0 && req.ProductID != 0 {
+		items = []PlaceOrderItem{{ProductID: req.ProductID, Quantity: req.Quantity, ReservationID: req.ReservationID}}
+	}
+	if len(items) == 0 || len(items) > maxOrderItems {
+		http.Error(w, fmt.Sprintf("items must list between 1 and %d products", maxOrderItems), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := AuthUserFromContext(r.Context())
+	now := time.Now()
+	order := Order{UserID: user.UserID, OrderDate: now}
+	products := make(map[int]bool)
+	reservations := make(map[int]bool)
+	total := 0.0
+	for _, item := range items {
+		if item.ProductID <= 0 {
+			http.Error(w, "product_id is required", http.StatusBadRequest)
+			return
+		}
+		if item.Quantity < 1 || item.Quantity > maxOrderQuantity {
+			http.Error(w, fmt.Sprintf("quantity must be between 1 and %d", maxOrderQuantity), http.StatusBadRequest)
+			return
+		}
+		if item.ReservationID < 0 {
+			http.Error(w, "Invalid reservation_id", http.StatusBadRequest)
+			return
+		}
+		if products[item.ProductID] {
+			http.Error(w, fmt.Sprintf("product_id %d is listed more than once", item.ProductID), http.StatusBadRequest)
+			return
+		}
+		if item.ReservationID > 0 && reservations[item.ReservationID] {
+			http.Error(w, fmt.Sprintf("reservation_id %d is used more than once", item.ReservationID), http.StatusBadRequest)
+			return
+		}
+		products[item.ProductID], reservations[item.ReservationID] = true, true
+
+		product, err := store.GetProductByID(item.ProductID)
+		if err != nil {
+			log.Printf("Error retrieving product %d: %v", item.ProductID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if product == nil || product.DeletedAt != nil {
+			http.Error(w, fmt.Sprintf("unknown product_id %d", item.ProductID), http.StatusBadRequest)
+			return
+		}
+		total += orderTotal(product.Price, item.Quantity)
+		order.Items = append(order.Items, OrderItem{ProductID: item.ProductID, Quantity: item.Quantity, ReservationID: item.ReservationID})
+	}
+	if total > maxOrderTotal {
+		http.Error(w, "The order total is too large; split it into several orders", http.StatusBadRequest)
+		return
+	}
+
+	placed, err := store.PlaceOrder(order)
+	var itemErr *OrderItemError
+	if errors.As(err, &itemErr) {
+		message := fmt.Sprintf("Not enough stock available of product %d", itemErr.ProductID)
+		if errors.Is(itemErr.Err, ErrReservationNotActive) {
+			message = fmt.Sprintf("The reservation for product %d is expired, already used, or doesn't cover this quantity", itemErr.ProductID)
+		}
+		http.Error(w, message, http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error placing order for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d placed order %d: %d items, total %.2f", user.UserID, placed.OrderID, len(placed.Items), placed.TotalPrice)
+	for _, item := range placed.Items {
+		if updated, err := store.GetProductByID(item.ProductID); err == nil {
+			logLowStock(updated)
+		}
+	}
+
+	// The order is placed; failing to record the activity or streak must not fail the request
+	response := PlaceOrderResponse{Order: *placed}
+	if err := store.RecordPurchaseActivity(user.UserID, placed.OrderID, placed.TotalPrice); err != nil {
+		log.Printf("Error recording purchase activity for user %d: %v", user.UserID, err)
+	}
+	streak, err := store.GetUserStreak(user.UserID)
+	if err != nil {
+		log.Printf("Error getting streak for user %d: %v", user.UserID, err)
+	} else {
+		response.CurrentStreak = nextStreak(streak, now)
+		if err := store.UpdateUserStreak(user.UserID, response.CurrentStreak, now); err != nil {
+			log.Printf("Error updating streak for user %d: %v", user.UserID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// MyOrdersHandler lists the logged-in user's orders, newest first (GET /api/me/orders).
+// Query parameters:
+//
+//	from, to       date range, as 2006-01-02 (whole days, inclusive) or RFC 3339 timestamps (to is exclusive)
+//	limit, cursor  page size (default 20, max 100) and the next_cursor of the previous page
+func MyOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := AuthUserFromContext(r.Context())
+	writeOrderList(w, r, user.UserID)
+}
+
+// UserOrdersHandler lists any user's orders for support staff (GET /api/users/{id}/orders),
+// with the same parameters as /api/me/orders
+func UserOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := userFromPath(w, r)
+	if !ok {
+		return
+	}
+	writeOrderList(w, r, user.UserID)
+}
+
+// writeOrderList writes one page of a user's order history
+func writeOrderList(w http.ResponseWriter, r *http.Request, userID int) {
+	query, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.UserID = userID
+	limit := query.Limit
+	query.Limit++ // one extra row tells us whether there is a next page
+
+	orders, total, err := store.ListOrders(query)
+	if err != nil {
+		log.Printf("Error getting orders of user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := OrderListResponse{Orders: orders, Total: total}
+	if len(orders) > limit {
+		response.Orders = orders[:limit]
+		last := response.Orders[limit-1]
+		cursor := encodeOrderCursor(OrderCursor{OrderDate: last.OrderDate, OrderID: last.OrderID})
+		response.NextCursor = &cursor
+	}
+	if response.Orders == nil {
+		response.Orders = []Order{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetOrderHandler returns one order with its items (GET /api/orders/{id}). Customers
+// see their own orders; orders:read (support staff) sees everyone's.
+func GetOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	caller, _ := AuthUserFromContext(r.Context())
+	// Someone else's order is reported as missing rather than forbidden, so order IDs can't be probed
+	if order.UserID != caller.UserID && !caller.HasPermission(PermOrdersRead) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// UpdateOrderStatusHandler moves an order forward to paid or shipped
+// (PATCH /api/orders/{id}/status), for the payment and fulfilment side
+func UpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(orderFulfilmentStatuses, req.Status) {
+		http.Error(w, fmt.Sprintf("status must be one of: %s", strings.Join(orderFulfilmentStatuses, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	applyOrderEvent(w, r, order, OrderEvent{
+		OrderID:    order.OrderID,
+		FromStatus: order.Status,
+		ToStatus:   req.Status,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// applyOrderEvent moves an order to event.ToStatus if orderStatusTransitions allows it,
+// records the event and writes the updated order
+func applyOrderEvent(w http.ResponseWriter, r *http.Request, order *Order, event OrderEvent) {
+	if !slices.Contains(orderStatusTransitions[order.Status], event.ToStatus) {
+		http.Error(w, fmt.Sprintf("An order that is %s can't become %s", order.Status, event.ToStatus), http.StatusConflict)
+		return
+	}
+
+	caller, _ := AuthUserFromContext(r.Context())
+	applied, err := store.UpdateOrderStatus(event, caller.UserID)
+	if err != nil {
+		log.Printf("Error updating status of order %d: %v", order.OrderID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if applied == nil {
+		http.Error(w, "The order was changed at the same time; reload it and try again", http.StatusConflict)
+		return
+	}
+	log.Printf("Order %d moved from %s to %s (user %d, API key %d, amount %.2f, restocked %t)",
+		order.OrderID, event.FromStatus, event.ToStatus, caller.UserID, caller.APIKeyID, event.Amount, event.Restocked)
+	// The order's purchase activity drops out of GetUserActivities by itself; the streak
+	// it extended is rebuilt. Failing that must not fail the request, like placing it.
+	if event.ToStatus == OrderCancelled || event.ToStatus == OrderRefunded {
+		if err := reverseOrderStreak(order); err != nil {
+			log.Printf("Error reversing the streak of order %d: %v", order.OrderID, err)
+		}
+	}
+
+	updated, err := store.GetOrderByID(order.OrderID)
+	if err != nil || updated == nil {
+		log.Printf("Error retrieving order after status update: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// orderFromPath loads the order for the {id} path value, writing 400/404 on failure
+func orderFromPath(w http.ResponseWriter, r *http.Request) (*Order, bool) {
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || orderID <= 0 {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return nil, false
+	}
+	order, err := store.GetOrderByID(orderID)
+	if err != nil {
+		log.Printf("Error retrieving order %d: %v", orderID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if order == nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return nil, false
+	}
+	return order, true
+}
+
+// parseOrderQuery validates the order history query parameters
+func parseOrderQuery(params url.Values) (OrderQuery, error) {
+	query := OrderQuery{Limit: defaultOrderPageSize}
+
+	if v := params.Get("from"); v != "" {
+		from, _, err := parseOrderDate(v)
+		if err != nil {
+			return query, fmt.Errorf("from must be a date (2006-01-02) or an RFC 3339 timestamp")
+		}
+		query.From = &from
+	}
+	if v := params.Get("to"); v != "" {
+		to, dateOnly, err := parseOrderDate(v)
+		if err != nil {
+			return query, fmt.Errorf("to must be a date (2006-01-02) or an RFC 3339 timestamp")
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1) // the whole day is included
+		}
+		query.Before = &to
+	}
+	if query.From != nil && query.Before != nil && !query.From.Before(*query.Before) {
+		return query, fmt.Errorf("from must be before to")
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxOrderPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxOrderPageSize)
+		}
+		query.Limit = n
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		cursor, err := decodeOrderCursor(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid cursor")
+		}
+		query.After = cursor
+	}
+	return query, nil
+}
+
+// parseOrderDate parses a 2006-01-02 date (midnight, server time) or an RFC 3339
+// timestamp, reporting which one it was
+func parseOrderDate(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// encodeOrderCursor turns a cursor into the opaque next_cursor string
+func encodeOrderCursor(cursor OrderCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeOrderCursor parses a next_cursor string
+func decodeOrderCursor(value string) (*OrderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor OrderCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
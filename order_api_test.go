@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// postOrder sends items to PlaceOrderHandler as user
+func postOrder(t *testing.T, user *User, items ...PlaceOrderItem) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveAs(PlaceOrderHandler, newJSONRequest(t, http.MethodPost, "/api/orders", PlaceOrderRequest{Items: items}), callerFor(user))
+}
+
+// stockOf returns a product's stock on hand
+func stockOf(t *testing.T, productID int) int {
+	t.Helper()
+	p, err := store.GetProductByID(productID)
+	if err != nil || p == nil {
+		t.Fatalf("GetProductByID(%d): %v", productID, err)
+	}
+	return p.StockQuantity
+}
+
+// reserve holds quantity units of a product for user
+func reserve(t *testing.T, user *User, productID, quantity int) int {
+	t.Helper()
+	now := time.Now()
+	id, err := store.ReserveStock(StockReservation{ProductID: productID, UserID: user.UserID, Quantity: quantity,
+		Status: ReservationActive, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("ReserveStock: %v", err)
+	}
+	return id
+}
+
+func TestPlaceOrderHandlerTakesStock(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	// Product 7 has 4 units
+	if rec := postOrder(t, alice, PlaceOrderItem{ProductID: 7, Quantity: 5}); rec.Code != http.StatusConflict {
+		t.Errorf("over-quantity order: status %d, want 409", rec.Code)
+	}
+	if stock := stockOf(t, 7); stock != 4 {
+		t.Errorf("stock after a rejected order is %d, want 4", stock)
+	}
+
+	placeTestOrder(t, alice, PlaceOrderItem{ProductID: 7, Quantity: 3})
+	if stock := stockOf(t, 7); stock != 1 {
+		t.Errorf("stock after ordering 3 of 4 is %d, want 1", stock)
+	}
+}
+
+func TestPlaceOrderHandlerReservations(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+	bob := createTestUser(t, "bob", "unused")
+
+	// Product 3 has 12 units; bob holds 10 of them
+	bobs := reserve(t, bob, 3, 10)
+	if rec := postOrder(t, alice, PlaceOrderItem{ProductID: 3, Quantity: 3}); rec.Code != http.StatusConflict {
+		t.Errorf("ordering reserved units: status %d, want 409", rec.Code)
+	}
+	if rec := postOrder(t, alice, PlaceOrderItem{ProductID: 3, Quantity: 2, ReservationID: bobs}); rec.Code != http.StatusConflict {
+		t.Errorf("ordering from another user's reservation: status %d, want 409", rec.Code)
+	}
+
+	placeTestOrder(t, bob, PlaceOrderItem{ProductID: 3, Quantity: 10, ReservationID: bobs})
+	reservation, _ := store.GetStockReservation(bobs)
+	if reservation.Status != ReservationOrdered {
+		t.Errorf("reservation is %s after its order, want %s", reservation.Status, ReservationOrdered)
+	}
+	if p, _ := store.GetProductByID(3); p.StockQuantity != 2 || p.ReservedQuantity != 0 {
+		t.Errorf("product after the reserved order: stock %d, reserved %d; want 2, 0", p.StockQuantity, p.ReservedQuantity)
+	}
+	if rec := postOrder(t, bob, PlaceOrderItem{ProductID: 3, Quantity: 1, ReservationID: bobs}); rec.Code != http.StatusConflict {
+		t.Errorf("reusing an ordered reservation: status %d, want 409", rec.Code)
+	}
+}
+
+func TestPlaceOrderHandlerRecordsActivityAndStreak(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if err := store.UpdateUserStreak(alice.UserID, 4, yesterday); err != nil {
+		t.Fatalf("UpdateUserStreak: %v", err)
+	}
+
+	order := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 5, Quantity: 2})
+	if order.CurrentStreak != 5 {
+		t.Errorf("order response streak %d, want 5", order.CurrentStreak)
+	}
+	streak, _ := store.GetUserStreak(alice.UserID)
+	if streak.CurrentStreak != 5 || time.Since(streak.LastActivityDate) > time.Minute {
+		t.Errorf("streak after ordering %+v, want 5 ending now", streak)
+	}
+
+	activities, err := store.GetUserActivities(alice.UserID, 10)
+	if err != nil {
+		t.Fatalf("GetUserActivities: %v", err)
+	}
+	if len(activities) != 1 || activities[0].ActivityType != "purchase" || activities[0].ActivityValue != order.TotalPrice ||
+		activities[0].OrderID == nil || *activities[0].OrderID != order.OrderID {
+		t.Errorf("activities %+v, want one purchase of order %d worth %.2f", activities, order.OrderID, order.TotalPrice)
+	}
+
+	// A second order the same day keeps the streak
+	if again := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 6, Quantity: 1}); again.CurrentStreak != 5 {
+		t.Errorf("streak after a second order the same day is %d, want 5", again.CurrentStreak)
+	}
+}
+
+func TestPlaceOrderHandlerMultiLineBasket(t *testing.T) {
+	useMemoryStore(t)
+	products := createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	rec := postOrder(t, alice, PlaceOrderItem{ProductID: 1, Quantity: 1}, PlaceOrderItem{ProductID: 1, Quantity: 2})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("duplicate product_id: status %d, want 400", rec.Code)
+	}
+	// One line without stock fails the whole basket
+	rec = postOrder(t, alice, PlaceOrderItem{ProductID: 1, Quantity: 2}, PlaceOrderItem{ProductID: 8, Quantity: 1})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("basket with an out-of-stock line: status %d, want 409", rec.Code)
+	}
+	if stock := stockOf(t, 1); stock != products[0].StockQuantity {
+		t.Errorf("stock of the in-stock line is %d after the rejected basket, want %d", stock, products[0].StockQuantity)
+	}
+
+	order := placeTestOrder(t, alice,
+		PlaceOrderItem{ProductID: 1, Quantity: 2},
+		PlaceOrderItem{ProductID: 5, Quantity: 1},
+		PlaceOrderItem{ProductID: 6, Quantity: 3},
+	)
+	if len(order.Items) != 3 || order.Status != OrderPending {
+		t.Fatalf("order %+v, want 3 pending lines", order.Order)
+	}
+	sum := 0.0
+	for _, item := range order.Items {
+		p := products[item.ProductID-1]
+		if item.UnitPrice != p.Price || item.LineTotal != orderTotal(p.Price, item.Quantity) || item.ProductName != p.ProductName || item.CategoryID != p.CategoryID {
+			t.Errorf("line %+v doesn't match product %+v", item, p)
+		}
+		sum += item.LineTotal
+	}
+	if order.TotalPrice != sum || sum != 2*450000+1200000+3*350000 {
+		t.Errorf("total_price %.2f, want the sum of the line totals %.2f", order.TotalPrice, sum)
+	}
+
+	stored, _ := store.GetOrderByID(order.OrderID)
+	if stored == nil || stored.TotalPrice != sum || len(stored.Items) != 3 {
+		t.Errorf("stored order %+v, want 3 lines totalling %.2f", stored, sum)
+	}
+}
+
+// storeTestOrder stores a one-item order for user placed at orderDate
+func storeTestOrder(t *testing.T, user *User, orderDate time.Time) *Order {
+	t.Helper()
+	order, err := store.PlaceOrder(Order{UserID: user.UserID, OrderDate: orderDate,
+		Items: []OrderItem{{ProductID: 6, Quantity: 1}}})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	return order
+}
+
+// listOrders runs handler for GET path as caller and decodes the page; userID, when
+// positive, is the {id} path value
+func listOrders(t *testing.T, handler http.HandlerFunc, path string, userID int, caller *AuthUser) (int, OrderListResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if userID > 0 {
+		req.SetPathValue("id", strconv.Itoa(userID))
+	}
+	rec := serveAs(handler, req, caller)
+	var page OrderListResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("decoding orders: %v", err)
+		}
+	}
+	return rec.Code, page
+}
+
+func TestMyOrdersHandlerPagesThroughEqualDates(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	// Three orders share a timestamp, so only the order ID keeps them apart
+	same := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+	dates := []time.Time{same.Add(-time.Hour), same, same, same, same.Add(time.Hour)}
+	var want []int
+	for _, date := range dates {
+		want = append([]int{storeTestOrder(t, alice, date).OrderID}, want...) // newest first
+	}
+
+	var got []int
+	path := "/api/me/orders?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > len(dates) {
+			t.Fatalf("paging did not end; got %v", got)
+		}
+		code, page := listOrders(t, MyOrdersHandler, path, 0, callerFor(alice))
+		if code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, code)
+		}
+		if page.Total != len(dates) {
+			t.Errorf("total %d, want %d", page.Total, len(dates))
+		}
+		for _, order := range page.Orders {
+			got = append(got, order.OrderID)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		path = "/api/me/orders?limit=2&cursor=" + url.QueryEscape(*page.NextCursor)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("orders %v, want %v", got, want)
+	}
+}
+
+func TestMyOrdersHandlerDateRange(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local)
+	storeTestOrder(t, alice, day.Add(-time.Minute))
+	first := storeTestOrder(t, alice, day)
+	last := storeTestOrder(t, alice, day.Add(23*time.Hour+59*time.Minute))
+	storeTestOrder(t, alice, day.AddDate(0, 0, 1))
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"a date-only to includes the whole day", "from=2025-03-10&to=2025-03-10", []int{last.OrderID, first.OrderID}},
+		{"a timestamp to is exclusive", "from=2025-03-10&to=" + url.QueryEscape(last.OrderDate.Format(time.RFC3339)), []int{first.OrderID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, page := listOrders(t, MyOrdersHandler, "/api/me/orders?"+tt.query, 0, callerFor(alice))
+			if code != http.StatusOK {
+				t.Fatalf("status %d, want 200", code)
+			}
+			var got []int
+			for _, order := range page.Orders {
+				got = append(got, order.OrderID)
+			}
+			if !slices.Equal(got, tt.want) || page.Total != len(tt.want) {
+				t.Errorf("orders %v (total %d), want %v", got, page.Total, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"from=2025-03-11&to=2025-03-10",
+		"from=2025-03-10T00:00:00Z&to=2025-03-10T00:00:00Z",
+		"from=10/03/2025",
+		"limit=0",
+		"cursor=not-a-cursor!",
+	} {
+		if code, _ := listOrders(t, MyOrdersHandler, "/api/me/orders?"+query, 0, callerFor(alice)); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, code)
+		}
+	}
+}
+
+func TestOrderAccess(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+	bob := createTestUser(t, "bob", "unused")
+	support := &AuthUser{UserID: 99, Roles: []string{RoleCustomer, RoleSupport}}
+	order := storeTestOrder(t, alice, time.Now())
+
+	tests := []struct {
+		name   string
+		caller *AuthUser
+		want   int
+	}{
+		{"owner", callerFor(alice), http.StatusOK},
+		{"another customer", callerFor(bob), http.StatusNotFound},
+		{"orders:read", support, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveWithID(t, GetOrderHandler, http.MethodGet, order.OrderID, nil, tt.caller); rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	// Support staff list a customer's history; a customer's own list never shows others' orders
+	code, page := listOrders(t, UserOrdersHandler, "/api/users/"+strconv.Itoa(alice.UserID)+"/orders", alice.UserID, support)
+	if code != http.StatusOK || len(page.Orders) != 1 || page.Orders[0].OrderID != order.OrderID {
+		t.Errorf("support listing: status %d, orders %+v; want alice's order", code, page.Orders)
+	}
+	if code, page := listOrders(t, MyOrdersHandler, "/api/me/orders", 0, callerFor(bob)); code != http.StatusOK || len(page.Orders) != 0 {
+		t.Errorf("bob's orders: status %d, %d orders; want none", code, len(page.Orders))
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxReversalReasonLength matches order_events.reason
+	maxReversalReasonLength = 500
+	// minOrdersForRefundRate is how many orders a user needs before their refund rate counts
+	minOrdersForRefundRate = 3
+	// maxNormalRefundRate is the share of refunded orders above which a user is a serial returner
+	maxNormalRefundRate = 0.3
+)
+
+// CancelOrderHandler cancels an order that hasn't shipped (POST /api/orders/{id}/cancel)
+// and puts its items back into stock. Customers cancel their own pending orders;
+// orders:write can cancel anyone's, paid ones included. Cancelling a paid order returns
+// the money, so customers have to ask for a refund instead, which counts towards their
+// refund rate.
+func CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	caller, _ := AuthUserFromContext(r.Context())
+	// Someone else's order is reported as missing, like in GetOrderHandler
+	if order.UserID != caller.UserID && !caller.HasPermission(PermOrdersWrite) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if order.Status == OrderPaid && !caller.HasPermission(PermOrdersWrite) {
+		http.Error(w, "A paid order can't be cancelled; ask for a refund instead", http.StatusConflict)
+		return
+	}
+	reason, ok := reversalReason(w, r)
+	if !ok {
+		return
+	}
+
+	// Only a paid order has money to return
+	amount := 0.0
+	if order.Status == OrderPaid {
+		amount = -order.TotalPrice
+	}
+	applyOrderEvent(w, r, order, OrderEvent{
+		OrderID:    order.OrderID,
+		FromStatus: order.Status,
+		ToStatus:   OrderCancelled,
+		Amount:     amount,
+		Restocked:  true,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// RefundOrderHandler refunds a paid or shipped order (POST /api/orders/{id}/refund). The
+// items of an order that hasn't shipped go back into stock; returned goods are counted
+// back in with PATCH /api/products/{id}/stock once they have been inspected.
+func RefundOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	reason, ok := reversalReason(w, r)
+	if !ok {
+		return
+	}
+
+	applyOrderEvent(w, r, order, OrderEvent{
+		OrderID:    order.OrderID,
+		FromStatus: order.Status,
+		ToStatus:   OrderRefunded,
+		Amount:     -order.TotalPrice,
+		Restocked:  order.Status == OrderPaid,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// OrderEventsHandler lists an order's status changes, oldest first
+// (GET /api/orders/{id}/events), with the same access rules as GET /api/orders/{id}
+func OrderEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	caller, _ := AuthUserFromContext(r.Context())
+	if order.UserID != caller.UserID && !caller.HasPermission(PermOrdersRead) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	events, err := store.ListOrderEvents(order.OrderID)
+	if err != nil {
+		log.Printf("Error getting events of order %d: %v", order.OrderID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []OrderEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+		"total":  len(events),
+	})
+}
+
+// reversalReason reads the optional OrderReversalRequest body, writing 400 on failure
+func reversalReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req OrderReversalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+	if len(req.Reason) > maxReversalReasonLength {
+		http.Error(w, fmt.Sprintf("reason must be at most %d characters", maxReversalReasonLength), http.StatusBadRequest)
+		return "", false
+	}
+	return req.Reason, true
+}
+
+// reverseOrderStreak takes a cancelled or refunded order out of its user's streak. Only
+// orders extend streaks, so when the order fell within the current streak, the streak
+// is rebuilt from the days in it that still have a live order.
+func reverseOrderStreak(order *Order) error {
+	streak, err := store.GetUserStreak(order.UserID)
+	if err != nil || streak == nil || streak.CurrentStreak <= 0 {
+		return err
+	}
+	lastDay := startOfDay(streak.LastActivityDate)
+	firstDay := lastDay.AddDate(0, 0, -(streak.CurrentStreak - 1))
+	if orderDay := startOfDay(order.OrderDate); orderDay.Before(firstDay) || orderDay.After(lastDay) {
+		return nil
+	}
+
+	// The days of the streak with a live order, newest first
+	var days []time.Time
+	var lastActivity time.Time
+	end := lastDay.AddDate(0, 0, 1)
+	query := OrderQuery{UserID: order.UserID, From: &firstDay, Before: &end, Limit: maxOrderPageSize}
+	for {
+		orders, _, err := store.ListOrders(query)
+		if err != nil {
+			return err
+		}
+		for _, o := range orders {
+			if o.Status == OrderCancelled || o.Status == OrderRefunded {
+				continue
+			}
+			if lastActivity.IsZero() {
+				lastActivity = o.OrderDate
+			}
+			if day := startOfDay(o.OrderDate); len(days) == 0 || !days[len(days)-1].Equal(day) {
+				days = append(days, day)
+			}
+		}
+		if len(orders) < query.Limit {
+			break
+		}
+		last := orders[len(orders)-1]
+		query.After = &OrderCursor{OrderDate: last.OrderDate, OrderID: last.OrderID}
+	}
+
+	current := 0
+	for i, day := range days {
+		if i > 0 && !day.Equal(days[i-1].AddDate(0, 0, -1)) {
+			break
+		}
+		current++
+	}
+	if current == 0 {
+		// Nothing is left of the streak; the last activity is the latest live order, if any
+		now := time.Now()
+		stats, err := store.GetOrderStats(order.UserID, now, now)
+		if err != nil {
+			return err
+		}
+		lastActivity = streak.LastActivityDate
+		if stats.LastOrderDate != nil {
+			lastActivity = *stats.LastOrderDate
+		}
+	}
+	if current != streak.CurrentStreak {
+		log.Printf("Streak of user %d went from %d to %d after order %d was reversed", order.UserID, streak.CurrentStreak, current, order.OrderID)
+	}
+	return store.UpdateUserStreak(order.UserID, current, lastActivity)
+}
+
+// startOfDay returns midnight of t's day in local time, the days nextStreak counts in
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// refundRate returns the share of a user's orders (cancelled ones aside) that were refunded
+func refundRate(stats *OrderStats) float64 {
+	orders := stats.TotalOrders + stats.RefundedOrders
+	if orders == 0 {
+		return 0
+	}
+	return float64(stats.RefundedOrders) / float64(orders)
+}
+
+// serialReturner reports whether a user refunds an abnormal share of their orders: more
+// than maxNormalRefundRate of at least minOrdersForRefundRate orders
+func serialReturner(userID int) (bool, error) {
+	now := time.Now()
+	stats, err := store.GetOrderStats(userID, now, now) // the trend windows aren't needed
+	if err != nil {
+		return false, err
+	}
+	if stats.TotalOrders+stats.RefundedOrders < minOrdersForRefundRate || refundRate(stats) <= maxNormalRefundRate {
+		return false, nil
+	}
+	log.Printf("User %d refunded %d of %d orders", userID, stats.RefundedOrders, stats.TotalOrders+stats.RefundedOrders)
+	return true, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// testAdmin is a caller with orders:write
+var testAdmin = &AuthUser{UserID: 1, Roles: []string{RoleCustomer, RoleAdmin}}
+
+// setOrderStatus moves an order forward through UpdateOrderStatusHandler as testAdmin
+func setOrderStatus(t *testing.T, orderID int, status string) {
+	t.Helper()
+	rec := serveWithID(t, UpdateOrderStatusHandler, http.MethodPatch, orderID, OrderStatusRequest{Status: status}, testAdmin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("moving order %d to %s: status %d, body %q", orderID, status, rec.Code, rec.Body.String())
+	}
+}
+
+// placeOrderAt stores a one-item order placed at orderDate, bypassing the handler
+func placeOrderAt(t *testing.T, user *User, orderDate time.Time) *Order {
+	t.Helper()
+	order, err := store.PlaceOrder(Order{UserID: user.UserID, OrderDate: orderDate, Items: []OrderItem{{ProductID: 6, Quantity: 1}}})
+	if err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	return order
+}
+
+func TestCancelOrderHandler(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	pending := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 1, Quantity: 3})
+	if stock := stockOf(t, 1); stock != 37 {
+		t.Fatalf("stock after ordering is %d, want 37", stock)
+	}
+	if rec := serveWithID(t, CancelOrderHandler, http.MethodPost, pending.OrderID, OrderReversalRequest{Reason: "changed my mind"}, callerFor(alice)); rec.Code != http.StatusOK {
+		t.Fatalf("cancelling a pending order: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if stock := stockOf(t, 1); stock != 40 {
+		t.Errorf("stock after cancelling is %d, want 40", stock)
+	}
+	events, _ := store.ListOrderEvents(pending.OrderID)
+	if len(events) != 1 || events[0].ToStatus != OrderCancelled || !events[0].Restocked || events[0].Amount != 0 {
+		t.Errorf("events %+v, want one restocking cancellation of amount 0", events)
+	}
+
+	paid := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 1, Quantity: 1})
+	setOrderStatus(t, paid.OrderID, OrderPaid)
+	if rec := serveWithID(t, CancelOrderHandler, http.MethodPost, paid.OrderID, nil, callerFor(alice)); rec.Code != http.StatusConflict {
+		t.Errorf("customer cancelling a paid order: status %d, want 409", rec.Code)
+	}
+	if order, _ := store.GetOrderByID(paid.OrderID); order.Status != OrderPaid {
+		t.Errorf("order is %s after the refused cancellation, want paid", order.Status)
+	}
+	if rec := serveWithID(t, CancelOrderHandler, http.MethodPost, paid.OrderID, nil, testAdmin); rec.Code != http.StatusOK {
+		t.Errorf("admin cancelling a paid order: status %d, want 200", rec.Code)
+	}
+	events, _ = store.ListOrderEvents(paid.OrderID)
+	if last := events[len(events)-1]; last.Amount != -paid.TotalPrice {
+		t.Errorf("cancelling a paid order returned %.2f, want %.2f", last.Amount, -paid.TotalPrice)
+	}
+}
+
+func TestRefundOrderHandlerRestocking(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	tests := []struct {
+		name          string
+		statuses      []string
+		wantRestocked bool
+	}{
+		{"paid order goes back into stock", []string{OrderPaid}, true},
+		{"shipped order is counted back in by hand", []string{OrderPaid, OrderShipped}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := stockOf(t, 5)
+			order := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 5, Quantity: 2})
+			for _, status := range tt.statuses {
+				setOrderStatus(t, order.OrderID, status)
+			}
+			if rec := serveWithID(t, RefundOrderHandler, http.MethodPost, order.OrderID, nil, testAdmin); rec.Code != http.StatusOK {
+				t.Fatalf("refund: status %d, body %q", rec.Code, rec.Body.String())
+			}
+			want := before - 2
+			if tt.wantRestocked {
+				want = before
+			}
+			if stock := stockOf(t, 5); stock != want {
+				t.Errorf("stock after the refund is %d, want %d", stock, want)
+			}
+			if rec := serveWithID(t, RefundOrderHandler, http.MethodPost, order.OrderID, nil, testAdmin); rec.Code != http.StatusConflict {
+				t.Errorf("refunding twice: status %d, want 409", rec.Code)
+			}
+		})
+	}
+}
+
+func TestReverseOrderStreak(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+
+	now := time.Now()
+	outside := placeOrderAt(t, alice, now.AddDate(0, 0, -5))
+	twoDaysAgo := placeOrderAt(t, alice, now.AddDate(0, 0, -2))
+	yesterday := placeOrderAt(t, alice, now.AddDate(0, 0, -1))
+	today := placeOrderAt(t, alice, now)
+	if err := store.UpdateUserStreak(alice.UserID, 3, today.OrderDate); err != nil {
+		t.Fatalf("UpdateUserStreak: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		order *Order
+		want  int
+	}{
+		{"order before the streak", outside, 3},
+		{"order inside the streak", yesterday, 1},
+		{"last order of the streak", today, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveWithID(t, CancelOrderHandler, http.MethodPost, tt.order.OrderID, nil, callerFor(alice)); rec.Code != http.StatusOK {
+				t.Fatalf("cancel: status %d, body %q", rec.Code, rec.Body.String())
+			}
+			streak, _ := store.GetUserStreak(alice.UserID)
+			if streak.CurrentStreak != tt.want {
+				t.Errorf("streak %d, want %d", streak.CurrentStreak, tt.want)
+			}
+		})
+	}
+	// With nothing left of the streak, the last activity is the latest live order
+	streak, _ := store.GetUserStreak(alice.UserID)
+	if !streak.LastActivityDate.Equal(twoDaysAgo.OrderDate) {
+		t.Errorf("last activity %s, want the order of two days ago %s", streak.LastActivityDate, twoDaysAgo.OrderDate)
+	}
+}
+
+func TestSerialReturner(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	alice := createTestUser(t, "alice", "unused")
+	refund := func() {
+		order := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 6, Quantity: 1})
+		setOrderStatus(t, order.OrderID, OrderPaid)
+		if rec := serveWithID(t, RefundOrderHandler, http.MethodPost, order.OrderID, nil, testAdmin); rec.Code != http.StatusOK {
+			t.Fatalf("refund: status %d", rec.Code)
+		}
+	}
+	keep := func() { placeTestOrder(t, alice, PlaceOrderItem{ProductID: 6, Quantity: 1}) }
+
+	steps := []struct {
+		name   string
+		order  func()
+		orders string
+		want   bool
+	}{
+		{"first refund", refund, "1 of 1 refunded", false}, // too few orders to judge
+		{"second refund", refund, "2 of 2 refunded", false},
+		{"first kept order", keep, "2 of 3 refunded", true},
+		{"second kept order", keep, "2 of 4 refunded", true},
+		{"third kept order", keep, "2 of 5 refunded", true},
+		{"fourth kept order", keep, "2 of 6 refunded", true},
+		{"fifth kept order", keep, "2 of 7 refunded", false}, // 28.6%
+	}
+	for _, step := range steps {
+		step.order()
+		got, err := serialReturner(alice.UserID)
+		if err != nil {
+			t.Fatalf("serialReturner: %v", err)
+		}
+		if got != step.want {
+			t.Errorf("after the %s (%s): serialReturner = %t, want %t", step.name, step.orders, got, step.want)
+		}
+	}
+
+	// A cancelled order is no order at all
+	cancelled := placeTestOrder(t, alice, PlaceOrderItem{ProductID: 6, Quantity: 1})
+	serveWithID(t, CancelOrderHandler, http.MethodPost, cancelled.OrderID, nil, callerFor(alice))
+	if got, _ := serialReturner(alice.UserID); got {
+		t.Error("a cancelled order made the user a serial returner")
+	}
+}
+
+func TestAssessUserForOfferSkipsSerialReturners(t *testing.T) {
+	userData := &UserData{User: User{UserID: 1, Username: "alice"}, PreferredCategoryIDs: []int{2}, ChurnRisk: 0.9}
+	stocked := map[int]bool{2: true}
+
+	if ok, categoryID := AssessUserForOffer(userData, stocked); !ok || categoryID != 2 {
+		t.Fatalf("AssessUserForOffer = %t, %d; want an offer on category 2", ok, categoryID)
+	}
+	userData.SerialReturner = true
+	if ok, _ := AssessUserForOffer(userData, stocked); ok {
+		t.Error("a serial returner was offered a discount")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	PasswordAlgorithmBcrypt   = "bcrypt"
+	PasswordAlgorithmArgon2id = "argon2id"
+)
+
+// PasswordPolicy describes how new password hashes are produced.
+// Stored hashes that don't match the policy are upgraded on the next successful login.
+type PasswordPolicy struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32 // KiB
+	Argon2Threads uint8
+}
+
+const (
+	defaultBcryptCost    = 12
+	argon2SaltLength     = 16
+	argon2KeyLength      = 32
+	defaultArgon2Time    = 3
+	defaultArgon2Memory  = 64 * 1024
+	defaultArgon2Threads = 2
+
+	// Limits on the parameters of a stored argon2id hash. The hash string sets how much
+	// memory and time verifying costs, so anything outside them is treated as malformed.
+	maxArgon2Time   = 16
+	maxArgon2Memory = 1024 * 1024 // 1 GiB
+)
+
+// currentPasswordPolicy reads the hashing policy from the environment.
+// PASSWORD_HASH_ALGORITHM selects "bcrypt" (default) or "argon2id"; BCRYPT_COST overrides the bcrypt cost.
+func currentPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		Algorithm:     PasswordAlgorithmBcrypt,
+		BcryptCost:    defaultBcryptCost,
+		Argon2Time:    defaultArgon2Time,
+		Argon2Memory:  defaultArgon2Memory,
+		Argon2Threads: defaultArgon2Threads,
+	}
+	if algo := os.Getenv("PASSWORD_HASH_ALGORITHM"); algo == PasswordAlgorithmArgon2id {
+		policy.Algorithm = PasswordAlgorithmArgon2id
+	}
+	if cost, err := strconv.Atoi(os.Getenv("BCRYPT_COST")); err == nil && cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost {
+		policy.BcryptCost = cost
+	}
+	return policy
+}
+
+// HashPassword hashes a password with the current policy.
+// bcrypt hashes use the standard "$2a$<cost>$..." format and argon2id hashes use the
+// PHC format "$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>", so the
+// algorithm and cost are always recoverable from the stored value.
+func HashPassword(password string) (string, error) {
+	return currentPasswordPolicy().Hash(password)
+}
+
+// Hash hashes a password with this policy
+func (p PasswordPolicy) Hash(password string) (string, error) {
+	switch p.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("error generating salt: %w", err)
+		}
+		key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	default:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("error hashing password: %w", err)
+		}
+		return string(hash), nil
+	}
+}
+
+// VerifyPassword checks a password against a stored hash in constant time.
+// needsRehash is true when the password matched but the stored value is legacy
+// plain text or was produced by a weaker or different algorithm than the current policy.
+func VerifyPassword(stored, password string) (ok bool, needsRehash bool, err error) {
+	policy := currentPasswordPolicy()
+
+	switch {
+	case strings.HasPrefix(stored, "$argon2id$"):
+		ok, params, err := verifyArgon2id(stored, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		weaker := params.Argon2Time < policy.Argon2Time || params.Argon2Memory < policy.Argon2Memory || params.Argon2Threads < policy.Argon2Threads
+		return true, policy.Algorithm != PasswordAlgorithmArgon2id || weaker, nil
+
+	case strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		} else if err != nil {
+			return false, false, fmt.Errorf("error verifying bcrypt hash: %w", err)
+		}
+		cost, err := bcrypt.Cost([]byte(stored))
+		if err != nil {
+			return false, false, fmt.Errorf("error reading bcrypt cost: %w", err)
+		}
+		return true, policy.Algorithm != PasswordAlgorithmBcrypt || cost < policy.BcryptCost, nil
+
+	default:
+		// Legacy rows store the password verbatim in password_hash
+		if stored == "" {
+			return false, false, nil
+		}
+		match := subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return match, match, nil
+	}
+}
+
+// verifyArgon2id parses a PHC-formatted argon2id hash and compares it to the password
+func verifyArgon2id(stored, password string) (bool, PasswordPolicy, error) {
+	params := PasswordPolicy{Algorithm: PasswordAlgorithmArgon2id}
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return false, params, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, params, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Threads); err != nil {
+		return false, params, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	if params.Argon2Time < 1 || params.Argon2Time > maxArgon2Time || params.Argon2Threads < 1 ||
+		params.Argon2Memory < 8*uint32(params.Argon2Threads) || params.Argon2Memory > maxArgon2Memory {
+		return false, params, fmt.Errorf("malformed argon2id parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, params, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, params, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	if len(expected) == 0 {
+		return false, params, fmt.Errorf("malformed argon2id hash: empty key")
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(expected, actual) == 1, params, nil
+}
+
+// dummyPasswordHashes caches, per policy, the hash VerifyDummyPassword compares against
+var (
+	dummyPasswordHashesMu sync.Mutex
+	dummyPasswordHashes   = map[PasswordPolicy]string{}
+)
+
+// dummyPasswordHash returns a hash of a fixed password produced by the current policy
+func dummyPasswordHash() (string, error) {
+	policy := currentPasswordPolicy()
+	dummyPasswordHashesMu.Lock()
+	defer dummyPasswordHashesMu.Unlock()
+	if hash, ok := dummyPasswordHashes[policy]; ok {
+		return hash, nil
+	}
+	hash, err := policy.Hash("dummy password for unknown accounts")
+	if err != nil {
+		return "", err
+	}
+	dummyPasswordHashes[policy] = hash
+	return hash, nil
+}
+
+// VerifyDummyPassword spends as long as VerifyPassword does on a real account, so a
+// login for an unknown user takes as long as one with a wrong password and response
+// times don't reveal which usernames and emails exist
+func VerifyDummyPassword(password string) {
+	hash, err := dummyPasswordHash()
+	if err != nil {
+		return
+	}
+	VerifyPassword(hash, password)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPasswordResetTTL is how long an emailed reset link stays valid
+	defaultPasswordResetTTL = time.Hour
+	// passwordResetCooldown is how long after a reset link was issued no new one is sent,
+	// so the endpoint can't be used to flood a mailbox
+	passwordResetCooldown = time.Minute
+)
+
+// passwordResetTTL is PASSWORD_RESET_TTL, read at startup by loadDurations
+var passwordResetTTL = defaultPasswordResetTTL
+
+// passwordResetLink builds the link emailed to the user from PASSWORD_RESET_URL,
+// the frontend page that collects the new password and calls /api/password/reset
+func passwordResetLink(token string) string {
+	base := os.Getenv("PASSWORD_RESET_URL")
+	if base == "" {
+		base = "http://localhost:3000/reset-password"
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+// ForgotPasswordHandler emails a single-use password reset link.
+// It answers the same way whether or not the email is registered, so it can't be
+// used to find out which addresses have accounts.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := store.GetUserByEmail(strings.ToLower(strings.TrimSpace(req.Email)))
+	if err != nil {
+		log.Printf("Error retrieving user for password reset: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if user != nil {
+		if err := issuePasswordReset(user); err != nil {
+			log.Printf("Error issuing password reset for user %d: %v", user.UserID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		log.Printf("Password reset requested for unknown email")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+// issuePasswordReset stores a new reset token for the user and emails the link, unless
+// one was issued less than passwordResetCooldown ago. The email is sent in the background
+// so response times don't reveal whether the account exists.
+func issuePasswordReset(user *User) error {
+	latest, err := store.GetLatestPasswordResetToken(user.UserID)
+	if err != nil {
+		return err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < passwordResetCooldown {
+		log.Printf("Password reset for user %d skipped: one was issued at %s", user.UserID, latest.CreatedAt.Format(time.RFC3339))
+		return nil
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = store.SavePasswordResetToken(PasswordResetToken{
+		UserID:    user.UserID,
+		TokenHash: hashOpaqueToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := Email{
+		To:      user.Email,
+		Subject: "Đặt lại mật khẩu / Reset your password",
+		Body: fmt.Sprintf("Xin chào %s,\n\nMở liên kết sau để đặt lại mật khẩu (hết hạn sau %s):\n%s\n\n"+
+			"Nếu bạn không yêu cầu đặt lại mật khẩu, hãy bỏ qua email này.\n",
+			user.Username, passwordResetTTL, passwordResetLink(token)),
+	}
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("Error sending password reset email to user %d: %v", user.UserID, err)
+		}
+	}()
+	log.Printf("Password reset issued for user %d", user.UserID)
+	return nil
+}
+
+// ResetPasswordHandler sets a new password using a reset token. The token and any other
+// reset links of the user are consumed, and every refresh token of the user is revoked
+// so existing sessions must log in again.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := store.GetPasswordResetTokenByHash(hashOpaqueToken(req.Token))
+	if err != nil {
+		log.Printf("Error retrieving password reset token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if token == nil || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error hashing password for user %d: %v", token.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Claim the token atomically so two concurrent requests can't both use it
+	used, err := store.MarkPasswordResetTokenUsed(token.TokenID, time.Now())
+	if err != nil {
+		log.Printf("Error using password reset token %d: %v", token.TokenID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !used {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.UpdateUserPasswordHash(token.UserID, passwordHash); err != nil {
+		log.Printf("Error updating password for user %d: %v", token.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Other links still sitting in the mailbox must not reset the password again
+	if err := store.MarkUserPasswordResetTokensUsed(token.UserID, time.Now()); err != nil {
+		log.Printf("Error using password reset tokens of user %d: %v", token.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := store.RevokeUserRefreshTokens(token.UserID, time.Now()); err != nil {
+		log.Printf("Error revoking refresh tokens for user %d: %v", token.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// A user who reset their password shouldn't stay locked out by earlier failed guesses
+	if err := loginLimiter.ResetAccount(token.UserID); err != nil {
+		log.Printf("Error resetting login attempts for user %d: %v", token.UserID, err)
+	}
+	log.Printf("Password reset completed for user %d", token.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Password has been reset. Please log in again.",
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// testMailSender hands sent emails to the test instead of delivering them
+type testMailSender chan Email
+
+func (s testMailSender) Send(msg Email) error {
+	s <- msg
+	return nil
+}
+
+// useTestMailer points mailer at a testMailSender and restores it when the test ends
+func useTestMailer(t *testing.T) testMailSender {
+	t.Helper()
+	oldMailer := mailer
+	t.Cleanup(func() { mailer = oldMailer })
+	sent := make(testMailSender, 10)
+	mailer = sent
+	return sent
+}
+
+// resetLinkToken matches the token in the link of a password reset email
+var resetLinkToken = regexp.MustCompile(`[?&]token=([^&\s]+)`)
+
+// requestPasswordReset posts email to ForgotPasswordHandler and returns the response body
+func requestPasswordReset(t *testing.T, email string) string {
+	t.Helper()
+	rec := postJSON(t, ForgotPasswordHandler, "/api/password/forgot", ForgotPasswordRequest{Email: email})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("forgot password for %s: status %d, want 200", email, rec.Code)
+	}
+	return rec.Body.String()
+}
+
+// receiveResetToken waits for the reset email to email and returns the token in its link
+func receiveResetToken(t *testing.T, sent testMailSender, email string) string {
+	t.Helper()
+	select {
+	case msg := <-sent:
+		if msg.To != email {
+			t.Fatalf("reset email sent to %s, want %s", msg.To, email)
+		}
+		match := resetLinkToken.FindStringSubmatch(msg.Body)
+		if match == nil {
+			t.Fatalf("no reset link in %q", msg.Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatalf("unescaping reset token: %v", err)
+		}
+		return token
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reset email was sent to %s", email)
+		return ""
+	}
+}
+
+// resetPassword posts token and password to ResetPasswordHandler and returns the status
+func resetPassword(t *testing.T, token, password string) int {
+	t.Helper()
+	return postJSON(t, ResetPasswordHandler, "/api/password/reset", ResetPasswordRequest{Token: token, Password: password}).Code
+}
+
+func TestForgotPasswordHandlerHidesUnknownEmails(t *testing.T) {
+	useMemoryStore(t)
+	sent := useTestMailer(t)
+	createTestUser(t, "alice", "unused")
+
+	known := requestPasswordReset(t, "alice@example.com")
+	receiveResetToken(t, sent, "alice@example.com")
+	unknown := requestPasswordReset(t, "nobody@example.com")
+	if known != unknown {
+		t.Errorf("responses differ:\nknown email   %q\nunknown email %q", known, unknown)
+	}
+
+	select {
+	case msg := <-sent:
+		t.Errorf("an email was sent to %s for an unknown address", msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	useMemoryStore(t)
+	sent := useTestMailer(t)
+	user := createTestUser(t, "alice", "old-password-1")
+	session, err := issueSession(user, "")
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+
+	requestPasswordReset(t, " Alice@Example.com ")
+	token := receiveResetToken(t, sent, "alice@example.com")
+
+	if code := resetPassword(t, token, "short"); code != http.StatusBadRequest {
+		t.Errorf("weak password: status %d, want 400", code)
+	}
+	if code := resetPassword(t, token, "new-password-2"); code != http.StatusOK {
+		t.Fatalf("reset: status %d, want 200", code)
+	}
+
+	updated, err := store.GetUserByID(user.UserID)
+	if err != nil || updated == nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if ok, _, _ := VerifyPassword(updated.PasswordHash, "new-password-2"); !ok {
+		t.Error("the new password doesn't match the stored hash")
+	}
+	if code, _ := refresh(t, session.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh token issued before the reset: status %d, want 401", code)
+	}
+
+	// The token is single use
+	if code := resetPassword(t, token, "third-password-3"); code != http.StatusBadRequest {
+		t.Errorf("second reset with the same token: status %d, want 400", code)
+	}
+	if code := resetPassword(t, "not-a-reset-token", "third-password-3"); code != http.StatusBadRequest {
+		t.Errorf("unknown token: status %d, want 400", code)
+	}
+}
+
+func TestResetPasswordHandlerRejectsExpiredToken(t *testing.T) {
+	memory := useMemoryStore(t)
+	sent := useTestMailer(t)
+	user := createTestUser(t, "alice", "old-password-1")
+
+	requestPasswordReset(t, "alice@example.com")
+	token := receiveResetToken(t, sent, "alice@example.com")
+	memory.mu.Lock()
+	memory.passwordResetTokens[0].ExpiresAt = time.Now().Add(-time.Minute)
+	memory.mu.Unlock()
+
+	if code := resetPassword(t, token, "new-password-2"); code != http.StatusBadRequest {
+		t.Errorf("expired token: status %d, want 400", code)
+	}
+	unchanged, _ := store.GetUserByID(user.UserID)
+	if unchanged.PasswordHash != "old-password-1" {
+		t.Error("an expired token changed the password")
+	}
+}
+
+// backdateResetTokens moves the issue time of every reset token past the cooldown
+func backdateResetTokens(memory *MemoryStore) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	for i := range memory.passwordResetTokens {
+		memory.passwordResetTokens[i].CreatedAt = memory.passwordResetTokens[i].CreatedAt.Add(-passwordResetCooldown)
+	}
+}
+
+func TestForgotPasswordHandlerCooldown(t *testing.T) {
+	memory := useMemoryStore(t)
+	sent := useTestMailer(t)
+	createTestUser(t, "alice", "unused")
+
+	first := requestPasswordReset(t, "alice@example.com")
+	receiveResetToken(t, sent, "alice@example.com")
+	if again := requestPasswordReset(t, "alice@example.com"); again != first {
+		t.Errorf("response within the cooldown %q, want %q", again, first)
+	}
+	select {
+	case <-sent:
+		t.Error("a second reset email was sent within the cooldown")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := len(memory.passwordResetTokens); n != 1 {
+		t.Errorf("%d reset tokens stored, want 1", n)
+	}
+
+	backdateResetTokens(memory)
+	requestPasswordReset(t, "alice@example.com")
+	receiveResetToken(t, sent, "alice@example.com")
+}
+
+func TestResetPasswordHandlerConsumesOlderLinks(t *testing.T) {
+	memory := useMemoryStore(t)
+	sent := useTestMailer(t)
+	user := createTestUser(t, "alice", "old-password-1")
+
+	requestPasswordReset(t, "alice@example.com")
+	older := receiveResetToken(t, sent, "alice@example.com")
+	backdateResetTokens(memory)
+	requestPasswordReset(t, "alice@example.com")
+	newer := receiveResetToken(t, sent, "alice@example.com")
+
+	if code := resetPassword(t, newer, "new-password-2"); code != http.StatusOK {
+		t.Fatalf("reset with the newer link: status %d, want 200", code)
+	}
+	if code := resetPassword(t, older, "attacker-password-3"); code != http.StatusBadRequest {
+		t.Errorf("reset with the older link: status %d, want 400", code)
+	}
+	updated, _ := store.GetUserByID(user.UserID)
+	if ok, _, _ := VerifyPassword(updated.PasswordHash, "new-password-2"); !ok {
+		t.Error("the older link changed the password")
+	}
+}
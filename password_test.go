@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "4")
+	bcryptHash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	// Cheap argon2id parameters; the policy asks for more, so the hash needs upgrading
+	argonHash, err := PasswordPolicy{Algorithm: PasswordAlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("argon2id hash %q is not in PHC format", argonHash)
+	}
+
+	tests := []struct {
+		name            string
+		stored          string
+		password        string
+		wantOK          bool
+		wantNeedsRehash bool
+	}{
+		{"bcrypt", bcryptHash, "correct horse", true, false},
+		{"bcrypt wrong password", bcryptHash, "battery staple", false, false},
+		{"argon2id below the policy", argonHash, "correct horse", true, true},
+		{"argon2id wrong password", argonHash, "battery staple", false, false},
+		{"plain text", "correct horse", "correct horse", true, true},
+		{"plain text wrong password", "correct horse", "battery staple", false, false},
+		{"empty hash", "", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := VerifyPassword(tt.stored, tt.password)
+			if err != nil {
+				t.Fatalf("VerifyPassword: %v", err)
+			}
+			if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+				t.Errorf("VerifyPassword = %t, %t; want %t, %t", ok, needsRehash, tt.wantOK, tt.wantNeedsRehash)
+			}
+		})
+	}
+
+	// A bcrypt hash is upgraded once the policy switches to argon2id
+	t.Setenv("PASSWORD_HASH_ALGORITHM", PasswordAlgorithmArgon2id)
+	if ok, needsRehash, _ := VerifyPassword(bcryptHash, "correct horse"); !ok || !needsRehash {
+		t.Errorf("bcrypt hash under the argon2id policy: VerifyPassword = %t, %t; want true, true", ok, needsRehash)
+	}
+
+	if _, _, err := VerifyPassword("$argon2id$v=19$garbage", "correct horse"); err == nil {
+		t.Error("malformed argon2id hash accepted")
+	}
+}
+
+func TestVerifyPasswordRejectsArgon2idParameters(t *testing.T) {
+	// The salt and key of a real hash, so only the parameters are wrong
+	hash, err := PasswordPolicy{Algorithm: PasswordAlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	parts := strings.Split(hash, "$")
+
+	tests := []struct {
+		name   string
+		params string
+		key    string
+	}{
+		{"zero time", "m=1024,t=0,p=1", parts[5]},
+		{"too much time", "m=1024,t=1000000,p=1", parts[5]},
+		{"zero threads", "m=1024,t=1,p=0", parts[5]},
+		{"memory below 8 KiB per thread", "m=31,t=1,p=4", parts[5]},
+		{"memory over 1 GiB", "m=4194304,t=1,p=1", parts[5]},
+		{"empty key", "m=1024,t=1,p=1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := strings.Join([]string{"", "argon2id", "v=19", tt.params, parts[4], tt.key}, "$")
+			if ok, _, err := VerifyPassword(stored, "correct horse"); ok || err == nil {
+				t.Errorf("VerifyPassword(%q) = %t, %v; want rejected as malformed", stored, ok, err)
+			}
+		})
+	}
+}
+
+func TestDummyPasswordHashFollowsPolicy(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "5")
+	hash, err := dummyPasswordHash()
+	if err != nil {
+		t.Fatalf("dummyPasswordHash: %v", err)
+	}
+	// Matching the policy means the dummy verify costs the same as a real one
+	if !strings.HasPrefix(hash, "$2a$05$") {
+		t.Errorf("dummy hash %q was not produced at the current bcrypt cost", hash)
+	}
+	if again, _ := dummyPasswordHash(); again != hash {
+		t.Error("dummy hash was not reused for the same policy")
+	}
+
+	t.Setenv("BCRYPT_COST", "4")
+	if other, _ := dummyPasswordHash(); !strings.HasPrefix(other, "$2a$04$") {
+		t.Errorf("dummy hash %q did not follow the policy change", other)
+	}
+}
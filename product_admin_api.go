@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxProductPrice is the largest value products.price (DECIMAL(10,2)) can hold
+	maxProductPrice = 99999999.99
+	// maxProductNameLength is the length of products.product_name (VARCHAR(255) in
+	// utf8mb4), counted in characters, not bytes
+	maxProductNameLength = 255
+)
+
+// CreateProductHandler adds a product to the catalogue (POST /api/products)
+func CreateProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ProductID < 0 {
+		http.Error(w, "product_id must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.Price == nil {
+		http.Error(w, "price is required", http.StatusBadRequest)
+		return
+	}
+	product := Product{ProductID: req.ProductID, ProductName: req.ProductName, CategoryID: req.CategoryID, Price: *req.Price,
+		StockQuantity: req.StockQuantity, LowStockThreshold: defaultLowStockThreshold}
+	if req.LowStockThreshold != nil {
+		product.LowStockThreshold = *req.LowStockThreshold
+	}
+	if err := validateProduct(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if product.StockQuantity < 0 || product.LowStockThreshold < 0 {
+		http.Error(w, "stock_quantity and low_stock_threshold can't be negative", http.StatusBadRequest)
+		return
+	}
+	if !checkProductCategory(w, product.CategoryID) {
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	product.UpdatedAt = time.Now()
+	productID, err := store.CreateProduct(product, admin.UserID)
+	if errors.Is(err, ErrProductExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error creating product: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	product.ProductID = productID
+	log.Printf("Admin %d created product %d (%s)", admin.UserID, product.ProductID, product.ProductName)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(product)
+}
+
+// UpdateProductHandler replaces all fields of a product (PUT /api/products/{id})
+func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := activeProductFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ProductID != 0 && req.ProductID != product.ProductID {
+		http.Error(w, "product_id doesn't match the URL", http.StatusBadRequest)
+		return
+	}
+	if req.Price == nil {
+		http.Error(w, "price is required", http.StatusBadRequest)
+		return
+	}
+	product.ProductName, product.CategoryID, product.Price = req.ProductName, req.CategoryID, *req.Price
+
+	saveProduct(w, r, product)
+}
+
+// PatchProductHandler updates the fields present in the body (PATCH /api/products/{id})
+func PatchProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	product, ok := activeProductFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req ProductPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ProductName != nil {
+		product.ProductName = *req.ProductName
+	}
+	if req.CategoryID != nil {
+		product.CategoryID = *req.CategoryID
+	}
+	if req.Price != nil {
+		product.Price = *req.Price
+	}
+
+	saveProduct(w, r, product)
+}
+
+// saveProduct validates and stores an edited product, then writes it back
+func saveProduct(w http.ResponseWriter, r *http.Request, product *Product) {
+	if err := validateProduct(product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkProductCategory(w, product.CategoryID) {
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	product.UpdatedAt = time.Now()
+	updated, err := store.UpdateProduct(*product, admin.UserID)
+	if err != nil {
+		log.Printf("Error updating product %d: %v", product.ProductID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !updated { // deleted between the lookup and the update
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Admin %d updated product %d", admin.UserID, product.ProductID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// DeleteProductHandler soft-deletes a product (DELETE /api/products/{id}). The row is
+// kept so past orders still show what was bought; it just disappears from listings.
+func DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	deleted, err := store.DeleteProduct(productID, time.Now())
+	if err != nil {
+		log.Printf("Error deleting product %d: %v", productID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	log.Printf("Admin %d deleted product %d", admin.UserID, productID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"message":    "Product deleted",
+		"product_id": productID,
+	})
+}
+
+// ProductPriceHistoryHandler lists the price changes of a product, including deleted ones
+func ProductPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	product, err := store.GetProductByID(productID)
+	if err != nil {
+		log.Printf("Error retrieving product %d: %v", productID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if product == nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	changes, err := store.GetProductPriceChanges(productID)
+	if err != nil {
+		log.Printf("Error retrieving price changes of product %d: %v", productID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []ProductPriceChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"product":       product,
+		"price_changes": changes,
+	})
+}
+
+// activeProductFromPath loads the non-deleted product for the {id} path value, writing 400/404 on failure
+func activeProductFromPath(w http.ResponseWriter, r *http.Request) (*Product, bool) {
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	product, err := store.GetProductByID(productID)
+	if err != nil {
+		log.Printf("Error retrieving product %d: %v", productID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if product == nil || product.DeletedAt != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return nil, false
+	}
+	return product, true
+}
+
+// validateProduct trims and checks the editable product fields; the category is
+// checked against the store separately (see checkProductCategory)
+func validateProduct(product *Product) error {
+	product.ProductName = strings.TrimSpace(product.ProductName)
+	if product.ProductName == "" || utf8.RuneCountInString(product.ProductName) > maxProductNameLength {
+		return fmt.Errorf("product_name is required (max %d characters)", maxProductNameLength)
+	}
+	if product.CategoryID <= 0 {
+		return fmt.Errorf("category_id is required")
+	}
+	if math.IsNaN(product.Price) || product.Price < 0 || product.Price > maxProductPrice {
+		return fmt.Errorf("price must be between 0 and %.2f", maxProductPrice)
+	}
+	return nil
+}
+
+// checkProductCategory verifies that the category exists, writing 400/500 otherwise
+func checkProductCategory(w http.ResponseWriter, categoryID int) bool {
+	category, err := store.GetCategoryByID(categoryID)
+	if err != nil {
+		log.Printf("Error retrieving category %d: %v", categoryID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if category == nil {
+		http.Error(w, fmt.Sprintf("unknown category_id %d (see GET /api/categories)", categoryID), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
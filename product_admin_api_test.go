@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// floatPtr returns a pointer to f, for optional request fields
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestValidateProductNameLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		product string
+		wantErr bool
+	}{
+		// "ữ" is 3 bytes in UTF-8, so 255 of them are 765 bytes but fit VARCHAR(255)
+		{"255 accented characters", strings.Repeat("ữ", 255), false},
+		{"256 accented characters", strings.Repeat("ữ", 256), true},
+		{"255 ASCII characters", strings.Repeat("a", 255), false},
+		{"blank", "   ", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := Product{ProductName: tt.product, CategoryID: 1, Price: 100}
+			if err := validateProduct(&product); (err != nil) != tt.wantErr {
+				t.Errorf("validateProduct error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateProductHandlerValidation(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	admin := createTestUser(t, "admin", "unused")
+
+	tests := []struct {
+		name string
+		req  ProductRequest
+		want int
+	}{
+		{"valid", ProductRequest{ProductName: "Áo Thun Trẻ Em", CategoryID: 2, Price: floatPtr(150000)}, http.StatusCreated},
+		{"negative price", ProductRequest{ProductName: "Áo Thun", CategoryID: 2, Price: floatPtr(-1)}, http.StatusBadRequest},
+		{"missing price", ProductRequest{ProductName: "Áo Thun", CategoryID: 2}, http.StatusBadRequest},
+		{"unknown category", ProductRequest{ProductName: "Áo Thun", CategoryID: 999, Price: floatPtr(150000)}, http.StatusBadRequest},
+		{"blank name", ProductRequest{ProductName: " ", CategoryID: 2, Price: floatPtr(150000)}, http.StatusBadRequest},
+		{"negative stock", ProductRequest{ProductName: "Áo Thun", CategoryID: 2, Price: floatPtr(150000), StockQuantity: -1}, http.StatusBadRequest},
+		{"existing ID", ProductRequest{ProductID: 1, ProductName: "Áo Thun", CategoryID: 2, Price: floatPtr(150000)}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveAs(CreateProductHandler, newJSONRequest(t, http.MethodPost, "/api/products", tt.req), callerFor(admin))
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d; body %q", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeletedProductIsNotFound(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	admin := createTestUser(t, "admin", "unused")
+
+	if rec := serveWithID(t, DeleteProductHandler, http.MethodDelete, 3, nil, callerFor(admin)); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, want 200", rec.Code)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    interface{}
+	}{
+		{"PUT", UpdateProductHandler, http.MethodPut, ProductRequest{ProductName: "Giày", CategoryID: 5, Price: floatPtr(1)}},
+		{"PATCH", PatchProductHandler, http.MethodPatch, ProductPatchRequest{Price: floatPtr(1)}},
+		{"DELETE", DeleteProductHandler, http.MethodDelete, nil},
+		{"GET", GetProductHandler, http.MethodGet, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveWithID(t, tt.handler, tt.method, 3, tt.body, callerFor(admin)); rec.Code != http.StatusNotFound {
+				t.Errorf("status %d, want 404", rec.Code)
+			}
+		})
+	}
+	if product, _ := store.GetProductByID(3); product == nil || product.Price != 700000 {
+		t.Errorf("deleted product changed: %+v", product)
+	}
+}
+
+func TestPriceChangeAudit(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	admin := createTestUser(t, "admin", "unused")
+
+	changes := func() []ProductPriceChange {
+		t.Helper()
+		changes, err := store.GetProductPriceChanges(1)
+		if err != nil {
+			t.Fatalf("GetProductPriceChanges: %v", err)
+		}
+		return changes
+	}
+	patch := func(req ProductPatchRequest) {
+		t.Helper()
+		if rec := serveWithID(t, PatchProductHandler, http.MethodPatch, 1, req, callerFor(admin)); rec.Code != http.StatusOK {
+			t.Fatalf("PATCH %+v: status %d, body %q", req, rec.Code, rec.Body.String())
+		}
+	}
+	before := len(changes())
+
+	name := "Áo Khoác Nữ Denim Xanh"
+	patch(ProductPatchRequest{ProductName: &name})
+	patch(ProductPatchRequest{Price: floatPtr(450000)})
+	rec := serveWithID(t, UpdateProductHandler, http.MethodPut, 1,
+		ProductRequest{ProductName: name, CategoryID: 2, Price: floatPtr(450000)}, callerFor(admin))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if after := len(changes()); after != before {
+		t.Fatalf("%d price changes recorded without a new price", after-before)
+	}
+
+	patch(ProductPatchRequest{Price: floatPtr(399000)})
+	all := changes()
+	if len(all) != before+1 {
+		t.Fatalf("%d price changes recorded for one new price, want 1", len(all)-before)
+	}
+	var latest ProductPriceChange
+	for _, c := range all {
+		if c.ChangeID > latest.ChangeID {
+			latest = c
+		}
+	}
+	if latest.OldPrice == nil || *latest.OldPrice != 450000 || latest.NewPrice != 399000 ||
+		latest.ChangedBy == nil || *latest.ChangedBy != admin.UserID {
+		got, _ := json.Marshal(latest)
+		t.Errorf("price change %s, want 450000 -> 399000 by user %d", got, admin.UserID)
+	}
+}
@@ -1,25 +1,214 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// getProductsHandler handles requests to /api/products
+const (
+	defaultProductPageSize = 20
+	maxProductPageSize     = 100
+)
+
+// GetProductsHandler handles requests to /api/products. Query parameters:
+//
+//	category             category ID or slug; subcategories are included
+//	min_price, max_price price range, inclusive
+//	q                    words that must all appear in the name, ignoring case and Vietnamese diacritics
+//	sort, order          product_id (default), product_name or price; asc (default) or desc
+//	limit, cursor        page size (default 20, max 100) and the next_cursor of the previous page
 func GetProductsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	products, err := GetProducts() // Gọi hàm GetProducts từ db.go
+	query, err := parseProductQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if value := strings.TrimSpace(r.URL.Query().Get("category")); value != "" {
+		categories, err := store.GetCategories()
+		if err != nil {
+			log.Printf("Error getting categories: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		category := findCategory(categories, value)
+		if category == nil {
+			http.Error(w, "Unknown category", http.StatusBadRequest)
+			return
+		}
+		query.CategoryIDs = categoryWithDescendants(categories, category.CategoryID)
+	}
+	limit := query.Limit
+	query.Limit++ // one extra row tells us whether there is a next page
+
+	products, total, err := store.ListProducts(query) // Gọi hàm ListProducts từ Store
 	if err != nil {
 		log.Printf("Error getting products: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products) // Mã hóa danh sách sản phẩm thành JSON và gửi về client
+	response := ProductListResponse{Products: products, Total: total}
+	if len(products) > limit {
+		response.Products = products[:limit]
+		last := response.Products[limit-1]
+		cursor := encodeProductCursor(ProductCursor{
+			SortBy:    query.SortBy,
+			Desc:      query.Desc,
+			Price:     last.Price,
+			Name:      last.ProductName,
+			ProductID: last.ProductID,
+		})
+		response.NextCursor = &cursor
+	}
+	if response.Products == nil {
+		response.Products = []Product{}
+	}
+
+	writeCachedJSON(w, r, response, time.Time{}) // Mã hóa danh sách sản phẩm thành JSON và gửi về client (304 nếu không đổi)
+}
+
+// GetProductHandler returns one product with its category (GET /api/products/{id}).
+// The response carries an ETag and a Last-Modified date; conditional requests whose
+// validators still match get 304 Not Modified. Deleted products are 404.
+func GetProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	locale, err := requestLocale(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	product, err := store.GetProductByID(productID)
+	if err != nil {
+		log.Printf("Error retrieving product %d: %v", productID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if product == nil || product.DeletedAt != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	categories, err := store.GetCategories()
+	if err != nil {
+		log.Printf("Error getting categories: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	response := ProductDetailResponse{
+		Product:      *product,
+		CategoryPath: categoryPath(categories, product.CategoryID, locale),
+	}
+	for _, c := range categories {
+		if c.CategoryID == product.CategoryID {
+			c.Name = c.LocalizedName(locale)
+			response.Category = &c
+			break
+		}
+	}
+
+	lastModified := product.UpdatedAt
+	if product.ReservedQuantity > 0 {
+		// A reservation lapsing frees stock without touching updated_at; only the ETag notices
+		lastModified = time.Time{}
+	}
+	w.Header().Set("Vary", "Accept-Language") // category names follow the client's language
+	writeCachedJSON(w, r, response, lastModified)
+}
+
+// parseProductQuery validates the listing query parameters
+func parseProductQuery(params url.Values) (ProductQuery, error) {
+	query := ProductQuery{
+		SearchTerms: searchTerms(params.Get("q")),
+		SortBy:      ProductSortID,
+		Limit:       defaultProductPageSize,
+	}
+
+	for name, target := range map[string]**float64{"min_price": &query.MinPrice, "max_price": &query.MaxPrice} {
+		if v := params.Get(name); v != "" {
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil || price < 0 {
+				return query, fmt.Errorf("%s must be a non-negative number", name)
+			}
+			*target = &price
+		}
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return query, fmt.Errorf("min_price must not be greater than max_price")
+	}
+
+	switch sortBy := params.Get("sort"); sortBy {
+	case "", ProductSortID:
+	case ProductSortName, ProductSortPrice:
+		query.SortBy = sortBy
+	default:
+		return query, fmt.Errorf("sort must be one of product_id, product_name, price")
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxProductPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxProductPageSize)
+		}
+		query.Limit = n
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		cursor, err := decodeProductCursor(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid cursor")
+		}
+		if cursor.SortBy != query.SortBy || cursor.Desc != query.Desc {
+			return query, fmt.Errorf("cursor was issued for a different sort order")
+		}
+		query.After = cursor
+	}
+	return query, nil
+}
+
+// encodeProductCursor turns a cursor into the opaque next_cursor string
+func encodeProductCursor(cursor ProductCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeProductCursor parses a next_cursor string
+func decodeProductCursor(value string) (*ProductCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor ProductCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// listProducts calls GetProductsHandler with query and decodes the page
+func listProducts(t *testing.T, query url.Values) ProductListResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	GetProductsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/products?"+query.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/products?%s: status %d, body %q", query.Encode(), rec.Code, rec.Body.String())
+	}
+	var page ProductListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("decoding products: %v", err)
+	}
+	return page
+}
+
+func TestParseProductQueryCursor(t *testing.T) {
+	cursor := encodeProductCursor(ProductCursor{SortBy: ProductSortPrice, Price: 100000, ProductID: 4})
+
+	tests := []struct {
+		name    string
+		params  string
+		wantErr bool
+	}{
+		{"same sort and order", "sort=price", false},
+		{"changed sort", "sort=product_name", true},
+		{"default sort", "", true},
+		{"changed order", "sort=price&order=desc", true},
+		{"malformed cursor", "sort=price&cursor=not-a-cursor", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, _ := url.ParseQuery(tt.params)
+			if !params.Has("cursor") {
+				params.Set("cursor", cursor)
+			}
+			query, err := parseProductQuery(params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProductQuery(%s) error = %v, want error %t", tt.params, err, tt.wantErr)
+			}
+			if err == nil && (query.After == nil || query.After.ProductID != 4) {
+				t.Errorf("cursor not carried into the query: %+v", query.After)
+			}
+		})
+	}
+}
+
+func TestGetProductsHandlerPagesThroughPriceTies(t *testing.T) {
+	useMemoryStore(t)
+	// Ten products sharing three prices, so most page boundaries fall inside a tie
+	var products []Product
+	for i := 1; i <= 10; i++ {
+		p := Product{ProductID: i, ProductName: fmt.Sprintf("Sản phẩm %02d", i), CategoryID: 2,
+			Price: float64(100000 * (1 + i%3)), LowStockThreshold: 5, UpdatedAt: time.Now()}
+		if _, err := store.CreateProduct(p, 0); err != nil {
+			t.Fatalf("CreateProduct: %v", err)
+		}
+		products = append(products, p)
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		t.Run(order, func(t *testing.T) {
+			want := append([]Product(nil), products...)
+			sort.Slice(want, func(i, j int) bool {
+				a, b := want[i], want[j]
+				if order == "desc" {
+					a, b = b, a
+				}
+				if a.Price != b.Price {
+					return a.Price < b.Price
+				}
+				return a.ProductID < b.ProductID
+			})
+			var wantIDs []int
+			for _, p := range want {
+				wantIDs = append(wantIDs, p.ProductID)
+			}
+
+			var gotIDs []int
+			query := url.Values{"sort": {"price"}, "order": {order}, "limit": {"3"}}
+			for pages := 0; ; pages++ {
+				if pages > len(products) {
+					t.Fatal("paging did not end")
+				}
+				page := listProducts(t, query)
+				if page.Total != len(products) {
+					t.Errorf("total %d, want %d", page.Total, len(products))
+				}
+				for _, p := range page.Products {
+					gotIDs = append(gotIDs, p.ProductID)
+				}
+				if page.NextCursor == nil {
+					break
+				}
+				query.Set("cursor", *page.NextCursor)
+			}
+			if !reflect.DeepEqual(gotIDs, wantIDs) {
+				t.Errorf("paged through %v, want %v", gotIDs, wantIDs)
+			}
+		})
+	}
+}
+
+func TestGetProductsHandlerCategoryIncludesSubcategories(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+
+	tests := []struct {
+		category string
+		want     []int
+	}{
+		{"1", []int{1, 2, 4, 6}},       // Thời trang: women's and men's fashion
+		{"thoi-trang-nu", []int{1, 2}}, // a subcategory alone
+		{"giay-dep", []int{3, 8}},      // Giày dép through Giày dép nữ
+		{"dien-tu", []int{5, 7}},       // no subcategories
+	}
+	for _, tt := range tests {
+		t.Run(tt.category, func(t *testing.T) {
+			page := listProducts(t, url.Values{"category": {tt.category}})
+			var got []int
+			for _, p := range page.Products {
+				got = append(got, p.ProductID)
+			}
+			if !reflect.DeepEqual(got, tt.want) || page.Total != len(tt.want) {
+				t.Errorf("products %v (total %d), want %v", got, page.Total, tt.want)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	GetProductsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/products?category=no-such-category", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown category: status %d, want 400", rec.Code)
+	}
+}
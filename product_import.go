@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File formats of the product import and export
+const (
+	ProductFormatCSV   = "csv"
+	ProductFormatJSONL = "jsonl" // JSON Lines: one product object per line
+)
+
+const (
+	maxProductImportRows  = 10000
+	maxProductImportBytes = 10 << 20
+	productExportPageSize = 500
+)
+
+// productColumns is the CSV header written by the export. Imports need product_name,
+// price and category_id or category_slug; rows with a product_id update that product,
+// the others create new ones. stock_quantity and low_stock_threshold are optional: a
+// value is a stock count, and a blank cell leaves the product's inventory alone (new
+// products then start with no stock). updated_at and unknown columns are ignored.
+var productColumns = []string{"product_id", "product_name", "category_id", "category_slug", "price", "stock_quantity", "low_stock_threshold", "updated_at"}
+
+// productRecord is one product of an import or export file
+type productRecord struct {
+	ProductID         int        `json:"product_id,omitempty"`
+	ProductName       string     `json:"product_name"`
+	CategoryID        int        `json:"category_id,omitempty"`
+	CategorySlug      string     `json:"category_slug,omitempty"`
+	Price             *float64   `json:"price"`
+	StockQuantity     *int       `json:"stock_quantity,omitempty"` // nil leaves the stock alone
+	LowStockThreshold *int       `json:"low_stock_threshold,omitempty"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"` // Export only
+
+	line int // Line of the file the record starts on
+}
+
+// productFormat picks the file format from an explicit format, else the file name's
+// extension, else the Content-Type
+func productFormat(format, filename, contentType string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv":
+			format = ProductFormatCSV
+		case ".jsonl", ".ndjson":
+			format = ProductFormatJSONL
+		}
+	}
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "text/csv":
+			format = ProductFormatCSV
+		case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+			format = ProductFormatJSONL
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case ProductFormatCSV:
+		return ProductFormatCSV, nil
+	case ProductFormatJSONL, "ndjson":
+		return ProductFormatJSONL, nil
+	}
+	return "", fmt.Errorf("format must be %s or %s", ProductFormatCSV, ProductFormatJSONL)
+}
+
+// readProductRecords parses an import file. Rows that can't be parsed are returned as
+// errors; the error result is for files that can't be read at all.
+func readProductRecords(r io.Reader, format string) ([]productRecord, []ProductImportError, error) {
+	if format == ProductFormatCSV {
+		return readProductCSV(r)
+	}
+	return readProductJSONL(r)
+}
+
+// readProductCSV parses a CSV file with a header row
+func readProductCSV(r io.Reader) ([]productRecord, []ProductImportError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // short rows are fine, missing cells are empty
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("the file is empty")
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) // Excel writes a BOM
+		columns[name] = i
+	}
+	for _, required := range []string{"product_name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("the CSV header has no %s column", required)
+		}
+	}
+	_, hasCategoryID := columns["category_id"]
+	_, hasCategorySlug := columns["category_slug"]
+	if !hasCategoryID && !hasCategorySlug {
+		return nil, nil, fmt.Errorf("the CSV header has no category_id or category_slug column")
+	}
+
+	var records []productRecord
+	var rowErrors []ProductImportError
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, ProductImportError{Line: parseErr.StartLine, Message: parseErr.Err.Error()})
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if len(records)+len(rowErrors) >= maxProductImportRows {
+			return nil, nil, fmt.Errorf("the file has more than %d rows", maxProductImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(fields, "")) == "" {
+			continue // blank spreadsheet row
+		}
+
+		record := productRecord{ProductName: get("product_name"), CategorySlug: get("category_slug"), line: line}
+		var problems []string
+		for column, target := range map[string]*int{"product_id": &record.ProductID, "category_id": &record.CategoryID} {
+			if v := get(column); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					problems = append(problems, column+" must be a whole number")
+				}
+				*target = n
+			}
+		}
+		for column, target := range map[string]**int{"stock_quantity": &record.StockQuantity, "low_stock_threshold": &record.LowStockThreshold} {
+			if v := get(column); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					problems = append(problems, column+" must be a whole number")
+				}
+				*target = &n
+			}
+		}
+		if v := get("price"); v != "" {
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				problems = append(problems, "price must be a number")
+			}
+			record.Price = &price
+		}
+		if len(problems) > 0 {
+			sort.Strings(problems)
+			rowErrors = append(rowErrors, ProductImportError{Line: line, ProductID: record.ProductID, Message: strings.Join(problems, "; ")})
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, rowErrors, nil
+}
+
+// readProductJSONL parses a JSON Lines file; blank lines are skipped
+func readProductJSONL(r io.Reader) ([]productRecord, []ProductImportError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	var records []productRecord
+	var rowErrors []ProductImportError
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if text == "" {
+			continue
+		}
+		if len(records)+len(rowErrors) >= maxProductImportRows {
+			return nil, nil, fmt.Errorf("the file has more than %d rows", maxProductImportRows)
+		}
+
+		var record productRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			rowErrors = append(rowErrors, ProductImportError{Line: line, Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+		record.line = line
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(records)+len(rowErrors) == 0 {
+		return nil, nil, fmt.Errorf("the file is empty")
+	}
+	return records, rowErrors, nil
+}
+
+// importProducts validates parsed records against the catalogue and, unless this is a
+// dry run or any row is invalid, saves them in one transaction. Rows identical to the
+// stored product are left alone so they keep their updated_at (and ETag). The counts
+// describe what the import did, or would do once the errors are fixed.
+func importProducts(records []productRecord, rowErrors []ProductImportError, dryRun bool, changedBy int) (*ProductImportReport, error) {
+	report := &ProductImportReport{DryRun: dryRun, Rows: len(records) + len(rowErrors), Errors: rowErrors}
+
+	categories, err := store.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+	categoryIDs := make(map[int]bool, len(categories))
+	slugs := make(map[string]int, len(categories))
+	for _, c := range categories {
+		categoryIDs[c.CategoryID] = true
+		slugs[c.Slug] = c.CategoryID
+	}
+
+	now := time.Now()
+	firstLine := make(map[int]int) // product_id -> line it first appears on
+	var changes []ProductUpsert
+	for _, record := range records {
+		fail := func(format string, args ...interface{}) {
+			report.Errors = append(report.Errors, ProductImportError{Line: record.line, ProductID: record.ProductID, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if record.ProductID < 0 {
+			fail("product_id must be positive")
+			continue
+		}
+		if record.ProductID > 0 {
+			if line, seen := firstLine[record.ProductID]; seen {
+				fail("product_id %d is already on line %d", record.ProductID, line)
+				continue
+			}
+			firstLine[record.ProductID] = record.line
+		}
+		if record.Price == nil {
+			fail("price is required")
+			continue
+		}
+
+		categoryID := record.CategoryID
+		if record.CategorySlug != "" {
+			id, ok := slugs[record.CategorySlug]
+			if !ok {
+				fail("unknown category_slug %q", record.CategorySlug)
+				continue
+			}
+			if categoryID != 0 && categoryID != id {
+				fail("category_id %d doesn't match category_slug %q", categoryID, record.CategorySlug)
+				continue
+			}
+			categoryID = id
+		} else if categoryID != 0 && !categoryIDs[categoryID] {
+			fail("unknown category_id %d", categoryID)
+			continue
+		}
+
+		if (record.StockQuantity != nil && *record.StockQuantity < 0) || (record.LowStockThreshold != nil && *record.LowStockThreshold < 0) {
+			fail("stock_quantity and low_stock_threshold can't be negative")
+			continue
+		}
+
+		// The stock fields are used when the product is created
+		product := Product{ProductID: record.ProductID, ProductName: record.ProductName, CategoryID: categoryID, Price: *record.Price, UpdatedAt: now,
+			LowStockThreshold: defaultLowStockThreshold}
+		var stock *StockChange
+		if record.StockQuantity != nil || record.LowStockThreshold != nil {
+			stock = &StockChange{Quantity: record.StockQuantity, LowStockThreshold: record.LowStockThreshold, ChangedAt: now}
+			if record.StockQuantity != nil {
+				product.StockQuantity = *record.StockQuantity
+			}
+			if record.LowStockThreshold != nil {
+				product.LowStockThreshold = *record.LowStockThreshold
+			}
+		}
+		if err := validateProduct(&product); err != nil {
+			fail("%s", err.Error())
+			continue
+		}
+
+		if product.ProductID == 0 {
+			report.Created++
+		} else {
+			existing, err := store.GetProductByID(product.ProductID)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case existing == nil:
+				report.Created++
+			case existing.DeletedAt != nil:
+				fail("product %d was deleted", product.ProductID)
+				continue
+			case record.StockQuantity != nil && *record.StockQuantity < existing.ReservedQuantity:
+				fail("stock_quantity %d is below the %d units reserved", *record.StockQuantity, existing.ReservedQuantity)
+				continue
+			case existing.ProductName == product.ProductName && existing.CategoryID == product.CategoryID && existing.Price == product.Price &&
+				(record.StockQuantity == nil || *record.StockQuantity == existing.StockQuantity) &&
+				(record.LowStockThreshold == nil || *record.LowStockThreshold == existing.LowStockThreshold):
+				report.Unchanged++
+				continue
+			default:
+				report.Updated++
+			}
+		}
+		changes = append(changes, ProductUpsert{Product: product, Stock: stock})
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+	if report.Errors == nil {
+		report.Errors = []ProductImportError{}
+	}
+	if dryRun || len(report.Errors) > 0 || len(changes) == 0 {
+		return report, nil
+	}
+	if err := store.UpsertProducts(changes, changedBy); errors.Is(err, ErrInsufficientStock) {
+		// An order reserved units after the rows were checked
+		report.Errors = append(report.Errors, ProductImportError{Message: err.Error()})
+		return report, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// exportProducts streams the catalogue (without deleted products) ordered by product_id,
+// one page at a time; flush, when set, is called after each page
+func exportProducts(w io.Writer, format string, flush func()) error {
+	categories, err := store.GetCategories()
+	if err != nil {
+		return err
+	}
+	slugs := make(map[int]string, len(categories))
+	for _, c := range categories {
+		slugs[c.CategoryID] = c.Slug
+	}
+
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	if format == ProductFormatCSV {
+		if err := csvWriter.Write(productColumns); err != nil {
+			return err
+		}
+	}
+
+	query := ProductQuery{SortBy: ProductSortID, Limit: productExportPageSize}
+	for {
+		products, _, err := store.ListProducts(query)
+		if err != nil {
+			return err
+		}
+		for _, p := range products {
+			if format == ProductFormatCSV {
+				err = csvWriter.Write([]string{
+					strconv.Itoa(p.ProductID), p.ProductName, strconv.Itoa(p.CategoryID), slugs[p.CategoryID],
+					strconv.FormatFloat(p.Price, 'f', -1, 64), strconv.Itoa(p.StockQuantity), strconv.Itoa(p.LowStockThreshold),
+					p.UpdatedAt.UTC().Format(time.RFC3339),
+				})
+			} else {
+				price, stock, threshold, updatedAt := p.Price, p.StockQuantity, p.LowStockThreshold, p.UpdatedAt
+				err = encoder.Encode(productRecord{
+					ProductID: p.ProductID, ProductName: p.ProductName, CategoryID: p.CategoryID,
+					CategorySlug: slugs[p.CategoryID], Price: &price,
+					StockQuantity: &stock, LowStockThreshold: &threshold, UpdatedAt: &updatedAt,
+				})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+
+		if len(products) < query.Limit {
+			return nil
+		}
+		query.After = &ProductCursor{SortBy: ProductSortID, ProductID: products[len(products)-1].ProductID}
+	}
+}
+
+// RunProductsCommand implements `go run . products import [-dry-run] [-format csv|jsonl] <file>`
+// and `go run . products export [-format csv|jsonl] <file>` against the configured store
+func RunProductsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected import or export")
+	}
+
+	switch args[0] {
+	case "import":
+		flags := flag.NewFlagSet("products import", flag.ContinueOnError)
+		dryRun := flags.Bool("dry-run", false, "validate the file without saving anything")
+		format := flags.String("format", "", "csv or jsonl (default: from the file extension)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: products import [-dry-run] [-format csv|jsonl] <file>")
+		}
+		fileFormat, err := productFormat(*format, flags.Arg(0), "")
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		records, rowErrors, err := readProductRecords(file, fileFormat)
+		if err != nil {
+			return err
+		}
+		report, err := importProducts(records, rowErrors, *dryRun, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range report.Errors {
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", e.Line, e.Message)
+		}
+		fmt.Printf("%d rows: %d to create, %d to update, %d unchanged\n", report.Rows, report.Created, report.Updated, report.Unchanged)
+		if len(report.Errors) > 0 {
+			return fmt.Errorf("%d rows have errors; nothing was imported", len(report.Errors))
+		}
+		if *dryRun {
+			fmt.Println("Dry run: nothing was saved.")
+		} else {
+			fmt.Println("Import complete.")
+		}
+		return nil
+
+	case "export":
+		flags := flag.NewFlagSet("products export", flag.ContinueOnError)
+		format := flags.String("format", "", "csv or jsonl (default: from the file extension)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: products export [-format csv|jsonl] <file>")
+		}
+		fileFormat, err := productFormat(*format, flags.Arg(0), "")
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Create(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		out := bufio.NewWriter(file)
+		if err := exportProducts(out, fileFormat, nil); err != nil {
+			file.Close()
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("Exported products to %s\n", flags.Arg(0))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown products action %q (expected import or export)", args[0])
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ImportProductsHandler imports products from a CSV or JSON Lines file
+// (POST /api/admin/products/import). The file is the request body, or the "file"
+// field of a multipart form. ?dry_run=true only validates it. A file with any invalid
+// row is rejected as a whole with 422 and a per-row error report.
+func ImportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxProductImportBytes)
+	var body io.Reader = r.Body
+	filename := ""
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "The multipart form needs a \"file\" field", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body, filename = file, header.Filename
+	}
+	format, err := productFormat(r.URL.Query().Get("format"), filename, r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, rowErrors, err := readProductRecords(body, format)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("The file is larger than %d MB", maxProductImportBytes>>20), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admin, _ := AuthUserFromContext(r.Context())
+	report, err := importProducts(records, rowErrors, dryRun, admin.UserID)
+	if err != nil {
+		log.Printf("Error importing products: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if !dryRun && len(report.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	} else if !dryRun {
+		log.Printf("Admin %d imported products: %d created, %d updated", admin.UserID, report.Created, report.Updated)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ExportProductsHandler streams the catalogue as CSV (default) or JSON Lines
+// (GET /api/admin/products/export?format=jsonl), in the format the import accepts
+func ExportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := ProductFormatCSV
+	if v := r.URL.Query().Get("format"); v != "" {
+		var err error
+		if format, err = productFormat(v, "", ""); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == ProductFormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="products-%s.%s"`, time.Now().Format("20060102"), format))
+
+	flusher, _ := w.(http.Flusher)
+	err := exportProducts(w, format, func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		// The status line is already sent; the client sees a truncated file
+		log.Printf("Error exporting products: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importCSV runs an import of a CSV file given as text
+func importCSV(t *testing.T, text string, dryRun bool) *ProductImportReport {
+	t.Helper()
+	records, rowErrors, err := readProductRecords(strings.NewReader(text), ProductFormatCSV)
+	if err != nil {
+		t.Fatalf("readProductRecords: %v", err)
+	}
+	report, err := importProducts(records, rowErrors, dryRun, 0)
+	if err != nil {
+		t.Fatalf("importProducts: %v", err)
+	}
+	return report
+}
+
+func TestImportProductsCountsStock(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	// Products migrated from before inventory tracking have no stock
+	for _, id := range []int{1, 2} {
+		zero := 0
+		if _, err := store.UpdateProductStock(id, StockChange{Quantity: &zero, ChangedAt: time.Now()}); err != nil {
+			t.Fatalf("UpdateProductStock: %v", err)
+		}
+	}
+	if _, err := store.ReserveStock(StockReservation{ProductID: 3, UserID: 1, Quantity: 4, Status: ReservationActive,
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("ReserveStock: %v", err)
+	}
+
+	report := importCSV(t, `product_id,product_name,category_id,price,stock_quantity,low_stock_threshold
+1,Áo Khoác Nữ Denim,2,450000,30,
+2,Váy Hoa Công Sở,2,600000,,8
+3,Giày Cao Gót Đen,5,700000,3,
+`, false)
+	if len(report.Errors) != 1 || report.Errors[0].Line != 4 || !strings.Contains(report.Errors[0].Message, "reserved") {
+		t.Fatalf("a count below the reserved units was not rejected: %+v", report.Errors)
+	}
+
+	report = importCSV(t, `product_id,product_name,category_id,price,stock_quantity,low_stock_threshold
+1,Áo Khoác Nữ Denim,2,450000,30,
+2,Váy Hoa Công Sở,2,600000,,8
+3,Giày Cao Gót Đen,5,700000,,
+9,Áo Len Nữ,2,300000,12,2
+`, false)
+	if len(report.Errors) != 0 || report.Updated != 2 || report.Unchanged != 1 || report.Created != 1 {
+		t.Fatalf("report = %+v, want 2 updated, 1 unchanged, 1 created", report)
+	}
+
+	tests := []struct {
+		productID     int
+		wantStock     int
+		wantThreshold int
+	}{
+		{1, 30, 5}, // counted
+		{2, 0, 8},  // blank stock_quantity keeps the stock
+		{3, 12, 3}, // untouched
+		{9, 12, 2}, // created with the counted stock
+	}
+	for _, tt := range tests {
+		p, _ := store.GetProductByID(tt.productID)
+		if p == nil || p.StockQuantity != tt.wantStock || p.LowStockThreshold != tt.wantThreshold {
+			t.Errorf("product %d: %+v, want stock %d and threshold %d", tt.productID, p, tt.wantStock, tt.wantThreshold)
+		}
+	}
+}
+
+func TestImportProductsReportsRowErrors(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	if _, err := store.DeleteProduct(8, time.Now()); err != nil {
+		t.Fatalf("DeleteProduct: %v", err)
+	}
+
+	// Excel writes a BOM before the header and leaves blank rows
+	file := "\ufeffproduct_id,product_name,category_id,category_slug,price\n" +
+		"1,Áo Khoác Nữ Denim,2,,450000\n" + // unchanged
+		",,,,\n" +
+		"2,Váy Hoa Công Sở,,thoi-trang-nu,650000\n" + // updated
+		",Áo Len Nữ,,thoi-trang-nu,300000\n" + // created
+		"3,Giày Cao Gót Đen,5,,abc\n" +
+		"1,Áo Khoác Nữ Denim,2,,450000\n" +
+		"4,Quần Jeans Nam,,giay,500000\n" +
+		"5,Tai Nghe Bluetooth,2,dien-tu,1200000\n" +
+		"8,Dép Đi Biển,5,,150000\n"
+
+	records, rowErrors, err := readProductRecords(strings.NewReader(file), ProductFormatCSV)
+	if err != nil {
+		t.Fatalf("readProductRecords: %v", err)
+	}
+	report, err := importProducts(records, rowErrors, false, 0)
+	if err != nil {
+		t.Fatalf("importProducts: %v", err)
+	}
+
+	want := []struct {
+		line    int
+		message string
+	}{
+		{6, "price must be a number"},
+		{7, "product_id 1 is already on line 2"},
+		{8, `unknown category_slug "giay"`},
+		{9, `category_id 2 doesn't match category_slug "dien-tu"`},
+		{10, "product 8 was deleted"},
+	}
+	if len(report.Errors) != len(want) {
+		t.Fatalf("errors %+v, want %d", report.Errors, len(want))
+	}
+	for i, w := range want {
+		if got := report.Errors[i]; got.Line != w.line || got.Message != w.message {
+			t.Errorf("error %d = line %d %q, want line %d %q", i, got.Line, got.Message, w.line, w.message)
+		}
+	}
+	// The blank row isn't a row
+	if report.Rows != 8 || report.Created != 1 || report.Updated != 1 || report.Unchanged != 1 {
+		t.Errorf("report %+v, want 8 rows: 1 created, 1 updated, 1 unchanged", report)
+	}
+	// Nothing is saved while any row is invalid
+	if p, _ := store.GetProductByID(2); p.Price != 600000 {
+		t.Errorf("product 2 costs %.0f after a failed import, want 600000", p.Price)
+	}
+}
+
+func TestImportProductsDryRun(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	file := "product_id,product_name,category_id,price\n" +
+		"1,Áo Khoác Nữ Denim,2,450000\n" +
+		"2,Váy Hoa Công Sở,2,650000\n" +
+		",Áo Len Nữ,2,300000\n"
+
+	report := importCSV(t, file, true)
+	if !report.DryRun || report.Rows != 3 || report.Created != 1 || report.Updated != 1 || report.Unchanged != 1 || len(report.Errors) != 0 {
+		t.Fatalf("dry run report %+v, want 1 created, 1 updated, 1 unchanged", report)
+	}
+	if p, _ := store.GetProductByID(2); p.Price != 600000 {
+		t.Errorf("the dry run changed product 2's price to %.0f", p.Price)
+	}
+	if p, _ := store.GetProductByID(9); p != nil {
+		t.Error("the dry run created a product")
+	}
+
+	// The same file for real does what the dry run said
+	if real := importCSV(t, file, false); real.Created != 1 || real.Updated != 1 || real.Unchanged != 1 {
+		t.Errorf("import report %+v, want the dry run's counts", real)
+	}
+	if p, _ := store.GetProductByID(2); p.Price != 650000 {
+		t.Errorf("product 2 costs %.0f after the import, want 650000", p.Price)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	useMemoryStore(t)
+	products := createTestProducts(t)
+
+	for _, format := range []string{ProductFormatCSV, ProductFormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var file bytes.Buffer
+			if err := exportProducts(&file, format, nil); err != nil {
+				t.Fatalf("exportProducts: %v", err)
+			}
+			records, rowErrors, err := readProductRecords(&file, format)
+			if err != nil {
+				t.Fatalf("readProductRecords: %v", err)
+			}
+			report, err := importProducts(records, rowErrors, false, 0)
+			if err != nil {
+				t.Fatalf("importProducts: %v", err)
+			}
+			if report.Rows != len(products) || report.Unchanged != len(products) || len(report.Errors) != 0 {
+				t.Errorf("re-importing the export: %+v, want all %d rows unchanged", report, len(products))
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// vietnameseFolds maps precomposed Vietnamese vowels (and đ) to their base letter
+var vietnameseFolds = func() map[rune]rune {
+	folds := map[rune]rune{'đ': 'd'}
+	for base, variants := range map[rune]string{
+		'a': "àáạảãâầấậẩẫăằắặẳẵ",
+		'e': "èéẹẻẽêềếệểễ",
+		'i': "ìíịỉĩ",
+		'o': "òóọỏõôồốộổỗơờớợởỡ",
+		'u': "ùúụủũưừứựửữ",
+		'y': "ỳýỵỷỹ",
+	} {
+		for _, r := range variants {
+			folds[r] = base
+		}
+	}
+	return folds
+}()
+
+// foldVietnamese lower-cases text and strips Vietnamese diacritics, so "Áo Khoác" and
+// "ao khoac" compare equal. Decomposed input (base letter + combining marks) folds the same way.
+// The result is what the products.search_name column stores.
+func foldVietnamese(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, r := range strings.ToLower(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue // combining tone marks, breve, circumflex, horn
+		}
+		if base, ok := vietnameseFolds[r]; ok {
+			r = base
+		}
+		b.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// searchTerms splits a free-text query into folded words; a product matches when its
+// name contains every word
+func searchTerms(query string) []string {
+	return strings.Fields(foldVietnamese(query))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFoldVietnamese(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"precomposed", "Điện tử", "dien tu"},
+		{"decomposed", "\u0110ie\u0323\u0302n tu\u031b\u0309", "dien tu"},
+		{"precomposed capitals", "Áo Khoác", "ao khoac"},
+		{"decomposed capitals", "A\u0301o Khoa\u0301c", "ao khoac"},
+		{"every vowel", "ăâêôơư ỳ ĩ", "aaeoou y i"},
+		{"spacing", "  Giày   Cao\tGót ", "giay cao got"},
+		{"already folded", "quan jeans nam", "quan jeans nam"},
+		{"other scripts untouched", "Café №5", "cafe №5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := foldVietnamese(tt.in); got != tt.want {
+				t.Errorf("foldVietnamese(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	if got, want := searchTerms("  Áo   KHOÁC nữ "), []string{"ao", "khoac", "nu"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("searchTerms = %q, want %q", got, want)
+	}
+	if got := searchTerms("   "); len(got) != 0 {
+		t.Errorf("searchTerms of blanks = %q, want none", got)
+	}
+}
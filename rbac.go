@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Roles stored in the user_roles table and embedded in access tokens
+const (
+	RoleCustomer = "customer"
+	RoleMarketer = "marketer"
+	RoleAnalyst  = "analyst"
+	RoleSupport  = "support"
+	RoleAdmin    = "admin"
+)
+
+// Permissions checked by RequirePermission
+const (
+	PermOffersRead    = "offers:read"
+	PermOffersWrite   = "offers:write"
+	PermAnalyticsRead = "analytics:read"
+	PermModelsRead    = "models:read"
+	PermModelsTrain   = "models:train"
+	PermUsersManage   = "users:manage"
+	PermAPIKeysManage = "api_keys:manage"
+	PermProductsWrite = "products:write"
+	PermOrdersRead    = "orders:read"
+	PermOrdersWrite   = "orders:write"
+	// Mainly used as API key scopes by the CRM and data pipeline
+	PermActivitiesWrite = "activities:write"
+	PermPredictionsRead = "predictions:read"
+)
+
+// rolePermissions maps each role to the permissions it grants. The mapping lives in
+// code next to the routes that check it; which roles a user has lives in the database.
+// Every account has the customer role, which only grants access to its own data.
+var rolePermissions = map[string][]string{
+	RoleCustomer: {},
+	RoleMarketer: {PermOffersRead, PermOffersWrite, PermAnalyticsRead},
+	RoleAnalyst:  {PermAnalyticsRead, PermModelsRead, PermModelsTrain, PermPredictionsRead},
+	RoleSupport:  {PermOrdersRead},
+	RoleAdmin: {
+		PermOffersRead, PermOffersWrite, PermAnalyticsRead,
+		PermModelsRead, PermModelsTrain, PermUsersManage,
+		PermActivitiesWrite, PermPredictionsRead, PermAPIKeysManage,
+		PermProductsWrite, PermOrdersRead, PermOrdersWrite,
+	},
+}
+
+// rolesGrant reports whether any of the roles grants the permission
+func rolesGrant(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeRoles validates a role list, removes duplicates and always keeps the customer role
+func normalizeRoles(roles []string) ([]string, error) {
+	seen := map[string]bool{RoleCustomer: true}
+	for _, role := range roles {
+		if _, ok := rolePermissions[role]; !ok {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+		seen[role] = true
+	}
+	normalized := make([]string, 0, len(seen))
+	for role := range seen {
+		normalized = append(normalized, role)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// usernamePattern allows 3-32 letters, digits, dots, dashes and underscores
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything beyond 72 bytes
+)
+
+// validateRegistration normalizes and checks a registration request
+func validateRegistration(req *RegisterRequest) error {
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	req.Username = strings.TrimSpace(req.Username)
+
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Address != req.Email || len(req.Email) > 255 {
+		return fmt.Errorf("a valid email address is required")
+	}
+	if !usernamePattern.MatchString(req.Username) {
+		return fmt.Errorf("username must be 3-32 characters of letters, digits, '.', '-' or '_'")
+	}
+	return validatePassword(req.Password)
+}
+
+// validatePassword enforces the password policy for new passwords
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength)
+	}
+
+	hasLetter, hasDigit := false, false
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("password must contain at least one letter and one digit")
+	}
+	return nil
+}
+
+// RegisterHandler creates a new customer account and logs it in
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateRegistration(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error hashing password for new user %s: %v", req.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	user := User{
+		Username:       req.Username,
+		Email:          req.Email,
+		PasswordHash:   passwordHash,
+		RegisteredDate: time.Now(),
+		Roles:          []string{RoleCustomer},
+	}
+	user.UserID, err = store.CreateUser(user)
+	if errors.Is(err, ErrEmailTaken) || errors.Is(err, ErrUsernameTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error creating user %s: %v", req.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Registered new user %s (ID: %d)", user.Username, user.UserID)
+
+	session, err := issueSession(&user, "")
+	if err != nil {
+		log.Printf("Error issuing session for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(LoginResponse{
+		UserID:       user.UserID,
+		Username:     user.Username,
+		Token:        session.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    session.ExpiresIn,
+		RefreshToken: session.RefreshToken,
+		Roles:        session.Roles,
+		Message:      "Registration successful",
+		Success:      true,
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRegisterHandlerValidation(t *testing.T) {
+	useMemoryStore(t)
+
+	tests := []struct {
+		name     string
+		req      RegisterRequest
+		wantBody string
+	}{
+		{"invalid email", RegisterRequest{Email: "not-an-email", Username: "alice", Password: "password1"}, "a valid email address is required"},
+		{"email with a display name", RegisterRequest{Email: "Alice <alice@example.com>", Username: "alice", Password: "password1"}, "a valid email address is required"},
+		{"short username", RegisterRequest{Email: "alice@example.com", Username: "al", Password: "password1"}, "username must be 3-32 characters"},
+		{"username with spaces", RegisterRequest{Email: "alice@example.com", Username: "alice smith", Password: "password1"}, "username must be 3-32 characters"},
+		{"short password", RegisterRequest{Email: "alice@example.com", Username: "alice", Password: "pass1"}, "password must be between 8 and 72 characters"},
+		{"password without a digit", RegisterRequest{Email: "alice@example.com", Username: "alice", Password: "password"}, "password must contain at least one letter and one digit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postJSON(t, RegisterHandler, "/api/register", tt.req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+	if user, _ := store.GetUserByEmail("alice@example.com"); user != nil {
+		t.Errorf("an invalid registration created user %d", user.UserID)
+	}
+}
+
+func TestRegisterHandlerRejectsTakenEmailAndUsername(t *testing.T) {
+	useMemoryStore(t)
+	rec := postJSON(t, RegisterHandler, "/api/register", RegisterRequest{Email: "alice@example.com", Username: "alice", Password: "password1"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first registration: status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		req  RegisterRequest
+	}{
+		{"same email", RegisterRequest{Email: "alice@example.com", Username: "alice2", Password: "password1"}},
+		{"email in another case", RegisterRequest{Email: " ALICE@Example.com ", Username: "alice2", Password: "password1"}},
+		{"same username", RegisterRequest{Email: "alice2@example.com", Username: "alice", Password: "password1"}},
+		{"username in another case", RegisterRequest{Email: "alice2@example.com", Username: "Alice", Password: "password1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postJSON(t, RegisterHandler, "/api/register", tt.req); rec.Code != http.StatusConflict {
+				t.Errorf("status %d, want 409; body %q", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegisterHandlerSetsUpNewAccount(t *testing.T) {
+	useMemoryStore(t)
+	rec := postJSON(t, RegisterHandler, "/api/register", RegisterRequest{Email: " Alice@Example.com ", Username: "alice", Password: "password1"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+	var resp LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	claims, err := tokenIssuer.ParseToken(resp.Token, TokenTypeAccess)
+	if err != nil || claims.UserID != resp.UserID || resp.RefreshToken == "" {
+		t.Fatalf("response %+v is not a session for the new user: %v", resp, err)
+	}
+
+	user, err := store.GetUserByEmail("alice@example.com")
+	if err != nil || user == nil || user.UserID != resp.UserID {
+		t.Fatalf("GetUserByEmail = %v, %v; want user %d", user, err, resp.UserID)
+	}
+	if ok, _, _ := VerifyPassword(user.PasswordHash, "password1"); !ok {
+		t.Error("the stored hash doesn't match the password")
+	}
+	if len(user.Roles) != 1 || user.Roles[0] != RoleCustomer {
+		t.Errorf("roles %v, want [%s]", user.Roles, RoleCustomer)
+	}
+
+	// The preferences and streak rows are there for the features of a new account
+	userData, err := store.GetUserData(user.UserID)
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+	streak, err := store.GetUserStreak(user.UserID)
+	if err != nil || streak == nil {
+		t.Fatalf("GetUserStreak = %v, %v; want a fresh streak", streak, err)
+	}
+	features, err := ExtractStreakFeatures(user.UserID, userData)
+	if err != nil {
+		t.Fatalf("ExtractStreakFeatures: %v", err)
+	}
+	if features.CurrentStreakLength != 0 || features.DaysSinceLastActivity != 0 || features.TotalOrders != 0 {
+		t.Errorf("features %+v, want an empty streak active today and no orders", features)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors returned by Store implementations for uniqueness violations
+var (
+	ErrEmailTaken    = errors.New("email is already registered")
+	ErrUsernameTaken = errors.New("username is already taken")
+	ErrProductExists = errors.New("a product with this ID already exists")
+)
+
+// Errors returned by Store implementations for inventory changes
+var (
+	ErrInsufficientStock    = errors.New("not enough stock available")
+	ErrReservationNotActive = errors.New("the reservation is not active")
+	ErrReservationLimit     = errors.New("too many active reservations")
+)
+
+// Errors returned by RedeemOffer for orders an offer can't be applied to
+var (
+	ErrOrderHasOffer = errors.New("the order already has an offer applied")
+	ErrOrderClosed   = errors.New("the order is no longer pending or paid")
+)
+
+// OrderItemError wraps ErrInsufficientStock or ErrReservationNotActive with the product
+// of the order item PlaceOrder rejected
+type OrderItemError struct {
+	ProductID int
+	Err       error
+}
+
+func (e *OrderItemError) Error() string {
+	return fmt.Sprintf("product %d: %v", e.ProductID, e.Err)
+}
+
+func (e *OrderItemError) Unwrap() error {
+	return e.Err
+}
+
+// Store abstracts the persistence layer used by the API handlers and the streak AI model
+type Store interface {
+	// Users
+	// CreateUser inserts a user together with an empty user_preferences row and a
+	// user_streaks row, returning the new user ID
+	CreateUser(user User) (int, error)
+	GetUserData(userID int) (*UserData, error)
+	GetUserByID(userID int) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	UpdateUserLastLogin(userID int, loginTime time.Time) error
+	UpdateUserPasswordHash(userID int, passwordHash string) error
+	// SetUserRoles replaces a user's roles; roles must already be validated
+	SetUserRoles(userID int, roles []string) error
+
+	// Products
+	GetProducts() ([]Product, error)
+	// ListProducts returns up to query.Limit products matching the query, and how many
+	// products match the filters in total (ignoring the cursor)
+	ListProducts(query ProductQuery) ([]Product, int, error)
+	// GetProductByID returns a product, including soft-deleted ones, or nil
+	GetProductByID(productID int) (*Product, error)
+	// CreateProduct inserts a product (with product.ProductID when set) and records its
+	// initial price at product.UpdatedAt; it returns ErrProductExists when the ID is taken
+	CreateProduct(product Product, changedBy int) (int, error)
+	// UpdateProduct replaces a product's fields (including UpdatedAt) and records a price
+	// change, if any, in the same transaction; it returns false when the product doesn't
+	// exist or is deleted
+	UpdateProduct(product Product, changedBy int) (bool, error)
+	// UpsertProducts updates each product whose ID exists and isn't deleted and creates the
+	// others (keeping ProductID when set), applying each update's Stock like
+	// UpdateProductStock, all in one transaction; it returns ErrInsufficientStock, and
+	// saves nothing, when a stock count is below the units reserved
+	UpsertProducts(products []ProductUpsert, changedBy int) error
+	// DeleteProduct soft-deletes a product; it returns false when it doesn't exist or is already deleted
+	DeleteProduct(productID int, deletedAt time.Time) (bool, error)
+	GetProductPriceChanges(productID int) ([]ProductPriceChange, error)
+
+	// Inventory
+	// Product reads fill ReservedQuantity with the units of active reservations that
+	// haven't expired, so an abandoned reservation frees its stock by itself.
+	// UpdateProductStock applies a stock count or adjustment to a non-deleted product and
+	// returns it, or nil when there is none; it returns ErrInsufficientStock instead of
+	// letting the stock drop below zero or below what is reserved
+	UpdateProductStock(productID int, change StockChange) (*Product, error)
+	// ListLowStockProducts returns the non-deleted products whose available quantity is at
+	// or below their low-stock threshold, least available first
+	ListLowStockProducts() ([]Product, error)
+	// GetAvailableStockByCategory returns the available units of non-deleted products per category
+	GetAvailableStockByCategory() (map[int]int, error)
+	// ReserveStock holds reservation.Quantity units of a non-deleted product until
+	// reservation.ExpiresAt and returns the reservation ID, or ErrInsufficientStock. It
+	// returns ErrReservationLimit when the user would hold more than
+	// maxActiveReservationsPerUser active reservations, or more than
+	// maxReservationQuantity reserved units of the product.
+	ReserveStock(reservation StockReservation) (int, error)
+	// GetStockReservation returns a reservation, with Status "expired" once an active one
+	// has lapsed, or nil
+	GetStockReservation(reservationID int) (*StockReservation, error)
+	// ReleaseStockReservation gives an active reservation's units back; it returns false
+	// when the reservation isn't active
+	ReleaseStockReservation(reservationID int, releasedAt time.Time) (bool, error)
+
+	// Orders
+	// PlaceOrder takes the units of every item out of stock and inserts the order with
+	// its items in one transaction, pricing each item at its product's current price
+	// (UnitPrice, LineTotal) and the order at their sum (TotalPrice). It returns the
+	// stored order, placed with status pending. An item with a ReservationID takes its
+	// units from that reservation (which must be the user's active reservation of the
+	// product for at least that quantity, else ErrReservationNotActive); the others from
+	// the available stock, else ErrInsufficientStock. Both come wrapped in an *OrderItemError.
+	PlaceOrder(order Order) (*Order, error)
+	// ListOrders returns up to query.Limit of a user's orders with their items, newest
+	// first, and how many orders match the filters in total (ignoring the cursor)
+	ListOrders(query OrderQuery) ([]Order, int, error)
+	// GetOrderByID returns an order with its items, or nil
+	GetOrderByID(orderID int) (*Order, error)
+	// GetOrderStats aggregates all of a user's orders except cancelled and refunded ones,
+	// which are only counted in RefundedOrders, splitting the spend at trendSplit into
+	// RecentSpent and PreviousSpent (from trendStart)
+	GetOrderStats(userID int, trendStart, trendSplit time.Time) (*OrderStats, error)
+	// UpdateOrderStatus moves order event.OrderID from event.FromStatus to event.ToStatus
+	// and records the event in one transaction, returning it with EventID and ChangedBy
+	// set. With event.Restocked the items' units go back into stock. Cancelling releases
+	// an offer redeemed on the order that hasn't expired, so it can be used again; a
+	// refund keeps the redemption. It returns nil when the order isn't in
+	// event.FromStatus (anymore).
+	UpdateOrderStatus(event OrderEvent, changedBy int) (*OrderEvent, error)
+	// ListOrderEvents returns an order's status changes, oldest first
+	ListOrderEvents(orderID int) ([]OrderEvent, error)
+
+	// Categories
+	// GetCategories returns every category with its localized names, ordered by ID
+	GetCategories() ([]Category, error)
+	// GetCategoryByID returns a category with its localized names, or nil
+	GetCategoryByID(categoryID int) (*Category, error)
+
+	// Offers
+	// SaveOffer inserts an offer and returns its ID
+	SaveOffer(offer Offer) (int, error)
+	GetSavedOffers(userID int) ([]Offer, error)
+	// GetOfferByID returns an offer, or nil
+	GetOfferByID(offerID int) (*Offer, error)
+	// GetOfferByCouponCode returns the offer with a coupon code, or nil
+	GetOfferByCouponCode(code string) (*Offer, error)
+	// RedeemOffer marks an unused offer that hasn't expired at usedAt as used for an
+	// order, in a single conditional update; it returns false when the offer is already
+	// used or has expired, ErrOrderHasOffer when the order has another offer applied and
+	// ErrOrderClosed when the order is no longer pending or paid. The order's status is
+	// checked under the same lock UpdateOrderStatus takes, so a cancellation can't slip in
+	// between and leave the offer used on a cancelled order.
+	RedeemOffer(offerID, orderID int, usedAt time.Time) (bool, error)
+
+	// Streaks and activities
+	GetUserStreak(userID int) (*UserStreak, error)
+	UpdateUserStreak(userID int, currentStreak int, lastActivityDate time.Time) error
+	RecordUserActivity(userID int, activityType string, activityValue float64) error
+	RecordUserActivities(activities []ActivityInput) error
+	// RecordPurchaseActivity records the "purchase" activity of an order
+	RecordPurchaseActivity(userID, orderID int, amount float64) error
+	// GetUserActivities returns a user's most recent activities, newest first, leaving out
+	// the purchases of cancelled and refunded orders
+	GetUserActivities(userID int, limit int) ([]UserActivity, error)
+
+	// Streak predictions and models
+	SaveStreakPrediction(prediction StreakPrediction) error
+	GetStreakPredictions(userID int, limit int) ([]StreakPrediction, error)
+	SaveStreakModel(model StreakModel) error
+	GetActiveStreakModel() (*StreakModel, error)
+
+	LoginAttemptStore
+
+	// Refresh tokens
+	SaveRefreshToken(token RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	// MarkRefreshTokenRotated flags a token as used; it returns false if the token
+	// was already rotated or revoked, so concurrent refreshes can't both succeed.
+	MarkRefreshTokenRotated(tokenID int, rotatedAt time.Time) (bool, error)
+	RevokeRefreshTokenFamily(familyID string, revokedAt time.Time) error
+	RevokeUserRefreshTokens(userID int, revokedAt time.Time) error
+
+	// Password reset tokens
+	SavePasswordResetToken(token PasswordResetToken) error
+	GetPasswordResetTokenByHash(tokenHash string) (*PasswordResetToken, error)
+	// GetLatestPasswordResetToken returns the user's most recently issued token, or nil
+	GetLatestPasswordResetToken(userID int) (*PasswordResetToken, error)
+	// MarkPasswordResetTokenUsed consumes a token; it returns false if the token
+	// was already used, so a token can only reset the password once.
+	MarkPasswordResetTokenUsed(tokenID int, usedAt time.Time) (bool, error)
+	// MarkUserPasswordResetTokensUsed consumes every unused token of a user, so links
+	// issued before a completed reset stop working
+	MarkUserPasswordResetTokensUsed(userID int, usedAt time.Time) error
+
+	// Two-factor authentication
+	GetUserMFA(userID int) (*UserMFA, error)
+	// SaveUserMFASecret starts (or restarts) a pending enrolment with a new secret
+	SaveUserMFASecret(userID int, secret string, createdAt time.Time) error
+	// EnableUserMFA confirms the enrolment and replaces the recovery codes in one step
+	EnableUserMFA(userID int, enabledAt time.Time, recoveryCodeHashes []string) error
+	DisableUserMFA(userID int) error
+	// MarkTOTPStepUsed records an accepted TOTP step; it returns false if that step
+	// or a later one was already used
+	MarkTOTPStepUsed(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	// UseRecoveryCode consumes an unused recovery code; it returns false if there is none
+	UseRecoveryCode(userID int, codeHash string, usedAt time.Time) (bool, error)
+	CountUnusedRecoveryCodes(userID int) (int, error)
+
+	// API keys
+	CreateAPIKey(key APIKey) (int, error)
+	GetAPIKeyByHash(keyHash string) (*APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	// RevokeAPIKey revokes a key; it returns false if the key doesn't exist or is already revoked
+	RevokeAPIKey(keyID int, revokedAt time.Time) (bool, error)
+	TouchAPIKey(keyID int, usedAt time.Time) error
+
+	// OpenID Connect
+	// GetUserByIdentity returns the user linked to an external identity, or nil
+	GetUserByIdentity(issuer, subject string) (*User, error)
+	LinkUserIdentity(identity UserIdentity) error
+	SaveOIDCLoginRequest(req OIDCLoginRequest) error
+	// ConsumeOIDCLoginRequest deletes and returns a pending login request, or nil if
+	// there is none, so each state can only complete one login
+	ConsumeOIDCLoginRequest(stateHash string) (*OIDCLoginRequest, error)
+
+	InsertSampleData() error
+	Close() error
+}
+
+// LoginAttemptStore keeps failed login counters for brute-force protection
+type LoginAttemptStore interface {
+	GetLoginAttempt(key string) (*LoginAttempt, error)
+	// IncrementLoginFailures atomically counts a failure and returns the new count.
+	// The count restarts at 1 when the previous failure happened before windowStart.
+	IncrementLoginFailures(key string, now, windowStart time.Time) (int, error)
+	SetLoginLockout(key string, lockedUntil time.Time) error
+	ResetLoginAttempts(key string) error
+}
+
+// store is the Store selected at startup
+var store Store
+
+// OpenStore creates the Store for the given backend ("mysql" or "memory")
+func OpenStore(backend, mysqlDSN string) (Store, error) {
+	switch backend {
+	case "", "mysql":
+		if mysqlDSN == "" {
+			return nil, fmt.Errorf("MYSQL_DSN must be set for the mysql store backend")
+		}
+		return NewMySQLStore(mysqlDSN)
+	case "memory":
+		fmt.Println("Using in-memory store. Data will be lost on restart.")
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
+}
+
+// sampleData returns the demo users (with hashed passwords) and their preferences seeded by InsertSampleData
+func sampleData() ([]User, []UserPreference, error) {
+	lastLoginB := time.Now().Add(-100 * 24 * time.Hour)
+	lastLoginA := time.Now()
+
+	passwordHashB, err := HashPassword("password123")
+	if err != nil {
+		return nil, nil, err
+	}
+	passwordHashA, err := HashPassword("securepass")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users := []User{
+		{
+			UserID:         101,
+			Username:       "userB",
+			Email:          "user_b@example.com",
+			PasswordHash:   passwordHashB,
+			LastLogin:      &lastLoginB,
+			RegisteredDate: time.Now().Add(-365 * 24 * time.Hour),
+		},
+		{
+			UserID:         102,
+			Username:       "userA",
+			Email:          "user_a@example.com",
+			PasswordHash:   passwordHashA,
+			LastLogin:      &lastLoginA,
+			RegisteredDate: time.Now().Add(-50 * 24 * time.Hour),
+		},
+	}
+
+	preferences := []UserPreference{
+		{UserID: 101, PreferredCategoryIDs: []int{2}, ChurnRisk: 0.85}, // Thời trang nữ, high churn risk
+		{UserID: 102, PreferredCategoryIDs: []int{6}, ChurnRisk: 0.15}, // Điện tử, low churn risk
+	}
+
+	return users, preferences, nil
+}
+
+// sampleProducts returns the demo catalogue seeded by InsertSampleData, filed under
+// the leaf categories of defaultCategories
+func sampleProducts() []Product {
+	return []Product{
+		{ProductID: 1, ProductName: "Áo Khoác Nữ Denim", CategoryID: 2, Price: 450000, StockQuantity: 40, LowStockThreshold: 5},
+		{ProductID: 2, ProductName: "Váy Hoa Công Sở", CategoryID: 2, Price: 600000, StockQuantity: 25, LowStockThreshold: 5},
+		{ProductID: 3, ProductName: "Giày Cao Gót Đen", CategoryID: 5, Price: 700000, StockQuantity: 12, LowStockThreshold: 3},
+		{ProductID: 4, ProductName: "Quần Jeans Nam Slim Fit", CategoryID: 3, Price: 500000, StockQuantity: 30, LowStockThreshold: 5},
+		{ProductID: 5, ProductName: "Tai Nghe Bluetooth", CategoryID: 6, Price: 1200000, StockQuantity: 15, LowStockThreshold: 5},
+		{ProductID: 6, ProductName: "Áo Sơ Mi Nam Trắng", CategoryID: 3, Price: 350000, StockQuantity: 50, LowStockThreshold: 10},
+		{ProductID: 7, ProductName: "Đồng Hồ Thông Minh", CategoryID: 6, Price: 2500000, StockQuantity: 4, LowStockThreshold: 5},
+		{ProductID: 8, ProductName: "Dép Đi Biển", CategoryID: 5, Price: 150000, StockQuantity: 0, LowStockThreshold: 10},
+	}
+}
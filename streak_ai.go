@@ -8,6 +8,9 @@ import (
 	"time"
 )
 
+// orderTrendWindow is the length of the two windows whose spend SpendTrend compares
+const orderTrendWindow = 90 * 24 * time.Hour
+
 // StreakAIModel represents the AI model for streak prediction
 type StreakAIModel struct {
 	Model      *StreakModel
@@ -35,13 +38,13 @@ func ExtractStreakFeatures(userID int, userData *UserData) (*StreakFeatures, err
 	features := &StreakFeatures{UserID: userID}
 
 	// Get user streak data
-	streak, err := GetUserStreak(userID)
+	streak, err := store.GetUserStreak(userID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting user streak: %w", err)
 	}
 
 	// Get user activities
-	activities, err := GetUserActivities(userID, 100)
+	activities, err := store.GetUserActivities(userID, 100)
 	if err != nil {
 		return nil, fmt.Errorf("error getting user activities: %w", err)
 	}
@@ -63,16 +66,25 @@ func ExtractStreakFeatures(userID int, userData *UserData) (*StreakFeatures, err
 	features.TotalActivities = len(activities)
 	features.DaysSinceRegistration = int(time.Since(userData.RegisteredDate).Hours() / 24)
 
-	// Calculate order-based features
-	features.AverageOrderValue = calculateAverageOrderValue(userData.RecentOrders)
-	features.TotalOrders = len(userData.RecentOrders)
-	features.LastOrderDaysAgo = calculateLastOrderDaysAgo(userData.RecentOrders)
+	// Calculate order-based features over the whole order history
+	now := time.Now()
+	orderStats, err := store.GetOrderStats(userID, now.Add(-2*orderTrendWindow), now.Add(-orderTrendWindow))
+	if err != nil {
+		return nil, fmt.Errorf("error getting order stats: %w", err)
+	}
+	features.AverageOrderValue = calculateAverageOrderValue(orderStats)
+	features.TotalOrders = orderStats.TotalOrders
+	features.LastOrderDaysAgo = calculateLastOrderDaysAgo(orderStats, now)
+	features.OrderFrequency = calculateOrderFrequency(orderStats, now)
+	features.AverageBasketSize = calculateAverageBasketSize(orderStats)
+	features.SpendTrend = calculateSpendTrend(orderStats)
+	features.RefundRate = refundRate(orderStats)
 
 	// Use existing churn risk
 	features.ChurnRisk = userData.ChurnRisk
 
 	// Calculate category preferences
-	features.PreferredCategoriesCount = len(userData.PreferredCategories)
+	features.PreferredCategoriesCount = len(userData.PreferredCategoryIDs)
 
 	// Calculate temporal features
 	features.SeasonalFactor = calculateSeasonalFactor()
@@ -83,11 +95,7 @@ func ExtractStreakFeatures(userID int, userData *UserData) (*StreakFeatures, err
 }
 
 // calculateAverageStreakLength calculates the average length of user streaks
-func calculateAverageStreakLength(activities []struct {
-	ActivityType  string
-	ActivityDate  time.Time
-	ActivityValue float64
-}) float64 {
+func calculateAverageStreakLength(activities []UserActivity) float64 {
 	if len(activities) < 2 {
 		return 0
 	}
@@ -124,11 +132,7 @@ func calculateAverageStreakLength(activities []struct {
 }
 
 // calculateStreakBreakFrequency calculates how often user breaks their streaks
-func calculateStreakBreakFrequency(activities []struct {
-	ActivityType  string
-	ActivityDate  time.Time
-	ActivityValue float64
-}) float64 {
+func calculateStreakBreakFrequency(activities []UserActivity) float64 {
 	if len(activities) < 2 {
 		return 0
 	}
@@ -151,48 +155,54 @@ func calculateStreakBreakFrequency(activities []struct {
 	return float64(breaks) / float64(totalGaps)
 }
 
-// calculateAverageOrderValue calculates average order value from recent orders
-func calculateAverageOrderValue(recentOrders []struct {
-	OrderDate   time.Time
-	Category    string
-	ProductName string
-}) float64 {
-	if len(recentOrders) == 0 {
+// calculateAverageOrderValue calculates the average basket total of all orders that
+// weren't cancelled or refunded
+func calculateAverageOrderValue(stats *OrderStats) float64 {
+	if stats.TotalOrders == 0 {
 		return 0
 	}
 
-	// Simulate order values based on categories
-	totalValue := 0.0
-	for _, order := range recentOrders {
-		switch order.Category {
-		case "Thời trang nữ":
-			totalValue += 500000
-		case "Thời trang nam":
-			totalValue += 400000
-		case "Giày dép nữ":
-			totalValue += 700000
-		case "Điện tử":
-			totalValue += 1200000
-		default:
-			totalValue += 300000
-		}
-	}
-
-	return totalValue / float64(len(recentOrders))
+	return stats.TotalSpent / float64(stats.TotalOrders)
 }
 
 // calculateLastOrderDaysAgo calculates days since last order
-func calculateLastOrderDaysAgo(recentOrders []struct {
-	OrderDate   time.Time
-	Category    string
-	ProductName string
-}) int {
-	if len(recentOrders) == 0 {
+func calculateLastOrderDaysAgo(stats *OrderStats, now time.Time) int {
+	if stats.LastOrderDate == nil {
 		return 999
 	}
 
-	lastOrder := recentOrders[0] // Most recent order
-	return int(time.Since(lastOrder.OrderDate).Hours() / 24)
+	return int(now.Sub(*stats.LastOrderDate).Hours() / 24)
+}
+
+// calculateOrderFrequency calculates orders per 30 days since the first order, counting
+// at least 30 days so a single recent order doesn't look like a daily habit
+func calculateOrderFrequency(stats *OrderStats, now time.Time) float64 {
+	if stats.FirstOrderDate == nil {
+		return 0
+	}
+
+	days := math.Max(30, now.Sub(*stats.FirstOrderDate).Hours()/24)
+	return float64(stats.TotalOrders) / days * 30
+}
+
+// calculateAverageBasketSize calculates the average number of units per order
+func calculateAverageBasketSize(stats *OrderStats) float64 {
+	if stats.TotalOrders == 0 {
+		return 0
+	}
+
+	return float64(stats.TotalUnits) / float64(stats.TotalOrders)
+}
+
+// calculateSpendTrend compares the spend of the last orderTrendWindow with the window
+// before it: -1 when the user stopped spending, 0 when flat, 1 when they just started
+func calculateSpendTrend(stats *OrderStats) float64 {
+	larger := math.Max(stats.RecentSpent, stats.PreviousSpent)
+	if larger == 0 {
+		return 0
+	}
+
+	return (stats.RecentSpent - stats.PreviousSpent) / larger
 }
 
 // calculateSeasonalFactor calculates seasonal impact on user behavior
@@ -214,11 +224,7 @@ func calculateSeasonalFactor() float64 {
 }
 
 // calculateWeekendActivityRatio calculates ratio of weekend activities
-func calculateWeekendActivityRatio(activities []struct {
-	ActivityType  string
-	ActivityDate  time.Time
-	ActivityValue float64
-}) float64 {
+func calculateWeekendActivityRatio(activities []UserActivity) float64 {
 	if len(activities) == 0 {
 		return 0
 	}
@@ -235,11 +241,7 @@ func calculateWeekendActivityRatio(activities []struct {
 }
 
 // calculateEveningActivityRatio calculates ratio of evening activities (6 PM - 12 AM)
-func calculateEveningActivityRatio(activities []struct {
-	ActivityType  string
-	ActivityDate  time.Time
-	ActivityValue float64
-}) float64 {
+func calculateEveningActivityRatio(activities []UserActivity) float64 {
 	if len(activities) == 0 {
 		return 0
 	}
@@ -273,6 +275,8 @@ func (m *StreakAIModel) TrainModel(trainingData []StreakTrainingData) error {
 		"weekend_activity_ratio":     0.03,
 		"evening_activity_ratio":     0.02,
 		"preferred_categories_count": 0.02,
+		"order_frequency":            0.02,
+		"spend_trend":                0.02,
 	}
 
 	// Simple gradient descent training
@@ -315,7 +319,8 @@ func (m *StreakAIModel) TrainModel(trainingData []StreakTrainingData) error {
 		Parameters:   map[string]interface{}{"learning_rate": 0.01, "epochs": epochs},
 		FeatureNames: []string{"days_since_last_activity", "current_streak_length", "average_streak_length",
 			"streak_break_frequency", "churn_risk", "last_order_days_ago", "seasonal_factor",
-			"weekend_activity_ratio", "evening_activity_ratio", "preferred_categories_count"},
+			"weekend_activity_ratio", "evening_activity_ratio", "preferred_categories_count",
+			"order_frequency", "spend_trend"},
 	}
 
 	return nil
@@ -361,6 +366,10 @@ func (m *StreakAIModel) getFeatureValue(features StreakFeatures, featureName str
 		return features.EveningActivityRatio
 	case "preferred_categories_count":
 		return float64(features.PreferredCategoriesCount)
+	case "order_frequency":
+		return features.OrderFrequency
+	case "spend_trend":
+		return features.SpendTrend
 	default:
 		return 0.0
 	}
@@ -400,7 +409,7 @@ func (m *StreakAIModel) PredictStreakDrop(userID int, userData *UserData) (*Stre
 	}
 
 	// Save prediction to database
-	err = SaveStreakPrediction(*prediction)
+	err = store.SaveStreakPrediction(*prediction)
 	if err != nil {
 		log.Printf("Warning: Could not save prediction to database: %v", err)
 	}
@@ -505,13 +514,17 @@ func GenerateTrainingData(userCount int) []StreakTrainingData {
 			ChurnRisk:                rand.Float64(),
 			PreferredCategoriesCount: rand.Intn(5),
 			LastOrderDaysAgo:         rand.Intn(60),
+			OrderFrequency:           rand.Float64() * 4,
+			AverageBasketSize:        1 + rand.Float64()*4,
+			SpendTrend:               rand.Float64()*2 - 1,
 			SeasonalFactor:           0.8 + rand.Float64()*0.4,
 			WeekendActivityRatio:     rand.Float64(),
 			EveningActivityRatio:     rand.Float64(),
 		}
 
 		// Generate label based on features (simplified logic)
-		label := features.DaysSinceLastActivity > 7 || features.ChurnRisk > 0.7 || features.LastOrderDaysAgo > 30
+		label := features.DaysSinceLastActivity > 7 || features.ChurnRisk > 0.7 || features.LastOrderDaysAgo > 30 ||
+			(features.SpendTrend < -0.5 && features.OrderFrequency < 1)
 
 		trainingData = append(trainingData, StreakTrainingData{
 			Features: features,
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPredictStreakDropUntrainedModel(t *testing.T) {
+	useMemoryStore(t)
+	user := createTestUser(t, "alice", "unused")
+	userData, err := store.GetUserData(user.UserID)
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+
+	prediction, err := NewStreakAIModel().PredictStreakDrop(user.UserID, userData)
+	if err != nil {
+		t.Fatalf("PredictStreakDrop: %v", err)
+	}
+	if prediction.ProbabilityOfStreakDrop != 0.5 || prediction.RiskLevel != "low" {
+		t.Errorf("untrained model predicted %.2f (%s), want 0.50 (low)", prediction.ProbabilityOfStreakDrop, prediction.RiskLevel)
+	}
+	// 0.5 is a medium probability: at least 3 days, or half the (empty) streak
+	if prediction.PredictedDaysToStreakDrop != 3 {
+		t.Errorf("predicted %d days to the drop, want 3", prediction.PredictedDaysToStreakDrop)
+	}
+
+	saved, err := store.GetStreakPredictions(user.UserID, 10)
+	if err != nil {
+		t.Fatalf("GetStreakPredictions: %v", err)
+	}
+	if len(saved) != 1 {
+		t.Errorf("saved %d predictions, want 1", len(saved))
+	}
+}
+
+func TestPredictStreakDropUsesModelWeights(t *testing.T) {
+	useMemoryStore(t)
+	model := NewStreakAIModel()
+	model.IsTrained = true
+	model.Weights = map[string]float64{"days_since_last_activity": 0.1, "current_streak_length": -1}
+
+	tests := []struct {
+		name         string
+		lastActivity time.Duration // before now
+		streak       int
+		wantRisk     string
+	}{
+		// sigmoid(0.1*30 - 1) = 0.88
+		{"inactive for a month", 30 * 24 * time.Hour, 1, "high"},
+		// sigmoid(0.1*0 - 5) = 0.007
+		{"active today on a long streak", time.Hour, 5, "low"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, "user"+string(rune('a'+i)), "unused")
+			if err := store.UpdateUserStreak(user.UserID, tt.streak, time.Now().Add(-tt.lastActivity)); err != nil {
+				t.Fatalf("UpdateUserStreak: %v", err)
+			}
+			userData, err := store.GetUserData(user.UserID)
+			if err != nil {
+				t.Fatalf("GetUserData: %v", err)
+			}
+
+			prediction, err := model.PredictStreakDrop(user.UserID, userData)
+			if err != nil {
+				t.Fatalf("PredictStreakDrop: %v", err)
+			}
+			f := prediction.Features
+			want := 1 / (1 + math.Exp(-(0.1*float64(f.DaysSinceLastActivity) - float64(f.CurrentStreakLength))))
+			if math.Abs(prediction.ProbabilityOfStreakDrop-want) > 1e-9 {
+				t.Errorf("probability %.4f, want %.4f", prediction.ProbabilityOfStreakDrop, want)
+			}
+			if prediction.RiskLevel != tt.wantRisk {
+				t.Errorf("risk level %q (probability %.3f), want %q", prediction.RiskLevel, prediction.ProbabilityOfStreakDrop, tt.wantRisk)
+			}
+			if len(prediction.RecommendedActions) == 0 {
+				t.Error("no recommended actions")
+			}
+		})
+	}
+}
+
+func TestExtractStreakFeaturesUsesWholeOrderHistory(t *testing.T) {
+	useMemoryStore(t)
+	createTestProducts(t)
+	user := createTestUser(t, "alice", "unused")
+	now := time.Now()
+	day := 24 * time.Hour
+
+	// order places the items at daysAgo and moves the order through statuses
+	order := func(daysAgo int, items []OrderItem, statuses ...string) {
+		t.Helper()
+		placed, err := store.PlaceOrder(Order{UserID: user.UserID, OrderDate: now.Add(-time.Duration(daysAgo) * day), Items: items})
+		if err != nil {
+			t.Fatalf("PlaceOrder: %v", err)
+		}
+		from := OrderPending
+		for _, to := range statuses {
+			event := OrderEvent{OrderID: placed.OrderID, FromStatus: from, ToStatus: to, CreatedAt: now}
+			if _, err := store.UpdateOrderStatus(event, 0); err != nil {
+				t.Fatalf("UpdateOrderStatus(%s): %v", to, err)
+			}
+			from = to
+		}
+	}
+	order(300, []OrderItem{{ProductID: 6, Quantity: 2}})                              // 700,000, before both trend windows
+	order(150, []OrderItem{{ProductID: 1, Quantity: 1}})                              // 450,000, previous window
+	order(120, []OrderItem{{ProductID: 4, Quantity: 1}, {ProductID: 6, Quantity: 1}}) // 850,000, previous window
+	order(100, []OrderItem{{ProductID: 2, Quantity: 1}}, OrderCancelled)
+	order(60, []OrderItem{{ProductID: 5, Quantity: 1}}, OrderPaid, OrderRefunded)
+	order(30, []OrderItem{{ProductID: 6, Quantity: 3}}) // 1,050,000, recent window
+	order(10, []OrderItem{{ProductID: 1, Quantity: 1}}) // 450,000, recent window
+	order(5, []OrderItem{{ProductID: 4, Quantity: 2}})  // 1,000,000, recent window
+
+	userData, err := store.GetUserData(user.UserID)
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+	f, err := ExtractStreakFeatures(user.UserID, userData)
+	if err != nil {
+		t.Fatalf("ExtractStreakFeatures: %v", err)
+	}
+
+	// Six of the eight orders count: 4,500,000 for 11 units
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"TotalOrders", float64(f.TotalOrders), 6},
+		{"AverageOrderValue", f.AverageOrderValue, 4500000.0 / 6},
+		{"AverageBasketSize", f.AverageBasketSize, 11.0 / 6},
+		{"SpendTrend", f.SpendTrend, (2500000.0 - 1300000.0) / 2500000.0},
+		{"OrderFrequency", f.OrderFrequency, 6.0 / 300 * 30},
+		{"RefundRate", f.RefundRate, 1.0 / 7},
+		{"LastOrderDaysAgo", float64(f.LastOrderDaysAgo), 5},
+	}
+	for _, tt := range tests {
+		if math.Abs(tt.got-tt.want) > 1e-6 {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
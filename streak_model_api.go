@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// streakModel is the most recently trained model used by the analytics endpoints.
+// Trained weights only live in memory, so it is nil until /api/models/train runs.
+var (
+	streakModelMu sync.RWMutex
+	streakModel   *StreakAIModel
+)
+
+// currentStreakModel returns the trained model, or nil if none has been trained yet
+func currentStreakModel() *StreakAIModel {
+	streakModelMu.RLock()
+	defer streakModelMu.RUnlock()
+	return streakModel
+}
+
+const (
+	defaultTrainingSamples = 1000
+	maxTrainingSamples     = 100000
+)
+
+// TrainModelHandler trains a new streak prediction model and makes it the active one.
+// The optional "samples" query parameter sets the size of the generated training set.
+func TrainModelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	samples := defaultTrainingSamples
+	if v := r.URL.Query().Get("samples"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxTrainingSamples {
+			http.Error(w, "samples must be between 1 and 100000", http.StatusBadRequest)
+			return
+		}
+		samples = n
+	}
+
+	model := NewStreakAIModel()
+	if err := model.TrainModel(GenerateTrainingData(samples)); err != nil {
+		log.Printf("Error training streak model: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := store.SaveStreakModel(*model.Model); err != nil {
+		log.Printf("Warning: Could not save model to database: %v", err)
+	}
+
+	streakModelMu.Lock()
+	streakModel = model
+	streakModelMu.Unlock()
+
+	authUser, _ := AuthUserFromContext(r.Context())
+	log.Printf("User %d trained a new streak model on %d samples", authUser.UserID, samples)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.Model)
+}
+
+// ActiveModelHandler returns the metadata of the active streak model
+func ActiveModelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	model, err := store.GetActiveStreakModel()
+	if err != nil {
+		log.Printf("Error fetching active model: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if model == nil {
+		http.Error(w, "No model has been trained yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model)
+}
@@ -1,6 +1,8 @@
  #!/bin/bash
 
 # Test script for the login API
+# Start the server with the dev users seeded first:
+#   SEED_DEV_USERS=true go run .
 API_URL="http://localhost:8080/api"
 
 echo "=== Testing Login API ==="
@@ -24,8 +26,17 @@ curl -X POST $API_URL/login \
 echo
 echo
 
+# Test successful login by email
+echo "3. Testing successful login by email (demo@example.com/demo123):"
+curl -X POST $API_URL/login \
+  -H "Content-Type: application/json" \
+  -d '{"email": "demo@example.com", "password": "demo123"}' \
+  | jq .
+echo
+echo
+
 # Test failed login
-echo "3. Testing failed login (wrong password):"
+echo "4. Testing failed login (wrong password):"
 curl -X POST $API_URL/login \
   -H "Content-Type: application/json" \
   -d '{"username": "admin", "password": "wrongpassword"}' \
@@ -34,7 +45,7 @@ echo
 echo
 
 # Test failed login with non-existent user
-echo "4. Testing failed login (non-existent user):"
+echo "5. Testing failed login (non-existent user):"
 curl -X POST $API_URL/login \
   -H "Content-Type: application/json" \
   -d '{"username": "nonexistent", "password": "anypassword"}' \
@@ -43,7 +54,7 @@ echo
 echo
 
 # Test health endpoint
-echo "5. Testing health endpoint:"
+echo "6. Testing health endpoint:"
 curl -X GET $API_URL/health | jq .
 echo
 echo
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types carried in the token_type claim so one kind of token can't be used as another
+const (
+	TokenTypeAccess = "access"
+	// TokenTypeMFAChallenge proves the password step of a two-step login succeeded
+	TokenTypeMFAChallenge = "mfa_challenge"
+)
+
+const (
+	defaultTokenIssuer     = "tic_hcm1_2025"
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	mfaChallengeTTL        = 5 * time.Minute
+)
+
+// AccessClaims are the claims carried by tokens issued by this service
+type AccessClaims struct {
+	UserID    int      `json:"uid"`
+	Roles     []string `json:"roles,omitempty"`
+	TokenType string   `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// signingKey is one entry of the key ring, identified by its kid
+type signingKey struct {
+	method    jwt.SigningMethod
+	signKey   interface{} // nil for keys that are only accepted for verification
+	verifyKey interface{}
+}
+
+// TokenIssuer signs and verifies JWTs. Keys are looked up by the `kid` header, so
+// a new key can be rolled out while tokens signed with retired keys stay valid
+// until they expire.
+type TokenIssuer struct {
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	currentKID string
+	keys       map[string]signingKey
+}
+
+// tokenIssuer is the TokenIssuer configured at startup
+var tokenIssuer *TokenIssuer
+
+// NewTokenIssuerFromEnv builds the key ring from the environment:
+//
+//	JWT_KID               kid of the current signing key (default "default")
+//	JWT_SECRET            HMAC secret for HS256 signing, or
+//	JWT_PRIVATE_KEY_FILE  PEM RSA (RS256) or EC P-256 (ES256) private key
+//	JWT_VERIFY_KEYS       retired keys still accepted, "kid=hmac:<secret>" or "kid=<public key PEM file>", comma-separated
+//	JWT_ACCESS_TTL        access token lifetime, e.g. "15m"
+//	JWT_REFRESH_TTL       refresh token lifetime, e.g. "720h"
+//	JWT_ISSUER            iss claim (default "tic_hcm1_2025")
+func NewTokenIssuerFromEnv() (*TokenIssuer, error) {
+	t := &TokenIssuer{
+		issuer:     defaultTokenIssuer,
+		accessTTL:  defaultAccessTokenTTL,
+		refreshTTL: defaultRefreshTokenTTL,
+		currentKID: "default",
+		keys:       make(map[string]signingKey),
+	}
+	if iss := os.Getenv("JWT_ISSUER"); iss != "" {
+		t.issuer = iss
+	}
+	if kid := os.Getenv("JWT_KID"); kid != "" {
+		t.currentKID = kid
+	}
+	if ttl := os.Getenv("JWT_ACCESS_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid JWT_ACCESS_TTL %q", ttl)
+		}
+		t.accessTTL = d
+	}
+	if ttl := os.Getenv("JWT_REFRESH_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid JWT_REFRESH_TTL %q", ttl)
+		}
+		t.refreshTTL = d
+	}
+
+	switch {
+	case os.Getenv("JWT_PRIVATE_KEY_FILE") != "":
+		key, err := loadPrivateSigningKey(os.Getenv("JWT_PRIVATE_KEY_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		t.keys[t.currentKID] = key
+	case os.Getenv("JWT_SECRET") != "":
+		t.keys[t.currentKID] = hmacSigningKey([]byte(os.Getenv("JWT_SECRET")))
+	default:
+		// Tokens won't survive a restart, which is fine for local development only
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("error generating JWT secret: %w", err)
+		}
+		log.Println("Warning: JWT_SECRET/JWT_PRIVATE_KEY_FILE not set. Using a random signing secret; tokens will be invalid after restart.")
+		t.keys[t.currentKID] = hmacSigningKey(secret)
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, source, found := strings.Cut(entry, "=")
+		if !found || kid == "" || source == "" {
+			return nil, fmt.Errorf("invalid JWT_VERIFY_KEYS entry %q", entry)
+		}
+		if kid == t.currentKID {
+			return nil, fmt.Errorf("JWT_VERIFY_KEYS entry %q reuses the current JWT_KID", kid)
+		}
+
+		if secret, isHMAC := strings.CutPrefix(source, "hmac:"); isHMAC {
+			key := hmacSigningKey([]byte(secret))
+			key.signKey = nil
+			t.keys[kid] = key
+			continue
+		}
+		key, err := loadPublicVerifyKey(source)
+		if err != nil {
+			return nil, err
+		}
+		t.keys[kid] = key
+	}
+
+	return t, nil
+}
+
+// hmacSigningKey returns an HS256 key usable for signing and verification
+func hmacSigningKey(secret []byte) signingKey {
+	return signingKey{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// loadPrivateSigningKey reads an RSA or EC private key from a PEM file
+func loadPrivateSigningKey(path string) (signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("error reading JWT private key: %w", err)
+	}
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return signingKey{method: jwt.SigningMethodRS256, signKey: key, verifyKey: key.Public()}, nil
+	}
+	if key, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+		return ecdsaSigningKey(key, key.Public())
+	}
+	return signingKey{}, fmt.Errorf("JWT private key %s is not a PEM RSA or EC private key", path)
+}
+
+// loadPublicVerifyKey reads an RSA or EC public key from a PEM file
+func loadPublicVerifyKey(path string) (signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("error reading JWT public key: %w", err)
+	}
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return signingKey{method: jwt.SigningMethodRS256, verifyKey: key}, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return ecdsaSigningKey(nil, key)
+	}
+	return signingKey{}, fmt.Errorf("JWT public key %s is not a PEM RSA or EC public key", path)
+}
+
+// ecdsaSigningKey picks ES256 for P-256 keys, the only curve we issue tokens with
+func ecdsaSigningKey(private *ecdsa.PrivateKey, public crypto.PublicKey) (signingKey, error) {
+	pub, ok := public.(*ecdsa.PublicKey)
+	if !ok || pub.Curve.Params().Name != "P-256" {
+		return signingKey{}, fmt.Errorf("only P-256 EC keys are supported for JWT signing")
+	}
+	key := signingKey{method: jwt.SigningMethodES256, verifyKey: pub}
+	if private != nil {
+		key.signKey = private
+	}
+	return key, nil
+}
+
+// RefreshTokenTTL returns how long issued refresh tokens are valid
+func (t *TokenIssuer) RefreshTokenTTL() time.Duration {
+	return t.refreshTTL
+}
+
+// IssueAccessToken signs a short-lived access token for a user
+func (t *TokenIssuer) IssueAccessToken(userID int, roles []string) (string, time.Time, error) {
+	return t.issue(userID, roles, TokenTypeAccess, t.accessTTL)
+}
+
+// IssueMFAChallenge signs the short-lived token that LoginHandler returns instead of an
+// access token when the account has two-factor authentication enabled
+func (t *TokenIssuer) IssueMFAChallenge(userID int) (string, time.Time, error) {
+	return t.issue(userID, nil, TokenTypeMFAChallenge, mfaChallengeTTL)
+}
+
+// issue signs a token of the given type with the current key
+func (t *TokenIssuer) issue(userID int, roles []string, tokenType string, ttl time.Duration) (string, time.Time, error) {
+	key, ok := t.keys[t.currentKID]
+	if !ok || key.signKey == nil {
+		return "", time.Time{}, fmt.Errorf("no signing key for kid %q", t.currentKID)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := AccessClaims{
+		UserID:    userID,
+		Roles:     roles,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        newTokenID(),
+		},
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = t.currentKID
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error signing token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseToken verifies a token's signature, issuer, expiry and type and returns its claims
+func (t *TokenIssuer) ParseToken(tokenString, expectedType string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := t.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// Reject alg confusion, e.g. an HS256 token "signed" with an RSA public key
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	},
+		jwt.WithIssuer(t.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != expectedType {
+		return nil, fmt.Errorf("expected %s token, got %q", expectedType, claims.TokenType)
+	}
+	return claims, nil
+}
+
+// newTokenID returns a random identifier for the jti claim
+func newTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand only fails if the OS entropy source is broken
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
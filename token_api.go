@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Session is the token pair handed to a client after it authenticates
+type Session struct {
+	AccessToken  string
+	ExpiresIn    int
+	RefreshToken string
+	Roles        []string
+}
+
+// issueSession creates an access token and a refresh token for a user.
+// An empty familyID starts a new refresh token family (a new login); rotations pass
+// the family of the token being replaced.
+func issueSession(user *User, familyID string) (*Session, error) {
+	accessToken, expiresAt, err := tokenIssuer.IssueAccessToken(user.UserID, user.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		familyID = newTokenID()
+	}
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = store.SaveRefreshToken(RefreshToken{
+		UserID:    user.UserID,
+		FamilyID:  familyID,
+		TokenHash: hashOpaqueToken(refreshToken),
+		IssuedAt:  now,
+		ExpiresAt: now.Add(tokenIssuer.RefreshTokenTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		AccessToken:  accessToken,
+		ExpiresIn:    int(time.Until(expiresAt).Seconds()),
+		RefreshToken: refreshToken,
+		Roles:        user.Roles,
+	}, nil
+}
+
+// newOpaqueToken returns a random opaque token (refresh tokens, password reset tokens)
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashOpaqueToken returns the value stored in the token_hash columns.
+// Opaque tokens are high-entropy random strings, so a fast hash is sufficient.
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a rotated refresh token
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := store.GetRefreshTokenByHash(hashOpaqueToken(req.RefreshToken))
+	if err != nil {
+		log.Printf("Error retrieving refresh token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if token == nil || token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Claim the token atomically. If it was already rotated, someone is replaying an
+	// old token (possibly stolen), so the whole session family is revoked.
+	rotated := false
+	if token.RotatedAt == nil {
+		rotated, err = store.MarkRefreshTokenRotated(token.TokenID, time.Now())
+		if err != nil {
+			log.Printf("Error rotating refresh token %d: %v", token.TokenID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if !rotated {
+		log.Printf("Refresh token reuse detected for user %d, revoking family %s", token.UserID, token.FamilyID)
+		if err := store.RevokeRefreshTokenFamily(token.FamilyID, time.Now()); err != nil {
+			log.Printf("Error revoking refresh token family %s: %v", token.FamilyID, err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := store.GetUserByID(token.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user %d for token refresh: %v", token.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := issueSession(user, token.FamilyID)
+	if err != nil {
+		log.Printf("Error issuing session for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TokenResponse{
+		Token:        session.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    session.ExpiresIn,
+		RefreshToken: session.RefreshToken,
+		Roles:        session.Roles,
+	})
+}
+
+// LogoutHandler revokes the refresh token family of the presented refresh token.
+// Access tokens already issued stay valid until they expire, which is why they are short-lived.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := store.GetRefreshTokenByHash(hashOpaqueToken(req.RefreshToken))
+	if err != nil {
+		log.Printf("Error retrieving refresh token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Unknown tokens are treated as already logged out so logout stays idempotent
+	if token != nil {
+		if err := store.RevokeRefreshTokenFamily(token.FamilyID, time.Now()); err != nil {
+			log.Printf("Error revoking refresh token family %s: %v", token.FamilyID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d logged out, revoked family %s", token.UserID, token.FamilyID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Logged out",
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// refresh posts refreshToken to RefreshTokenHandler and returns the status and the rotated token
+func refresh(t *testing.T, refreshToken string) (int, string) {
+	t.Helper()
+	rec := postJSON(t, RefreshTokenHandler, "/api/token/refresh", RefreshTokenRequest{RefreshToken: refreshToken})
+	if rec.Code != http.StatusOK {
+		return rec.Code, ""
+	}
+	var resp TokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding refresh response: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" || resp.RefreshToken == refreshToken {
+		t.Fatalf("refresh did not rotate the token pair: %+v", resp)
+	}
+	return rec.Code, resp.RefreshToken
+}
+
+func TestRefreshTokenHandlerRotatesTokens(t *testing.T) {
+	useMemoryStore(t)
+	user := createTestUser(t, "alice", "unused")
+	session, err := issueSession(user, "")
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+
+	code, second := refresh(t, session.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("first refresh: status %d, want 200", code)
+	}
+	code, third := refresh(t, second)
+	if code != http.StatusOK {
+		t.Fatalf("second refresh: status %d, want 200", code)
+	}
+
+	token, err := store.GetRefreshTokenByHash(hashOpaqueToken(third))
+	if err != nil || token == nil {
+		t.Fatalf("GetRefreshTokenByHash: %v", err)
+	}
+	first, _ := store.GetRefreshTokenByHash(hashOpaqueToken(session.RefreshToken))
+	if token.FamilyID != first.FamilyID {
+		t.Errorf("rotated token is in family %s, want %s", token.FamilyID, first.FamilyID)
+	}
+
+	if code, _ := refresh(t, "not-a-refresh-token"); code != http.StatusUnauthorized {
+		t.Errorf("unknown token: status %d, want 401", code)
+	}
+}
+
+func TestRefreshTokenHandlerRevokesFamilyOnReuse(t *testing.T) {
+	useMemoryStore(t)
+	user := createTestUser(t, "alice", "unused")
+	stolen, err := issueSession(user, "")
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+	other, err := issueSession(user, "")
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+
+	code, current := refresh(t, stolen.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: status %d, want 200", code)
+	}
+
+	// Replaying the rotated token is refused and takes the token issued after it down too
+	if code, _ := refresh(t, stolen.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("replayed token: status %d, want 401", code)
+	}
+	if code, _ := refresh(t, current); code != http.StatusUnauthorized {
+		t.Errorf("token from the revoked family: status %d, want 401", code)
+	}
+	token, err := store.GetRefreshTokenByHash(hashOpaqueToken(current))
+	if err != nil || token == nil {
+		t.Fatalf("GetRefreshTokenByHash: %v", err)
+	}
+	if token.RevokedAt == nil {
+		t.Error("latest token of the family was not revoked")
+	}
+
+	// Sessions from other logins are untouched
+	if code, _ := refresh(t, other.RefreshToken); code != http.StatusOK {
+		t.Errorf("token from another family: status %d, want 200", code)
+	}
+}
+
+func TestLogoutHandlerRevokesFamily(t *testing.T) {
+	useMemoryStore(t)
+	user := createTestUser(t, "alice", "unused")
+	session, err := issueSession(user, "")
+	if err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		// Logging out again, or with an unknown token, still succeeds
+		if rec := postJSON(t, LogoutHandler, "/api/logout", RefreshTokenRequest{RefreshToken: session.RefreshToken}); rec.Code != http.StatusOK {
+			t.Fatalf("logout %d: status %d, want 200", i+1, rec.Code)
+		}
+	}
+	if rec := postJSON(t, LogoutHandler, "/api/logout", RefreshTokenRequest{RefreshToken: "not-a-refresh-token"}); rec.Code != http.StatusOK {
+		t.Errorf("logout with an unknown token: status %d, want 200", rec.Code)
+	}
+	if code, _ := refresh(t, session.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: status %d, want 401", code)
+	}
+}
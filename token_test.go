@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signTestToken signs claims with the given method, kid and key, bypassing TokenIssuer
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims AccessClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+// testClaims returns valid access claims for user 7 from the default issuer
+func testClaims() AccessClaims {
+	now := time.Now()
+	return AccessClaims{
+		UserID:    7,
+		TokenType: TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    defaultTokenIssuer,
+			Subject:   strconv.Itoa(7),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func TestParseTokenRoundTrip(t *testing.T) {
+	issuer := newTestTokenIssuer()
+	token, _, err := issuer.IssueAccessToken(7, []string{RoleAdmin})
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	claims, err := issuer.ParseToken(token, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.UserID != 7 || len(claims.Roles) != 1 || claims.Roles[0] != RoleAdmin {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestParseTokenRejectsWrongTokenType(t *testing.T) {
+	issuer := newTestTokenIssuer()
+	challenge, _, err := issuer.IssueMFAChallenge(7)
+	if err != nil {
+		t.Fatalf("IssueMFAChallenge: %v", err)
+	}
+	access, _, err := issuer.IssueAccessToken(7, nil)
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+
+	// A password-only MFA challenge must not work as an access token, nor the reverse
+	if _, err := issuer.ParseToken(challenge, TokenTypeAccess); err == nil {
+		t.Error("MFA challenge token accepted as an access token")
+	}
+	if _, err := issuer.ParseToken(access, TokenTypeMFAChallenge); err == nil {
+		t.Error("access token accepted as an MFA challenge")
+	}
+	if _, err := issuer.ParseToken(challenge, TokenTypeMFAChallenge); err != nil {
+		t.Errorf("MFA challenge rejected: %v", err)
+	}
+
+	// Tokens without a token_type are rejected too
+	claims := testClaims()
+	claims.TokenType = ""
+	untyped := signTestToken(t, jwt.SigningMethodHS256, "test", testJWTSecret, claims)
+	if _, err := issuer.ParseToken(untyped, TokenTypeAccess); err == nil {
+		t.Error("token without token_type accepted")
+	}
+}
+
+func TestParseTokenRejectsAlgorithmConfusion(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	key, err := ecdsaSigningKey(private, &private.PublicKey)
+	if err != nil {
+		t.Fatalf("ecdsaSigningKey: %v", err)
+	}
+	issuer := &TokenIssuer{
+		issuer:     defaultTokenIssuer,
+		accessTTL:  time.Minute,
+		currentKID: "ec",
+		keys:       map[string]signingKey{"ec": key},
+	}
+
+	genuine := signTestToken(t, jwt.SigningMethodES256, "ec", private, testClaims())
+	if _, err := issuer.ParseToken(genuine, TokenTypeAccess); err != nil {
+		t.Fatalf("ES256 token rejected: %v", err)
+	}
+
+	// The classic attack: HS256 "signed" with the public key, which is no secret
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	forged := signTestToken(t, jwt.SigningMethodHS256, "ec", public, testClaims())
+	if _, err := issuer.ParseToken(forged, TokenTypeAccess); err == nil {
+		t.Error("HS256 token accepted for an ES256 key")
+	}
+
+	unsigned := signTestToken(t, jwt.SigningMethodNone, "ec", jwt.UnsafeAllowNoneSignatureType, testClaims())
+	if _, err := issuer.ParseToken(unsigned, TokenTypeAccess); err == nil {
+		t.Error(`token with alg "none" accepted`)
+	}
+}
+
+func TestParseTokenRejectsInvalidClaims(t *testing.T) {
+	issuer := newTestTokenIssuer()
+
+	expired := testClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	otherIssuer := testClaims()
+	otherIssuer.Issuer = "someone-else"
+	noExpiry := testClaims()
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", signTestToken(t, jwt.SigningMethodHS256, "test", testJWTSecret, expired)},
+		{"other issuer", signTestToken(t, jwt.SigningMethodHS256, "test", testJWTSecret, otherIssuer)},
+		{"no expiry", signTestToken(t, jwt.SigningMethodHS256, "test", testJWTSecret, noExpiry)},
+		{"unknown kid", signTestToken(t, jwt.SigningMethodHS256, "retired", testJWTSecret, testClaims())},
+		{"wrong secret", signTestToken(t, jwt.SigningMethodHS256, "test", []byte("not-the-secret"), testClaims())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := issuer.ParseToken(tt.token, TokenTypeAccess); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). SHA-1, 6 digits and 30 second steps are what every
+// authenticator app supports, so they are not configurable.
+const (
+	totpPeriod     = 30
+	totpDigits     = 6
+	totpSecretSize = 20 // 160-bit secret, as recommended by RFC 4226
+	// totpSkew is how many steps before/after the current one are accepted, for clock drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+// totpEncoding is unpadded base32, the format authenticator apps expect for secrets
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random base32-encoded TOTP secret
+func newTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpCode computes the HOTP value (RFC 4226) for a time step
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP checks a code against the secret around the given time and returns the
+// matched time step. Callers must reject steps that were already used to stop replays.
+func verifyTOTP(secretBase32, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	secret, err := totpEncoding.DecodeString(strings.ToUpper(secretBase32))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpIssuer is the issuer name shown in authenticator apps (TOTP_ISSUER, default "TIC HCM1 2025")
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "TIC HCM1 2025"
+}
+
+// totpProvisioningURI builds the otpauth:// URI that authenticator apps scan as a QR code
+func totpProvisioningURI(account, secret string) string {
+	issuer := totpIssuer()
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// newRecoveryCodes returns single-use recovery codes formatted as "xxxx-xxxx-xxxx-xxxx".
+// 80 random bits each, so a fast hash is enough to store them.
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("error generating recovery codes: %w", err)
+		}
+		c := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = c[0:4] + "-" + c[4:8] + "-" + c[8:12] + "-" + c[12:16]
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode normalizes a recovery code as typed by the user and hashes it for storage
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return hashOpaqueToken(code)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// RFC 6238 Appendix B lists 8-digit SHA-1 codes; a 6-digit code is their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Secret, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Secret)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		step   int64
+		wantOK bool
+	}{
+		{"current step", current, true},
+		{"previous step", current - 1, true},
+		{"next step", current + 1, true},
+		{"two steps behind", current - 2, false},
+		{"two steps ahead", current + 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := verifyTOTP(secret, totpCode(rfc6238Secret, tt.step), now)
+			if ok != tt.wantOK || (ok && step != tt.step) {
+				t.Errorf("verifyTOTP = %d, %t; want %d, %t", step, ok, tt.step, tt.wantOK)
+			}
+		})
+	}
+
+	code := totpCode(rfc6238Secret, current)
+	for _, typed := range []string{" " + code + " ", code[:3] + " " + code[3:]} {
+		if _, ok := verifyTOTP(secret, typed, now); !ok {
+			t.Errorf("verifyTOTP(%q) rejected a code with spaces", typed)
+		}
+	}
+	for _, bad := range []string{"", code[:5], code + "0", "abcdef"} {
+		if _, ok := verifyTOTP(secret, bad, now); ok {
+			t.Errorf("verifyTOTP(%q) accepted a malformed code", bad)
+		}
+	}
+	if _, ok := verifyTOTP("not base32!", code, now); ok {
+		t.Error("verifyTOTP accepted a code for a malformed secret")
+	}
+}